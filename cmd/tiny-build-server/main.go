@@ -26,6 +26,8 @@ import (
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/mailer"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/middleware"
 	panichandler "github.com/KaiserWerk/Tiny-Build-Server/internal/panicHandler"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/poller"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/scheduler"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/sessionservice"
 
 	"github.com/gorilla/mux"
@@ -73,6 +75,11 @@ func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int
 		logger.Info("configuration file didn't exist so it was created")
 		return 0
 	}
+	// secrets like webhook secrets cannot be stored without the master key
+	if config.Security.MasterKey == "" {
+		logger.Error("no master key set; set security.master_key in the configuration file or the environment variable TBS_MASTER_KEY to a long, random value")
+		return 1
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
@@ -110,12 +117,15 @@ func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int
 		tlsEnabled = true
 	}
 
-	router, err := setupRoutes(config, ds, logger)
+	router, httpHandler, err := setupRoutes(config, ds, logger)
 	if err != nil {
 		logger.WithField("error", err.Error()).Error("could not set up routes")
 		return 3
 	}
 
+	pollr := poller.New(httpHandler, ds, httpHandler.BuildService, logger.WithField("context", "Poller"))
+	go pollr.Run(ctx)
+
 	tlsConfig := &tls.Config{
 		MinVersion:       tls.VersionTLS12,
 		CurvePreferences: []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
@@ -219,17 +229,18 @@ func setupCronjobs(cronjob *cron.Cron, ds dbservice.IDBService) {
 	}))
 }
 
-func setupRoutes(cfg *configuration.AppConfig, ds dbservice.IDBService, l logging.ILogger) (*mux.Router, error) {
+func setupRoutes(cfg *configuration.AppConfig, ds dbservice.IDBService, l logging.ILogger) (*mux.Router, *handler.HTTPHandler, error) {
 	settings, err := ds.GetAllSettings()
 	if err != nil {
-		return nil, fmt.Errorf("could not fetch settings: %s", err.Error())
+		return nil, nil, fmt.Errorf("could not fetch settings: %s", err.Error())
 	}
 	sessionService := sessionservice.NewSessionService("tbs_sessid")
 	m := &mailer.Mailer{
 		Settings: settings,
 	}
 	dplSvc := &deploymentservice.DeploymentService{
-		Mailer: m,
+		Mailer:     m,
+		KnownHosts: ds,
 	}
 	bs := buildservice.New(cfg, sessionService, l, ds, dplSvc)
 
@@ -255,6 +266,7 @@ func setupRoutes(cfg *configuration.AppConfig, ds dbservice.IDBService, l loggin
 		DeployService:  dplSvc,
 		SessionService: sessionService,
 		Logger:         l,
+		Scheduler:      scheduler.New(),
 	}
 
 	fs := assets.GetWebAssetFS()
@@ -294,6 +306,9 @@ func setupRoutes(cfg *configuration.AppConfig, ds dbservice.IDBService, l loggin
 	adminRouter.HandleFunc("/user/{id}/edit", httpHandler.AdminUserEditHandler).Methods(http.MethodGet, http.MethodPost)
 	adminRouter.HandleFunc("/user/{id}/remove", httpHandler.AdminUserRemoveHandler).Methods(http.MethodGet, http.MethodPost)
 	adminRouter.HandleFunc("/settings", httpHandler.AdminSettingsHandler).Methods(http.MethodGet, http.MethodPost)
+	adminRouter.HandleFunc("/knownhost/list", httpHandler.KnownHostListHandler).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/knownhost/add", httpHandler.KnownHostAddHandler).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/knownhost/{id}/remove", httpHandler.KnownHostRemoveHandler).Methods(http.MethodPost)
 
 	// build definition
 	bdRouter := router.PathPrefix("/builddefinition").Subrouter()
@@ -303,9 +318,13 @@ func setupRoutes(cfg *configuration.AppConfig, ds dbservice.IDBService, l loggin
 	bdRouter.HandleFunc("/{id}/show", httpHandler.BuildDefinitionShowHandler).Methods(http.MethodGet)
 	bdRouter.HandleFunc("/{id}/edit", httpHandler.BuildDefinitionEditHandler).Methods(http.MethodGet, http.MethodPost)
 	bdRouter.HandleFunc("/{id}/remove", httpHandler.BuildDefinitionRemoveHandler).Methods(http.MethodGet)
+	bdRouter.HandleFunc("/{id}/secret", httpHandler.BuildDefinitionSecretHandler).Methods(http.MethodPost)
+	bdRouter.HandleFunc("/{id}/deploykey", httpHandler.DeployKeyGenerateHandler).Methods(http.MethodPost)
+	bdRouter.HandleFunc("/{id}/deploykey/remove", httpHandler.DeployKeyRemoveHandler).Methods(http.MethodPost)
 	//bdRouter.HandleFunc("/{id}/listexecutions", httpHandler.BuildDefinitionListExecutionsHandler).Methods(http.MethodGet)
-	bdRouter.HandleFunc("/{id}/restart", httpHandler.BuildDefinitionRestartHandler).Methods(http.MethodGet)
+	bdRouter.HandleFunc("/{id}/restart", httpHandler.BuildDefinitionRestartHandler).Methods(http.MethodGet, http.MethodPost)
 	bdRouter.HandleFunc("/{id}/artifact", httpHandler.DownloadNewestArtifactHandler).Methods(http.MethodGet)
+	bdRouter.HandleFunc("/{id}/environments", httpHandler.BuildDefinitionEnvironmentsHandler).Methods(http.MethodGet)
 
 	// build execution
 	beRouter := router.PathPrefix("/buildexecution").Subrouter()
@@ -313,6 +332,22 @@ func setupRoutes(cfg *configuration.AppConfig, ds dbservice.IDBService, l loggin
 	beRouter.HandleFunc("/list", httpHandler.BuildExecutionListHandler).Methods(http.MethodGet)
 	beRouter.HandleFunc("/{id}/show", httpHandler.BuildExecutionShowHandler).Methods(http.MethodGet)
 	beRouter.HandleFunc("/{id}/artifact", httpHandler.DownloadSpecificArtifactHandler).Methods(http.MethodGet)
+	beRouter.HandleFunc("/{id}/rollback", httpHandler.BuildExecutionRollbackHandler).Methods(http.MethodPost)
+	beRouter.HandleFunc("/{id}/redeploy", httpHandler.BuildExecutionRedeployHandler).Methods(http.MethodPost)
+
+	// deployment
+	dplRouter := router.PathPrefix("/deployment").Subrouter()
+	dplRouter.Use(mwHandler.Auth)
+	dplRouter.HandleFunc("/{id}/retry", httpHandler.DeploymentRetryHandler).Methods(http.MethodPost)
+	dplRouter.HandleFunc("/{id}/approve", httpHandler.DeploymentApproveHandler).Methods(http.MethodPost)
+	dplRouter.HandleFunc("/{id}/reject", httpHandler.DeploymentRejectHandler).Methods(http.MethodPost)
+
+	// webhook deliveries
+	whdRouter := router.PathPrefix("/webhookdelivery").Subrouter()
+	whdRouter.Use(mwHandler.Auth)
+	whdRouter.HandleFunc("/list", httpHandler.WebhookDeliveryListHandler).Methods(http.MethodGet)
+	whdRouter.HandleFunc("/{id}/show", httpHandler.WebhookDeliveryShowHandler).Methods(http.MethodGet)
+	whdRouter.HandleFunc("/{id}/replay", httpHandler.WebhookDeliveryReplayHandler).Methods(http.MethodPost)
 
 	// variables
 	varRouter := router.PathPrefix("/variable").Subrouter()
@@ -324,6 +359,9 @@ func setupRoutes(cfg *configuration.AppConfig, ds dbservice.IDBService, l loggin
 
 	// API handler
 	router.HandleFunc("/api/v1/receive", httpHandler.PayloadReceiveHandler).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/run", httpHandler.RunBuildDefinitionHandler).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/deployment/{id}/approve", httpHandler.APIDeploymentApproveHandler).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/deployment/{id}/reject", httpHandler.APIDeploymentRejectHandler).Methods(http.MethodPost)
 
-	return router, nil
+	return router, &httpHandler, nil
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -29,6 +30,9 @@ type Build struct {
 	executionTime time.Time
 	projectPath   string
 	artifact      string
+	version       string
+	release       string
+	secrets       []string
 
 	mut *sync.RWMutex
 }
@@ -58,6 +62,40 @@ func NewBuild(definition *entity.BuildDefinition, basePath string) *Build {
 	return &b
 }
 
+// FromArtifact returns the build an artifact was packed from, e.g. to deploy it again.
+// The directories of the build are not checked for existence.
+func FromArtifact(definition *entity.BuildDefinition, artifact string) *Build {
+	return &Build{
+		definition:    definition,
+		status:        entity.StatusSucceeded,
+		executionTime: time.Now(),
+		projectPath:   filepath.Dir(filepath.Dir(artifact)),
+		artifact:      artifact,
+
+		mut: new(sync.RWMutex),
+	}
+}
+
+// Fork returns a build sharing directories, artifact, version, release and secrets with b,
+// but with an empty report of its own, e.g. to keep the log of a single deployment
+func (b *Build) Fork() *Build {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	return &Build{
+		initiatedBy:   b.initiatedBy,
+		definition:    b.definition,
+		status:        b.status,
+		executionTime: b.executionTime,
+		projectPath:   b.projectPath,
+		artifact:      b.artifact,
+		version:       b.version,
+		release:       b.release,
+		secrets:       append([]string(nil), b.secrets...),
+
+		mut: new(sync.RWMutex),
+	}
+}
+
 func (b *Build) GetStatus() entity.BuildStatus {
 	return b.status
 }
@@ -66,11 +104,43 @@ func (b *Build) SetStatus(s entity.BuildStatus) {
 	b.status = s
 }
 
+// AddSecrets registers values which must never appear in the report. Every
+// occurrence, including common encoded forms, is replaced by a mask.
+func (b *Build) AddSecrets(values ...string) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	for _, v := range values {
+		for _, variant := range secretVariants(v) {
+			if !contains(b.secrets, variant) {
+				b.secrets = append(b.secrets, variant)
+			}
+		}
+	}
+	// replace the longest variants first, so no partial secret is left behind
+	sort.Slice(b.secrets, func(i, j int) bool {
+		return len(b.secrets[i]) > len(b.secrets[j])
+	})
+}
+
+// Mask replaces all registered secrets in the given string
+func (b *Build) Mask(s string) string {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	return b.mask(s)
+}
+
+func (b *Build) mask(s string) string {
+	for _, secret := range b.secrets {
+		s = strings.ReplaceAll(s, secret, entity.SecretMask)
+	}
+	return s
+}
+
 func (b *Build) AddReportEntry(e string) {
 	b.mut.Lock()
 	in := strings.TrimSpace(e)
 	if in != "" {
-		_, _ = b.reportWriter.WriteString(time.Now().Format(buildReportFormat) + ": " + in + "\n")
+		_, _ = b.reportWriter.WriteString(time.Now().Format(buildReportFormat) + ": " + b.mask(in) + "\n")
 	}
 	b.mut.Unlock()
 }
@@ -80,7 +150,7 @@ func (b *Build) AddReportEntryf(f string, a ...interface{}) {
 	in := strings.TrimSpace(f)
 	if in != "" {
 		m := fmt.Sprintf(in, strings.Trim(fmt.Sprintf("%v", a), "][")) + "\n"
-		_, _ = b.reportWriter.WriteString(time.Now().Format(buildReportFormat) + ": " + m)
+		_, _ = b.reportWriter.WriteString(time.Now().Format(buildReportFormat) + ": " + b.mask(m))
 	}
 	b.mut.Unlock()
 }
@@ -115,6 +185,26 @@ func (b *Build) GetArtifact() string {
 	return b.artifact
 }
 
+// SetVersion sets the version of the built software, e.g. the tag of a release
+func (b *Build) SetVersion(v string) {
+	b.version = v
+}
+
+// GetVersion returns the version of the built software
+func (b *Build) GetVersion() string {
+	return b.version
+}
+
+// SetRelease sets the name of the release directory remote deployments upload the build to
+func (b *Build) SetRelease(r string) {
+	b.release = r
+}
+
+// GetRelease returns the name of the release directory remote deployments upload the build to
+func (b *Build) GetRelease() string {
+	return b.release
+}
+
 // Pack packs the Build (the content from the build folder) into a zip file and puts the path to
 // the resulting zip file into the artifact field.
 func (b *Build) Pack(ctx context.Context) error {
@@ -127,7 +217,11 @@ func (b *Build) Pack(ctx context.Context) error {
 		return err
 	}
 
-	fh, err := os.CreateTemp(b.GetArtifactDir(), "artifact-*.zip")
+	pattern := "artifact-*.zip"
+	if b.version != "" {
+		pattern = "artifact-" + sanitizeFileName(b.version) + "-*.zip"
+	}
+	fh, err := os.CreateTemp(b.GetArtifactDir(), pattern)
 	if err != nil {
 		return err
 	}
@@ -144,6 +238,16 @@ func (b *Build) Pack(ctx context.Context) error {
 	return common.ZipFiles(fh, false, fileList)
 }
 
+// sanitizeFileName replaces all characters not suitable for file names
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, s)
+}
+
 func (b *Build) Setup(ctx context.Context) error {
 	if ctx.Err() != nil {
 		return ErrCanceled
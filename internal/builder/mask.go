@@ -0,0 +1,43 @@
+package builder
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+)
+
+// secretVariants returns the given secret along with the encoded forms it
+// might take when it ends up in command lines, URLs or headers.
+func secretVariants(secret string) []string {
+	if strings.TrimSpace(secret) == "" {
+		return nil
+	}
+
+	candidates := []string{
+		secret,
+		url.QueryEscape(secret),
+		url.PathEscape(secret),
+		// the userinfo part of a URL has its own escaping rules
+		strings.TrimPrefix(url.UserPassword("", secret).String(), ":"),
+		base64.StdEncoding.EncodeToString([]byte(secret)),
+		base64.URLEncoding.EncodeToString([]byte(secret)),
+	}
+
+	variants := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if c != "" && !contains(variants, c) {
+			variants = append(variants, c)
+		}
+	}
+
+	return variants
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
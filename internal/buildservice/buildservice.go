@@ -1,18 +1,27 @@
 package buildservice
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"net/url"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
 
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/common"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/configuration"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/dbservice"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/deploymentservice"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/git"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/logging"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/sessionservice"
 )
@@ -22,8 +31,8 @@ var (
 )
 
 type IBuildService interface {
-	CloneRepository(ctx context.Context, branch string, repositoryUrl string, path string) error
-	GetRepositoryUrl(ctx context.Context, cont *entity.BuildDefinitionContent, withCredentials bool) (string, error)
+	Checkout(ctx context.Context, repositoryUrl string, auth git.Auth, path string, ref entity.GitRef, sha string, opts entity.Checkout) (string, error)
+	GetRepositoryAccess(ctx context.Context, bd *entity.BuildDefinition) (string, git.Auth, error)
 	GetBasePath() string
 }
 
@@ -47,30 +56,145 @@ func New(cfg *configuration.AppConfig, sessSvc sessionservice.ISessionService, l
 	}
 }
 
-func (bs *BuildService) CloneRepository(ctx context.Context, branch string, repositoryUrl string, path string) error {
-	cmd := exec.CommandContext(ctx, "git", "clone", "--single-branch", "--branch", branch, repositoryUrl, path)
-	return cmd.Run()
+// Checkout checks out the branch, tag or explicit ref, e.g. "refs/pull/1/head", of the repository into path.
+// If sha is set, exactly this commit is checked out instead of the tip of the ref; it has to be reachable
+// from the ref or fetchable by itself. The output of the git commands is returned, also in case of errors.
+func (bs *BuildService) Checkout(ctx context.Context, repositoryUrl string, auth git.Auth, path string, ref entity.GitRef, sha string, opts entity.Checkout) (string, error) {
+	if sha != "" && !git.IsCommitSHA(sha) {
+		return "", fmt.Errorf("invalid commit %q", sha)
+	}
+	gitOpts, env, cleanup, err := auth.Prepare()
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	var output bytes.Buffer
+	if !opts.LFS {
+		env = append(env, "GIT_LFS_SKIP_SMUDGE=1")
+	}
+	run := func(args ...string) error {
+		output.WriteString("$ git " + strings.Join(args, " ") + "\n")
+		cmd := exec.CommandContext(ctx, "git", slices.Concat(gitOpts, []string{"-C", path}, args)...)
+		cmd.Env = env
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		return cmd.Run()
+	}
+	fetch := func(what string) error {
+		args := []string{"fetch", "--no-recurse-submodules"}
+		if opts.Depth > 0 {
+			args = append(args, "--depth", strconv.Itoa(opts.Depth))
+		} else {
+			args = append(args, "--tags")
+		}
+		return run(append(args, "--end-of-options", "origin", what)...)
+	}
+
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return "", err
+	}
+	if err := run("init", "--quiet"); err != nil {
+		return output.String(), err
+	}
+	if err := run("remote", "add", "origin", repositoryUrl); err != nil {
+		return output.String(), err
+	}
+	if len(opts.SparseCheckout) > 0 {
+		if err := run(append([]string{"sparse-checkout", "set", "--"}, opts.SparseCheckout...)...); err != nil {
+			return output.String(), err
+		}
+	}
+
+	fullRef := ref.Ref
+	if fullRef == "" {
+		if ref.IsTag() {
+			fullRef = "refs/tags/" + ref.Tag
+		} else {
+			fullRef = "refs/heads/" + ref.Branch
+		}
+	}
+	if err := fetch(fullRef); err != nil {
+		return output.String(), err
+	}
+
+	target := "FETCH_HEAD"
+	if sha != "" {
+		// the ref may have moved on or the commit may lie beyond the fetched depth
+		if err := run("cat-file", "-e", "--end-of-options", sha+"^{commit}"); err != nil {
+			if err = fetch(sha); err != nil {
+				return output.String(), fmt.Errorf("commit %s is not available: %w", sha, err)
+			}
+		}
+		target = sha
+	}
+
+	// branches are checked out as such, everything else detached; unlike checkout, switch
+	// knows --end-of-options
+	checkout := []string{"switch", "--quiet", "--detach", "--end-of-options", target}
+	if ref.Ref == "" && !ref.IsTag() {
+		checkout = []string{"switch", "--quiet", "-C", ref.Branch, "--end-of-options", target}
+	}
+	if err := run(checkout...); err != nil {
+		return output.String(), err
+	}
+
+	if opts.Submodules {
+		args := []string{"submodule", "update", "--init", "--recursive"}
+		if opts.Depth > 0 {
+			args = append(args, "--depth", strconv.Itoa(opts.Depth))
+		}
+		if err := run(args...); err != nil {
+			return output.String(), err
+		}
+	}
+	if opts.LFS {
+		if err := run("lfs", "pull"); err != nil {
+			return output.String(), err
+		}
+		if opts.Submodules {
+			if err := run("submodule", "foreach", "--recursive", "git lfs pull"); err != nil {
+				return output.String(), err
+			}
+		}
+	}
+
+	return output.String(), nil
 }
 
-func (bs *BuildService) GetRepositoryUrl(ctx context.Context, cont *entity.BuildDefinitionContent, withCredentials bool) (string, error) {
+// GetRepositoryAccess returns the url of the repository of the build definition and the credentials to access it.
+// With a deploy key and an SSH url, the repository is accessed via SSH, otherwise the access credentials are used.
+func (bs *BuildService) GetRepositoryAccess(ctx context.Context, bd *entity.BuildDefinition) (string, git.Auth, error) {
 	if ctx.Err() != nil {
-		return "", ErrCanceled
-	}
-	//var url string
-	switch cont.Repository.Hoster {
-	case "local":
-		return cont.Repository.Url, nil
-	default:
-		urlParts, err := url.ParseRequestURI(cont.Repository.Url)
-		if err != nil {
-			return "", err
+		return "", git.Auth{}, ErrCanceled
+	}
+	repo := bd.Data.Repository
+	if repo.Hoster == "local" {
+		return repo.Url, git.Auth{}, nil
+	}
+
+	if repo.SSHUrl != "" {
+		key, err := bs.DBSvc.GetDeployKey(bd.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", git.Auth{}, err
 		}
-		if !withCredentials {
-			return urlParts.String(), nil
+		if key.PrivateKey != "" {
+			return repo.SSHUrl, git.Auth{PrivateKey: key.PrivateKey, KnownHostsFile: bs.KnownHostsFile()}, nil
 		}
-		urlParts.User = url.UserPassword(cont.Repository.AccessUser, cont.Repository.AccessSecret)
-		return urlParts.String(), nil
 	}
+
+	urlParts, err := url.ParseRequestURI(repo.Url)
+	if err != nil {
+		return "", git.Auth{}, err
+	}
+	// credentials are passed by a credential helper, never as part of the url
+	urlParts.User = nil
+	return urlParts.String(), git.Auth{Username: repo.AccessUser, Password: repo.AccessSecret}, nil
+}
+
+// KnownHostsFile returns the known_hosts file used for SSH connections to git hosters
+func (bs *BuildService) KnownHostsFile() string {
+	return filepath.Join(bs.GetBasePath(), "ssh", "known_hosts")
 }
 
 func (bs *BuildService) GetBasePath() string {
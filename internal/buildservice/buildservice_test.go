@@ -1 +1,157 @@
 package buildservice
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/git"
+)
+
+// newTestRepository creates a repository with two commits on main and returns its path and the commits
+func newTestRepository(t *testing.T) (string, []string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %s: %s", args, err.Error(), output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("init", "--quiet", "--initial-branch=main")
+	write("main.go", "first")
+	write("docs/index.md", "docs")
+	write("src/lib.go", "lib")
+	run("add", "-A")
+	run("commit", "--quiet", "-m", "initial")
+	first := run("rev-parse", "HEAD")
+
+	write("main.go", "second")
+	run("add", "-A")
+	run("commit", "--quiet", "-m", "change")
+	second := run("rev-parse", "HEAD")
+
+	return dir, []string{first, second}
+}
+
+func headOf(t *testing.T, dir string) string {
+	t.Helper()
+	output, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func TestBuildService_Checkout(t *testing.T) {
+	repo, commits := newTestRepository(t)
+	bs := &BuildService{}
+	branch := entity.GitRef{Branch: "main"}
+
+	t.Run("tip of branch", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "clone")
+		output, err := bs.Checkout(context.Background(), repo, git.Auth{}, dir, branch, "", entity.Checkout{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s: %s", err.Error(), output)
+		}
+		if got := headOf(t, dir); got != commits[1] {
+			t.Errorf("expected commit %s, got %s", commits[1], got)
+		}
+		if !strings.Contains(output, "$ git fetch") {
+			t.Errorf("expected the commands in the output, got %q", output)
+		}
+	})
+
+	t.Run("exact commit", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "clone")
+		output, err := bs.Checkout(context.Background(), repo, git.Auth{}, dir, branch, commits[0], entity.Checkout{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s: %s", err.Error(), output)
+		}
+		if got := headOf(t, dir); got != commits[0] {
+			t.Errorf("expected commit %s, got %s", commits[0], got)
+		}
+		content, _ := os.ReadFile(filepath.Join(dir, "main.go"))
+		if string(content) != "first" {
+			t.Errorf("expected the content of the first commit, got %q", content)
+		}
+	})
+
+	t.Run("sparse checkout", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "clone")
+		output, err := bs.Checkout(context.Background(), repo, git.Auth{}, dir, branch, "", entity.Checkout{SparseCheckout: []string{"docs"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %s: %s", err.Error(), output)
+		}
+		if _, err = os.Stat(filepath.Join(dir, "docs", "index.md")); err != nil {
+			t.Errorf("expected docs to be checked out: %s", err.Error())
+		}
+		// files at the top level are always part of a cone mode sparse checkout
+		if _, err = os.Stat(filepath.Join(dir, "main.go")); err != nil {
+			t.Errorf("expected top level files to be checked out: %s", err.Error())
+		}
+		if _, err = os.Stat(filepath.Join(dir, "src", "lib.go")); !os.IsNotExist(err) {
+			t.Error("expected other directories not to be checked out")
+		}
+	})
+
+	t.Run("shallow", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "clone")
+		output, err := bs.Checkout(context.Background(), "file://"+filepath.ToSlash(repo), git.Auth{}, dir, branch, commits[1], entity.Checkout{Depth: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %s: %s", err.Error(), output)
+		}
+		count, err := exec.Command("git", "-C", dir, "rev-list", "--count", "HEAD").Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(string(count)); got != "1" {
+			t.Errorf("expected 1 commit in the history, got %s", got)
+		}
+	})
+
+	t.Run("unknown commit", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "clone")
+		_, err := bs.Checkout(context.Background(), repo, git.Auth{}, dir, branch, strings.Repeat("a", 40), entity.Checkout{})
+		if err == nil {
+			t.Error("expected an error for an unknown commit")
+		}
+	})
+
+	t.Run("option as ref", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "clone")
+		marker := filepath.Join(t.TempDir(), "marker")
+		ref := entity.GitRef{Ref: "--upload-pack=touch " + marker + ";git-upload-pack"}
+		if _, err := bs.Checkout(context.Background(), repo, git.Auth{}, dir, ref, "", entity.Checkout{}); err == nil {
+			t.Error("expected an error for an invalid ref")
+		}
+		if _, err := os.Stat(marker); !os.IsNotExist(err) {
+			t.Errorf("expected the ref not to be taken as option, got %v", err)
+		}
+		if _, err := bs.Checkout(context.Background(), repo, git.Auth{}, filepath.Join(t.TempDir(), "clone"), branch, "--upload-pack=x", entity.Checkout{}); err == nil {
+			t.Error("expected an error for an invalid commit")
+		}
+	})
+}
@@ -2,10 +2,12 @@ package common
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
 	"github.com/kballard/go-shellquote"
 	"gopkg.in/yaml.v3"
-	"strings"
 )
 
 func SplitCommand(input string) ([]string, error) {
@@ -17,7 +19,7 @@ func UnmarshalBuildDefinition(content []byte, vars []entity.UserVariable) (entit
 	ReplaceVariables(&s, vars)
 
 	var bdc entity.BuildDefinitionContent
-	if err := yaml.Unmarshal(content, &bdc); err != nil {
+	if err := yaml.Unmarshal([]byte(s), &bdc); err != nil {
 		return entity.BuildDefinitionContent{}, err
 	}
 
@@ -33,3 +35,37 @@ func ReplaceVariables(content *string, variables []entity.UserVariable) {
 		*content = strings.ReplaceAll(*content, fmt.Sprintf("${%s}", v.Variable), v.Value)
 	}
 }
+
+// ResolveVariables merges the variables of all scopes into the set of variables available
+// to a build definition owned by the user with the given ownerId. Variables with the same
+// name are overridden in the following order, from lowest to highest precedence:
+// global variables, public variables of other users, the owner's variables and
+// the variables attached to the build definition itself.
+func ResolveVariables(ownerId uint, global, user, definition []entity.UserVariable) []entity.UserVariable {
+	public := make([]entity.UserVariable, 0)
+	own := make([]entity.UserVariable, 0)
+	for _, v := range user {
+		if v.UserEntryID == ownerId {
+			own = append(own, v)
+		} else if v.Public {
+			public = append(public, v)
+		}
+	}
+
+	resolved := make(map[string]entity.UserVariable)
+	for _, set := range [][]entity.UserVariable{global, public, own, definition} {
+		for _, v := range set {
+			resolved[v.Variable] = v
+		}
+	}
+
+	variables := make([]entity.UserVariable, 0, len(resolved))
+	for _, v := range resolved {
+		variables = append(variables, v)
+	}
+	sort.Slice(variables, func(i, j int) bool {
+		return variables[i].Variable < variables[j].Variable
+	})
+
+	return variables
+}
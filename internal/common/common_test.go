@@ -3,6 +3,8 @@ package common
 import (
 	"reflect"
 	"testing"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
 )
 
 func TestSplitCommand(t *testing.T) {
@@ -29,3 +31,42 @@ func TestSplitCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveVariables(t *testing.T) {
+	var owner uint = 1
+	global := []entity.UserVariable{
+		{Variable: "a", Value: "global", Scope: entity.VariableScopeGlobal},
+		{Variable: "b", Value: "global", Scope: entity.VariableScopeGlobal},
+		{Variable: "c", Value: "global", Scope: entity.VariableScopeGlobal},
+		{Variable: "d", Value: "global", Scope: entity.VariableScopeGlobal},
+	}
+	user := []entity.UserVariable{
+		{Variable: "b", Value: "public", UserEntryID: 2, Public: true},
+		{Variable: "c", Value: "own", UserEntryID: owner},
+		{Variable: "c", Value: "public", UserEntryID: 3, Public: true},
+		{Variable: "e", Value: "private", UserEntryID: 2},
+	}
+	definition := []entity.UserVariable{
+		{Variable: "d", Value: "definition", Scope: entity.VariableScopeDefinition},
+	}
+
+	want := map[string]string{
+		"a": "global",
+		"b": "public",
+		"c": "own",
+		"d": "definition",
+	}
+
+	got := ResolveVariables(owner, global, user, definition)
+	if len(got) != len(want) {
+		t.Fatalf("expected %d variables, got %d: %v", len(want), len(got), got)
+	}
+	for i, v := range got {
+		if want[v.Variable] != v.Value {
+			t.Errorf("variable %s: expected value '%s', got '%s'", v.Variable, want[v.Variable], v.Value)
+		}
+		if i > 0 && got[i-1].Variable > v.Variable {
+			t.Errorf("expected variables to be sorted by name")
+		}
+	}
+}
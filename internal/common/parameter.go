@@ -0,0 +1,95 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// ResolveParameters validates the supplied values against the declared build parameters
+// and fills in default values for parameters without a supplied value
+func ResolveParameters(params []entity.Parameter, input map[string]string) (map[string]string, error) {
+	declared := make(map[string]bool, len(params))
+	resolved := make(map[string]string, len(params))
+
+	for _, p := range params {
+		if p.Name == "" {
+			return nil, fmt.Errorf("parameter without a name")
+		}
+		declared[p.Name] = true
+
+		value, ok := input[p.Name]
+		if !ok {
+			value = p.Default
+		}
+
+		switch p.Type {
+		case entity.ParameterTypeBoolean:
+			b, err := parseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("parameter '%s': %s", p.Name, err.Error())
+			}
+			value = fmt.Sprintf("%t", b)
+		case entity.ParameterTypeChoice:
+			if len(p.Choices) == 0 {
+				return nil, fmt.Errorf("parameter '%s' has no choices", p.Name)
+			}
+			if value == "" {
+				value = p.Choices[0]
+			}
+			if !stringInSlice(value, p.Choices) {
+				return nil, fmt.Errorf("parameter '%s': '%s' is not one of %s", p.Name, value, strings.Join(p.Choices, ", "))
+			}
+		case entity.ParameterTypeString, "":
+		default:
+			return nil, fmt.Errorf("parameter '%s' has unknown type '%s'", p.Name, p.Type)
+		}
+
+		resolved[p.Name] = value
+	}
+
+	for name := range input {
+		if !declared[name] {
+			return nil, fmt.Errorf("unknown parameter '%s'", name)
+		}
+	}
+
+	return resolved, nil
+}
+
+// ParametersToVariables turns build parameters into variables, so they
+// can be used like any other variable
+func ParametersToVariables(params map[string]string) []entity.UserVariable {
+	vars := make([]entity.UserVariable, 0, len(params))
+	for name, value := range params {
+		vars = append(vars, entity.UserVariable{
+			Variable: name,
+			Value:    value,
+		})
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Variable < vars[j].Variable
+	})
+	return vars
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "true", "yes", "on":
+		return true, nil
+	case "", "0", "false", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("'%s' is not a boolean value", s)
+}
+
+func stringInSlice(s string, list []string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+func TestResolveParameters(t *testing.T) {
+	params := []entity.Parameter{
+		{Name: "channel", Type: entity.ParameterTypeChoice, Choices: []string{"stable", "beta"}},
+		{Name: "skip_tests", Type: entity.ParameterTypeBoolean, Default: "false"},
+		{Name: "note", Type: entity.ParameterTypeString, Default: "none"},
+	}
+
+	tests := []struct {
+		name    string
+		input   map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"defaults", nil, map[string]string{"channel": "stable", "skip_tests": "false", "note": "none"}, false},
+		{"supplied values", map[string]string{"channel": "beta", "skip_tests": "on", "note": "hi"}, map[string]string{"channel": "beta", "skip_tests": "true", "note": "hi"}, false},
+		{"invalid choice", map[string]string{"channel": "nightly"}, nil, true},
+		{"invalid boolean", map[string]string{"skip_tests": "maybe"}, nil, true},
+		{"unknown parameter", map[string]string{"other": "x"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveParameters(params, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveParameters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveParameters() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
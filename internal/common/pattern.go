@@ -0,0 +1,58 @@
+package common
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MatchPattern checks whether a name like a branch name or a file path matches the given
+// pattern. A single '*' matches any sequence of characters except '/', '**' matches any
+// sequence of characters including '/' and '?' matches any single character except '/'.
+// A pattern without wildcards has to match exactly.
+func MatchPattern(pattern, name string) bool {
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern == name
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				// "**/" also matches no directory at all
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return false
+	}
+	return re.MatchString(name)
+}
+
+// MatchAnyPattern checks whether the name matches at least one of the given patterns
+func MatchAnyPattern(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if MatchPattern(p, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package common
+
+import "testing"
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"main", "main", true},
+		{"main", "main2", false},
+		{"release/*", "release/1.0", true},
+		{"release/*", "release/1.0/hotfix", false},
+		{"release/*", "release", false},
+		{"feature/**", "feature/a", true},
+		{"feature/**", "feature/a/b/c", true},
+		{"feature/**", "features/a", false},
+		{"v?.*", "v1.2", true},
+		{"v?.*", "v10.2", false},
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "docs/guide/setup.md", true},
+		{"docs/**", "docs/a.md", true},
+		{"*.go", "cmd/main.go", false},
+		{"release-(1)", "release-(1)", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if got := MatchPattern(tt.pattern, tt.name); got != tt.want {
+				t.Errorf("MatchPattern(%s, %s) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+			}
+		})
+	}
+}
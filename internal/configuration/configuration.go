@@ -21,6 +21,7 @@ type AppConfig struct {
 	Database   Database         `yaml:"database"`
 	TLS        Tls              `yaml:"tls"`
 	Build      Build            `yaml:"build"`
+	Security   Security         `yaml:"security"`
 	StorageBox StorageBoxConfig `yaml:"storagebox"`
 }
 
@@ -36,6 +37,9 @@ type (
 	Build struct {
 		BasePath string `yaml:"basepath" envconfig:"basepath"`
 	}
+	Security struct {
+		MasterKey string `yaml:"master_key" envconfig:"master_key"`
+	}
 	StorageBoxConfig struct {
 		Username string `yaml:"username" envconfig:"storagebox_username"`
 		Password string `yaml:"password" envconfig:"storagebox_password"`
@@ -76,6 +80,9 @@ func Setup(file string) (*AppConfig, bool, error) {
 	if s := os.Getenv("TBS_DB_DSN"); s != "" {
 		cfg.Database.DSN = s
 	}
+	if s := os.Getenv("TBS_MASTER_KEY"); s != "" {
+		cfg.Security.MasterKey = s
+	}
 
 	return &cfg, created, nil
 }
@@ -1 +1,30 @@
 package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetupMasterKeyFromEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(file, []byte("security:\n  master_key: fromfile\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := Setup(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Security.MasterKey != "fromfile" {
+		t.Errorf("expected the master key of the file, got %q", cfg.Security.MasterKey)
+	}
+
+	t.Setenv("TBS_MASTER_KEY", "fromenv")
+	if cfg, _, err = Setup(file); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Security.MasterKey != "fromenv" {
+		t.Errorf("expected the master key of the environment, got %q", cfg.Security.MasterKey)
+	}
+}
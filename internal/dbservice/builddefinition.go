@@ -1,8 +1,14 @@
 package dbservice
 
 import (
-	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
 	"gorm.io/gorm"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/encryption"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
 )
 
 // GetNewestBuildDefinitions fetches the most recently edited or added build definitions
@@ -21,6 +27,12 @@ func (ds *DBService) GetNewestBuildDefinitions(limit int) ([]entity.BuildDefinit
 		return nil, result.Error
 	}
 
+	for i := range bdList {
+		if err := ds.decryptBuildDefinition(&bdList[i]); err != nil {
+			return nil, err
+		}
+	}
+
 	return bdList, nil
 }
 
@@ -32,6 +44,12 @@ func (ds *DBService) GetAllBuildDefinitions() ([]entity.BuildDefinition, error)
 		return nil, result.Error
 	}
 
+	for i := range bds {
+		if err := ds.decryptBuildDefinition(&bds[i]); err != nil {
+			return nil, err
+		}
+	}
+
 	return bds, nil
 }
 
@@ -43,6 +61,10 @@ func (ds *DBService) FindBuildDefinition(cond string, args ...interface{}) (enti
 		return bd, result.Error
 	}
 
+	if err := ds.decryptBuildDefinition(&bd); err != nil {
+		return entity.BuildDefinition{}, err
+	}
+
 	return bd, nil
 }
 
@@ -53,6 +75,9 @@ func (ds *DBService) GetBuildDefinitionById(id uint) (entity.BuildDefinition, er
 	if result.Error != nil {
 		return entity.BuildDefinition{}, result.Error
 	}
+	if err := ds.decryptBuildDefinition(&buildDefinition); err != nil {
+		return entity.BuildDefinition{}, err
+	}
 	return buildDefinition, nil
 }
 
@@ -70,29 +95,84 @@ func (ds *DBService) GetBuildDefCaption(id uint) (string, error) {
 // DeleteBuildDefinition removes a build definition
 func (ds *DBService) DeleteBuildDefinition(bd *entity.BuildDefinition) error {
 	bd.Deleted = true
-	result := ds.db.Updates(bd)
-	if result.Error != nil {
-		return result.Error
-	}
-	return nil
+	return ds.UpdateBuildDefinition(bd)
 }
 
-// AddBuildDefinition adds a new build definition
+// AddBuildDefinition adds a new build definition; the webhook secret is stored encrypted
 func (ds *DBService) AddBuildDefinition(bd *entity.BuildDefinition) (uint, error) {
 	bd.Deleted = false
-	result := ds.db.Create(bd)
+	stored := *bd
+	if err := ds.encryptBuildDefinition(&stored); err != nil {
+		return 0, err
+	}
+	result := ds.db.Create(&stored)
 	if result.Error != nil {
 		return 0, result.Error
 	}
+	bd.Model = stored.Model
 
 	return bd.ID, nil
 }
 
-// UpdateBuildDefinition updates a build definition
+// UpdateBuildDefinition updates a build definition; the webhook secret is stored encrypted
 func (ds *DBService) UpdateBuildDefinition(bd *entity.BuildDefinition) error {
-	result := ds.db.Updates(bd)
+	stored := *bd
+	if err := ds.encryptBuildDefinition(&stored); err != nil {
+		return err
+	}
+	result := ds.db.Updates(&stored)
 	if result.Error != nil {
 		return result.Error
 	}
+	bd.Model = stored.Model
+	return nil
+}
+
+// migrateWebhookSecrets encrypts webhook secrets stored in plaintext and generates one for every
+// build definition without, since webhooks without verification are rejected
+func (ds *DBService) migrateWebhookSecrets() error {
+	var bds []entity.BuildDefinition
+	if err := ds.db.Find(&bds).Error; err != nil {
+		return err
+	}
+	for i := range bds {
+		if encryption.IsEncrypted(bds[i].WebhookSecret) {
+			continue
+		}
+		if bds[i].WebhookSecret == "" {
+			b := make([]byte, 32)
+			if _, err := rand.Read(b); err != nil {
+				return err
+			}
+			bds[i].WebhookSecret = hex.EncodeToString(b)
+		}
+		if err := ds.encryptBuildDefinition(&bds[i]); err != nil {
+			return err
+		}
+		if err := ds.db.Model(&bds[i]).Update("webhook_secret", bds[i].WebhookSecret).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ds *DBService) encryptBuildDefinition(bd *entity.BuildDefinition) error {
+	if bd.WebhookSecret == "" || encryption.IsEncrypted(bd.WebhookSecret) {
+		return nil
+	}
+	enc, err := encryption.Encrypt(ds.masterKey, bd.WebhookSecret)
+	if err != nil {
+		return fmt.Errorf("could not encrypt webhook secret: %s", err.Error())
+	}
+	bd.WebhookSecret = enc
+	return nil
+}
+
+func (ds *DBService) decryptBuildDefinition(bd *entity.BuildDefinition) error {
+	dec, err := encryption.Decrypt(ds.masterKey, bd.WebhookSecret)
+	if err != nil {
+		return fmt.Errorf("could not decrypt webhook secret of build definition %d: %s", bd.ID, err.Error())
+	}
+	bd.WebhookSecret = dec
 	return nil
 }
@@ -1 +1,38 @@
 package dbservice
+
+import (
+	"testing"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/encryption"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+func TestBuildDefinitionWebhookSecretEncryption(t *testing.T) {
+	ds := &DBService{masterKey: "master"}
+
+	bd := entity.BuildDefinition{WebhookSecret: "webhooksecret"}
+	if err := ds.encryptBuildDefinition(&bd); err != nil {
+		t.Fatal(err)
+	}
+	if !encryption.IsEncrypted(bd.WebhookSecret) {
+		t.Fatalf("expected the webhook secret to be encrypted, got %q", bd.WebhookSecret)
+	}
+	enc := bd.WebhookSecret
+	if err := ds.encryptBuildDefinition(&bd); err != nil || bd.WebhookSecret != enc {
+		t.Errorf("expected an encrypted secret to be kept, got %q (%v)", bd.WebhookSecret, err)
+	}
+	if err := ds.decryptBuildDefinition(&bd); err != nil || bd.WebhookSecret != "webhooksecret" {
+		t.Errorf("expected the decrypted secret, got %q (%v)", bd.WebhookSecret, err)
+	}
+
+	// secrets stored before encryption are read as they are
+	legacy := entity.BuildDefinition{WebhookSecret: "plaintext"}
+	if err := ds.decryptBuildDefinition(&legacy); err != nil || legacy.WebhookSecret != "plaintext" {
+		t.Errorf("expected the plaintext secret, got %q (%v)", legacy.WebhookSecret, err)
+	}
+
+	empty := entity.BuildDefinition{}
+	if err := (&DBService{}).encryptBuildDefinition(&empty); err != nil || empty.WebhookSecret != "" {
+		t.Errorf("expected an empty secret to stay empty, got %q (%v)", empty.WebhookSecret, err)
+	}
+}
@@ -12,14 +12,14 @@ func (ds *DBService) GetNewestBuildExecutions(limit int, query string, args ...i
 	var result *gorm.DB
 	if limit > 0 {
 		if query != "" {
-			result = ds.db.Where(query, args).Limit(limit).Order("executed_at desc").Find(&beList)
+			result = ds.db.Where(query, args...).Limit(limit).Order("executed_at desc").Find(&beList)
 		} else {
 			result = ds.db.Limit(limit).Order("executed_at desc").Find(&beList)
 		}
 
 	} else {
 		if query != "" {
-			result = ds.db.Where(query, args).Order("executed_at desc").Find(&beList)
+			result = ds.db.Where(query, args...).Order("executed_at desc").Find(&beList)
 		} else {
 			result = ds.db.Order("executed_at desc").Find(&beList)
 		}
@@ -50,6 +50,16 @@ func (ds *DBService) FindBuildExecutions(query interface{}, args ...interface{})
 	return executions, nil
 }
 
+// GetBuildExecutionBranches fetches the distinct names of all branches which have been built
+func (ds *DBService) GetBuildExecutionBranches() ([]string, error) {
+	branches := make([]string, 0)
+	result := ds.db.Model(&entity.BuildExecution{}).Where("branch <> ''").Distinct().Order("branch").Pluck("branch", &branches)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return branches, nil
+}
+
 // AddBuildExecution adds a new build execution
 func (ds *DBService) AddBuildExecution(be *entity.BuildExecution) error {
 	result := ds.db.Create(be)
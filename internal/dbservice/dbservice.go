@@ -3,6 +3,7 @@ package dbservice
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/configuration"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
@@ -27,9 +28,39 @@ type IDBService interface {
 	GetNewestBuildExecutions(limit int, query string, args ...any) ([]entity.BuildExecution, error)
 	GetBuildExecutionById(id int) (entity.BuildExecution, error)
 	FindBuildExecutions(query any, args ...any) ([]entity.BuildExecution, error)
+	GetBuildExecutionBranches() ([]string, error)
 	AddBuildExecution(be *entity.BuildExecution) error
 	UpdateBuildExecution(be *entity.BuildExecution) error
 
+	GetNewestWebhookDeliveries(limit int, bdID uint) ([]entity.WebhookDelivery, error)
+	GetWebhookDeliveryById(id uint) (entity.WebhookDelivery, error)
+	AddWebhookDelivery(d *entity.WebhookDelivery) error
+	PruneWebhookDeliveries(bdID uint, keep int) error
+
+	GetPollStates(bdID uint) ([]entity.PollState, error)
+	SavePollState(state *entity.PollState) error
+	DeletePollState(state *entity.PollState) error
+
+	GetDeployKey(bdID uint) (entity.DeployKey, error)
+	SaveDeployKey(key *entity.DeployKey) error
+	DeleteDeployKey(bdID uint) error
+
+	GetEnvironmentApprovers(bdID uint) ([]entity.EnvironmentApprover, error)
+	SaveEnvironmentApprovers(bdID uint, approvers []entity.EnvironmentApprover) error
+
+	GetAllKnownHosts() ([]entity.KnownHost, error)
+	GetKnownHostsByHost(host string) ([]entity.KnownHost, error)
+	AddKnownHost(kh *entity.KnownHost) error
+	DeleteKnownHost(id uint) error
+
+	GetDeploymentsByBuildExecution(beID uint) ([]entity.Deployment, error)
+	GetDeploymentsByBuildDefinition(bdID uint, limit int) ([]entity.Deployment, error)
+	GetDeploymentById(id uint) (entity.Deployment, error)
+	AddDeployment(d *entity.Deployment) error
+	UpdateDeployment(d *entity.Deployment) error
+	TransitionDeployment(d *entity.Deployment, from entity.BuildStatus) (bool, error)
+	ExpireDeployments(now time.Time) error
+
 	GetAllSettings() (map[string]string, error)
 	SetSetting(name, value string) error
 
@@ -49,6 +80,9 @@ type IDBService interface {
 	UpdateUserAction(userAction entity.UserAction) error
 
 	GetAvailableVariablesForUser(userId uint) ([]entity.UserVariable, error)
+	GetGlobalVariables() ([]entity.UserVariable, error)
+	GetVariablesForBuildDefinition(bdId uint) ([]entity.UserVariable, error)
+	FindVariables(cond string, args ...any) ([]entity.UserVariable, error)
 	AddVariable(userVar entity.UserVariable) (uint, error)
 	GetVariable(id int) (entity.UserVariable, error)
 	FindVariable(cond string, args ...any) (entity.UserVariable, error)
@@ -57,7 +91,8 @@ type IDBService interface {
 }
 
 type DBService struct {
-	db *gorm.DB
+	db        *gorm.DB
+	masterKey string
 }
 
 func New(cfg *configuration.AppConfig) IDBService {
@@ -79,20 +114,30 @@ func New(cfg *configuration.AppConfig) IDBService {
 
 	conn.SetMaxIdleConns(10)
 	conn.SetMaxOpenConns(50)
-	return &DBService{db: db}
+	return &DBService{db: db, masterKey: cfg.Security.MasterKey}
 }
 
 // AutoMigrate makes sure the database tables exist, corresponding
-// to the supplied structs
+// to the supplied structs, and migrates the webhook secrets
 func (ds *DBService) AutoMigrate() error {
-	return ds.db.AutoMigrate(
+	err := ds.db.AutoMigrate(
 		&entity.AdminSetting{},
 		&entity.BuildDefinition{},
 		&entity.BuildExecution{},
 		&entity.User{},
 		&entity.UserAction{},
 		&entity.UserVariable{},
+		&entity.WebhookDelivery{},
+		&entity.PollState{},
+		&entity.DeployKey{},
+		&entity.KnownHost{},
+		&entity.Deployment{},
+		&entity.EnvironmentApprover{},
 	)
+	if err != nil {
+		return err
+	}
+	return ds.migrateWebhookSecrets()
 }
 
 // Quit ends the database connection
@@ -2,6 +2,7 @@ package dbservice
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
 	"gorm.io/gorm"
@@ -31,8 +32,9 @@ func (m *DBServiceMock) FindBuildDefinition(cond string, args ...any) (entity.Bu
 		Model: gorm.Model{
 			ID: 1,
 		},
-		Token:     "abc123",
-		CreatedBy: 1,
+		Token:         "abc123",
+		WebhookSecret: "webhooksecret",
+		CreatedBy:     1,
 
 		Raw: `project_type:
 repository:
@@ -96,6 +98,9 @@ func (m *DBServiceMock) GetBuildExecutionById(id int) (entity.BuildExecution, er
 func (m *DBServiceMock) FindBuildExecutions(query any, args ...any) ([]entity.BuildExecution, error) {
 	return []entity.BuildExecution{}, nil
 }
+func (m *DBServiceMock) GetBuildExecutionBranches() ([]string, error) {
+	return []string{}, nil
+}
 func (m *DBServiceMock) AddBuildExecution(be *entity.BuildExecution) error {
 	return nil
 }
@@ -103,6 +108,80 @@ func (m *DBServiceMock) UpdateBuildExecution(be *entity.BuildExecution) error {
 	return nil
 }
 
+func (m *DBServiceMock) GetNewestWebhookDeliveries(limit int, bdID uint) ([]entity.WebhookDelivery, error) {
+	return []entity.WebhookDelivery{}, nil
+}
+func (m *DBServiceMock) GetWebhookDeliveryById(id uint) (entity.WebhookDelivery, error) {
+	return entity.WebhookDelivery{}, nil
+}
+func (m *DBServiceMock) AddWebhookDelivery(d *entity.WebhookDelivery) error {
+	return nil
+}
+func (m *DBServiceMock) PruneWebhookDeliveries(bdID uint, keep int) error {
+	return nil
+}
+
+func (m *DBServiceMock) GetPollStates(bdID uint) ([]entity.PollState, error) {
+	return []entity.PollState{}, nil
+}
+func (m *DBServiceMock) SavePollState(state *entity.PollState) error {
+	return nil
+}
+func (m *DBServiceMock) DeletePollState(state *entity.PollState) error {
+	return nil
+}
+
+func (m *DBServiceMock) GetDeployKey(bdID uint) (entity.DeployKey, error) {
+	return entity.DeployKey{}, nil
+}
+func (m *DBServiceMock) SaveDeployKey(key *entity.DeployKey) error {
+	return nil
+}
+func (m *DBServiceMock) DeleteDeployKey(bdID uint) error {
+	return nil
+}
+
+func (m *DBServiceMock) GetAllKnownHosts() ([]entity.KnownHost, error) {
+	return []entity.KnownHost{}, nil
+}
+func (m *DBServiceMock) GetEnvironmentApprovers(bdID uint) ([]entity.EnvironmentApprover, error) {
+	return []entity.EnvironmentApprover{}, nil
+}
+func (m *DBServiceMock) SaveEnvironmentApprovers(bdID uint, approvers []entity.EnvironmentApprover) error {
+	return nil
+}
+func (m *DBServiceMock) GetKnownHostsByHost(host string) ([]entity.KnownHost, error) {
+	return []entity.KnownHost{}, nil
+}
+func (m *DBServiceMock) AddKnownHost(kh *entity.KnownHost) error {
+	return nil
+}
+func (m *DBServiceMock) DeleteKnownHost(id uint) error {
+	return nil
+}
+
+func (m *DBServiceMock) GetDeploymentsByBuildExecution(beID uint) ([]entity.Deployment, error) {
+	return []entity.Deployment{}, nil
+}
+func (m *DBServiceMock) GetDeploymentsByBuildDefinition(bdID uint, limit int) ([]entity.Deployment, error) {
+	return []entity.Deployment{}, nil
+}
+func (m *DBServiceMock) GetDeploymentById(id uint) (entity.Deployment, error) {
+	return entity.Deployment{}, nil
+}
+func (m *DBServiceMock) AddDeployment(d *entity.Deployment) error {
+	return nil
+}
+func (m *DBServiceMock) UpdateDeployment(d *entity.Deployment) error {
+	return nil
+}
+func (m *DBServiceMock) TransitionDeployment(d *entity.Deployment, from entity.BuildStatus) (bool, error) {
+	return true, nil
+}
+func (m *DBServiceMock) ExpireDeployments(now time.Time) error {
+	return nil
+}
+
 func (m *DBServiceMock) GetAllSettings() (map[string]string, error) {
 	return map[string]string{}, nil
 }
@@ -154,6 +233,15 @@ func (m *DBServiceMock) UpdateUserAction(userAction entity.UserAction) error {
 func (m *DBServiceMock) GetAvailableVariablesForUser(userId uint) ([]entity.UserVariable, error) {
 	return []entity.UserVariable{}, nil
 }
+func (m *DBServiceMock) GetGlobalVariables() ([]entity.UserVariable, error) {
+	return []entity.UserVariable{}, nil
+}
+func (m *DBServiceMock) GetVariablesForBuildDefinition(bdId uint) ([]entity.UserVariable, error) {
+	return []entity.UserVariable{}, nil
+}
+func (m *DBServiceMock) FindVariables(cond string, args ...any) ([]entity.UserVariable, error) {
+	return []entity.UserVariable{}, nil
+}
 func (m *DBServiceMock) AddVariable(userVar entity.UserVariable) (uint, error) {
 	return 0, nil
 }
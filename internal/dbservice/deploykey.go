@@ -0,0 +1,53 @@
+package dbservice
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/encryption"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// GetDeployKey fetches the deploy key of a build definition, with the private key decrypted
+func (ds *DBService) GetDeployKey(bdID uint) (entity.DeployKey, error) {
+	var key entity.DeployKey
+	result := ds.db.Where("build_definition_id = ?", bdID).First(&key)
+	if result.Error != nil {
+		return entity.DeployKey{}, result.Error
+	}
+	dec, err := encryption.Decrypt(ds.masterKey, key.PrivateKey)
+	if err != nil {
+		return entity.DeployKey{}, fmt.Errorf("could not decrypt deploy key: %s", err.Error())
+	}
+	key.PrivateKey = dec
+	return key, nil
+}
+
+// SaveDeployKey stores the deploy key of a build definition, replacing an existing one;
+// the private key is stored encrypted
+func (ds *DBService) SaveDeployKey(key *entity.DeployKey) error {
+	stored := *key
+	enc, err := encryption.Encrypt(ds.masterKey, key.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("could not encrypt deploy key: %s", err.Error())
+	}
+	stored.PrivateKey = enc
+
+	err = ds.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("build_definition_id = ?", key.BuildDefinitionID).Delete(&entity.DeployKey{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&stored).Error
+	})
+	if err != nil {
+		return err
+	}
+	key.Model = stored.Model
+	return nil
+}
+
+// DeleteDeployKey removes the deploy key of a build definition, if there is one
+func (ds *DBService) DeleteDeployKey(bdID uint) error {
+	return ds.db.Unscoped().Where("build_definition_id = ?", bdID).Delete(&entity.DeployKey{}).Error
+}
@@ -0,0 +1,65 @@
+package dbservice
+
+import (
+	"time"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// GetDeploymentsByBuildExecution fetches all deployments of a build execution, oldest first
+func (ds *DBService) GetDeploymentsByBuildExecution(beID uint) ([]entity.Deployment, error) {
+	deployments := make([]entity.Deployment, 0)
+	result := ds.db.Where("build_execution_id = ?", beID).Order("id asc").Find(&deployments)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return deployments, nil
+}
+
+// GetDeploymentsByBuildDefinition fetches the newest deployments of all executions of a build definition,
+// newest first. The logs are not loaded.
+func (ds *DBService) GetDeploymentsByBuildDefinition(bdID uint, limit int) ([]entity.Deployment, error) {
+	deployments := make([]entity.Deployment, 0)
+	query := ds.db.Omit("log").Where("build_definition_id = ?", bdID).Order("id desc")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if result := query.Find(&deployments); result.Error != nil {
+		return nil, result.Error
+	}
+	return deployments, nil
+}
+
+// GetDeploymentById fetches a specific deployment by id
+func (ds *DBService) GetDeploymentById(id uint) (entity.Deployment, error) {
+	var d entity.Deployment
+	result := ds.db.First(&d, id)
+	if result.Error != nil {
+		return entity.Deployment{}, result.Error
+	}
+	return d, nil
+}
+
+// AddDeployment adds a new deployment
+func (ds *DBService) AddDeployment(d *entity.Deployment) error {
+	return ds.db.Create(d).Error
+}
+
+// UpdateDeployment saves the changes of a deployment
+func (ds *DBService) UpdateDeployment(d *entity.Deployment) error {
+	return ds.db.Save(d).Error
+}
+
+// TransitionDeployment saves the changes of a deployment, if its stored status still is from.
+// It reports whether the deployment was saved, so concurrent decisions cannot both succeed.
+func (ds *DBService) TransitionDeployment(d *entity.Deployment, from entity.BuildStatus) (bool, error) {
+	result := ds.db.Model(d).Where("status = ?", from).Select("*").Updates(d)
+	return result.RowsAffected == 1, result.Error
+}
+
+// ExpireDeployments marks all deployments still awaiting approval after their expiry as expired
+func (ds *DBService) ExpireDeployments(now time.Time) error {
+	return ds.db.Model(&entity.Deployment{}).
+		Where("status = ? AND expires_at < ?", entity.StatusAwaitingApproval, now).
+		Updates(map[string]any{"status": entity.StatusExpired, "finished_at": now}).Error
+}
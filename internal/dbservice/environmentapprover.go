@@ -0,0 +1,33 @@
+package dbservice
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// GetEnvironmentApprovers fetches the resolved approvers of all environments of a build definition
+func (ds *DBService) GetEnvironmentApprovers(bdID uint) ([]entity.EnvironmentApprover, error) {
+	approvers := make([]entity.EnvironmentApprover, 0)
+	result := ds.db.Where("build_definition_id = ?", bdID).Find(&approvers)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return approvers, nil
+}
+
+// SaveEnvironmentApprovers replaces the resolved approvers of a build definition
+func (ds *DBService) SaveEnvironmentApprovers(bdID uint, approvers []entity.EnvironmentApprover) error {
+	return ds.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("build_definition_id = ?", bdID).Delete(&entity.EnvironmentApprover{}).Error; err != nil {
+			return err
+		}
+		for i := range approvers {
+			approvers[i].BuildDefinitionID = bdID
+			if err := tx.Create(&approvers[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
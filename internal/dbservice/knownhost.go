@@ -0,0 +1,35 @@
+package dbservice
+
+import (
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// GetAllKnownHosts fetches all known host keys, ordered by host
+func (ds *DBService) GetAllKnownHosts() ([]entity.KnownHost, error) {
+	hosts := make([]entity.KnownHost, 0)
+	result := ds.db.Order("host asc, id asc").Find(&hosts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return hosts, nil
+}
+
+// GetKnownHostsByHost fetches the known keys of a single host, given as normalized address
+func (ds *DBService) GetKnownHostsByHost(host string) ([]entity.KnownHost, error) {
+	hosts := make([]entity.KnownHost, 0)
+	result := ds.db.Where("host = ?", host).Find(&hosts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return hosts, nil
+}
+
+// AddKnownHost adds a new known host key
+func (ds *DBService) AddKnownHost(kh *entity.KnownHost) error {
+	return ds.db.Create(kh).Error
+}
+
+// DeleteKnownHost removes a known host key, so the host is unknown again
+func (ds *DBService) DeleteKnownHost(id uint) error {
+	return ds.db.Unscoped().Delete(&entity.KnownHost{}, id).Error
+}
@@ -0,0 +1,25 @@
+package dbservice
+
+import (
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// GetPollStates fetches the poll states of all refs of a build definition
+func (ds *DBService) GetPollStates(bdID uint) ([]entity.PollState, error) {
+	states := make([]entity.PollState, 0)
+	result := ds.db.Where("build_definition_id = ?", bdID).Find(&states)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return states, nil
+}
+
+// SavePollState adds or updates a poll state
+func (ds *DBService) SavePollState(state *entity.PollState) error {
+	return ds.db.Save(state).Error
+}
+
+// DeletePollState removes a poll state, e.g. if the ref was deleted
+func (ds *DBService) DeletePollState(state *entity.PollState) error {
+	return ds.db.Unscoped().Delete(state).Error
+}
@@ -2,21 +2,49 @@ package dbservice
 
 import (
 	"fmt"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/encryption"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
 )
 
-// GetAvailableVariablesForUser determines all available variables for a user by the given Id
+// GetAvailableVariablesForUser determines all user scoped variables available for a user by the given Id,
+// that is the user's own variables and public variables of other users
 func (ds *DBService) GetAvailableVariablesForUser(userId uint) ([]entity.UserVariable, error) {
+	return ds.FindVariables("scope = ? AND (user_entry_id = ? OR public = 1)", entity.VariableScopeUser, userId)
+}
+
+// GetGlobalVariables fetches all variables managed by administrators
+func (ds *DBService) GetGlobalVariables() ([]entity.UserVariable, error) {
+	return ds.FindVariables("scope = ?", entity.VariableScopeGlobal)
+}
+
+// GetVariablesForBuildDefinition fetches all variables attached to the build definition by the given Id
+func (ds *DBService) GetVariablesForBuildDefinition(bdId uint) ([]entity.UserVariable, error) {
+	return ds.FindVariables("scope = ? AND build_definition_id = ?", entity.VariableScopeDefinition, bdId)
+}
+
+// FindVariables looks for all variables matching the given condition
+func (ds *DBService) FindVariables(cond string, args ...interface{}) ([]entity.UserVariable, error) {
 	variables := make([]entity.UserVariable, 0)
-	result := ds.db.Find(&variables).Where("user_entry_id = ? OR public = 1", userId)
+	result := ds.db.Where(cond, args...).Order("variable asc").Find(&variables)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
+	for i := range variables {
+		if err := ds.decryptVariable(&variables[i]); err != nil {
+			return nil, err
+		}
+	}
+
 	return variables, nil
 }
 
+// AddVariable adds a new variable; the values of secret variables are stored encrypted
 func (ds *DBService) AddVariable(userVar entity.UserVariable) (uint, error) {
+	if err := ds.encryptVariable(&userVar); err != nil {
+		return 0, err
+	}
 	result := ds.db.Create(&userVar)
 	if result.Error != nil {
 		return 0, result.Error
@@ -25,6 +53,7 @@ func (ds *DBService) AddVariable(userVar entity.UserVariable) (uint, error) {
 	return userVar.ID, nil
 }
 
+// GetVariable fetches a variable by Id
 func (ds *DBService) GetVariable(id int) (entity.UserVariable, error) {
 	var uv entity.UserVariable
 	result := ds.db.First(&uv, id)
@@ -32,9 +61,14 @@ func (ds *DBService) GetVariable(id int) (entity.UserVariable, error) {
 		return uv, result.Error
 	}
 
+	if err := ds.decryptVariable(&uv); err != nil {
+		return entity.UserVariable{}, err
+	}
+
 	return uv, nil
 }
 
+// FindVariable looks for a specific variable
 func (ds *DBService) FindVariable(cond string, args ...interface{}) (entity.UserVariable, error) {
 	var userVar entity.UserVariable
 	result := ds.db.Where(cond, args...).Find(&userVar)
@@ -46,10 +80,18 @@ func (ds *DBService) FindVariable(cond string, args ...interface{}) (entity.User
 		return entity.UserVariable{}, fmt.Errorf("no variable found")
 	}
 
+	if err := ds.decryptVariable(&userVar); err != nil {
+		return entity.UserVariable{}, err
+	}
+
 	return userVar, nil
 }
 
+// UpdateVariable updates an existing variable; the values of secret variables are stored encrypted
 func (ds *DBService) UpdateVariable(userVar entity.UserVariable) error {
+	if err := ds.encryptVariable(&userVar); err != nil {
+		return err
+	}
 	result := ds.db.Save(&userVar)
 	if result.Error != nil {
 		return result.Error
@@ -58,6 +100,7 @@ func (ds *DBService) UpdateVariable(userVar entity.UserVariable) error {
 	return nil
 }
 
+// DeleteVariable removes a variable
 func (ds *DBService) DeleteVariable(id uint) error {
 	result := ds.db.Delete(&entity.UserVariable{}, id)
 	if result.Error != nil {
@@ -65,3 +108,27 @@ func (ds *DBService) DeleteVariable(id uint) error {
 	}
 	return nil
 }
+
+func (ds *DBService) encryptVariable(uv *entity.UserVariable) error {
+	if !uv.Secret || encryption.IsEncrypted(uv.Value) {
+		return nil
+	}
+	enc, err := encryption.Encrypt(ds.masterKey, uv.Value)
+	if err != nil {
+		return fmt.Errorf("could not encrypt secret variable '%s': %s", uv.Variable, err.Error())
+	}
+	uv.Value = enc
+	return nil
+}
+
+func (ds *DBService) decryptVariable(uv *entity.UserVariable) error {
+	if !uv.Secret {
+		return nil
+	}
+	dec, err := encryption.Decrypt(ds.masterKey, uv.Value)
+	if err != nil {
+		return fmt.Errorf("could not decrypt secret variable '%s': %s", uv.Variable, err.Error())
+	}
+	uv.Value = dec
+	return nil
+}
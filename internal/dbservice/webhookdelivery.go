@@ -0,0 +1,51 @@
+package dbservice
+
+import (
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// GetNewestWebhookDeliveries fetches the newest webhook deliveries, optionally filtered by
+// build definition, if the id is greater than 0. The bodies are not loaded.
+func (ds *DBService) GetNewestWebhookDeliveries(limit int, bdID uint) ([]entity.WebhookDelivery, error) {
+	deliveries := make([]entity.WebhookDelivery, 0)
+	query := ds.db.Omit("body", "headers").Order("id desc")
+	if bdID > 0 {
+		query = query.Where("build_definition_id = ?", bdID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if result := query.Find(&deliveries); result.Error != nil {
+		return nil, result.Error
+	}
+	return deliveries, nil
+}
+
+// GetWebhookDeliveryById fetches a specific webhook delivery by id
+func (ds *DBService) GetWebhookDeliveryById(id uint) (entity.WebhookDelivery, error) {
+	var d entity.WebhookDelivery
+	result := ds.db.First(&d, id)
+	if result.Error != nil {
+		return entity.WebhookDelivery{}, result.Error
+	}
+	return d, nil
+}
+
+// AddWebhookDelivery adds a new webhook delivery
+func (ds *DBService) AddWebhookDelivery(d *entity.WebhookDelivery) error {
+	return ds.db.Create(d).Error
+}
+
+// PruneWebhookDeliveries removes all but the newest keep deliveries of a build definition
+func (ds *DBService) PruneWebhookDeliveries(bdID uint, keep int) error {
+	var ids []uint
+	result := ds.db.Model(&entity.WebhookDelivery{}).Where("build_definition_id = ?", bdID).
+		Order("id desc").Offset(keep).Limit(1).Pluck("id", &ids)
+	if result.Error != nil {
+		return result.Error
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return ds.db.Unscoped().Where("build_definition_id = ? AND id <= ?", bdID, ids[0]).Delete(&entity.WebhookDelivery{}).Error
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
+	"io/fs"
 	"net"
-	"os"
-	"path/filepath"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
@@ -26,15 +28,22 @@ var (
 
 type DeploymentService struct {
 	Mailer *mailer.Mailer
+	// KnownHosts are the trusted host keys remote deployments are verified against
+	KnownHosts KnownHostStore
+	// HTTPClient sends the requests of HTTP deployments, http.DefaultClient if nil
+	HTTPClient *http.Client
 }
 
 type IDeploymentService interface {
 	DoLocalDeployment(ctx context.Context, deployment *entity.LocalDeployment, build *builder.Build) error
 	DoEmailDeployment(ctx context.Context, deployment *entity.EmailDeployment, repoName string, build *builder.Build) error
 	DoRemoteDeployment(ctx context.Context, deployment *entity.RemoteDeployment, build *builder.Build) error
+	RollbackRemoteDeployment(ctx context.Context, deployment *entity.RemoteDeployment, release string, report func(string)) error
+	DoHTTPDeployment(ctx context.Context, deployment *entity.HTTPDeployment, build *builder.Build) error
+	DoS3Deployment(ctx context.Context, deployment *entity.S3Deployment, build *builder.Build) error
 }
 
-func (dpl *DeploymentService) DoLocalDeployment(ctx context.Context, deployment *entity.LocalDeployment, build *builder.Build) error {
+func (dpl *DeploymentService) DoEmailDeployment(ctx context.Context, deployment *entity.EmailDeployment, repoName string, build *builder.Build) error {
 	if !deployment.Enabled {
 		return ErrDisabled
 	}
@@ -42,35 +51,16 @@ func (dpl *DeploymentService) DoLocalDeployment(ctx context.Context, deployment
 		return ErrCanceled
 	}
 
-	fileBytes, err := ioutil.ReadFile(build.GetArtifact())
-	if err != nil {
-		return fmt.Errorf("could not read artifact file '%s': %s", build.GetArtifact(), err.Error())
-	}
-
-	if err := os.MkdirAll(filepath.Dir(deployment.Path), 0744); err != nil {
-		return err
-	}
-
-	if err = os.WriteFile(deployment.Path, fileBytes, 0744); err != nil {
-		return fmt.Errorf("could not write artifact (%s) to target (%s): %s", build.GetArtifact(), deployment.Path, err.Error())
-	}
-
-	return nil
-}
-
-func (dpl *DeploymentService) DoEmailDeployment(ctx context.Context, deployment *entity.EmailDeployment, repoName string, build *builder.Build) error {
-	if !deployment.Enabled {
-		return ErrDisabled
-	}
-	if ctx.Err() != nil {
-		return ErrCanceled
+	version := build.GetVersion()
+	if version == "" {
+		version = "n/a"
 	}
 
 	data := struct {
 		Version string
 		Title   string
 	}{
-		Version: "n/a", // TODO
+		Version: version,
 		Title:   repoName,
 	}
 
@@ -91,6 +81,9 @@ func (dpl *DeploymentService) DoEmailDeployment(ctx context.Context, deployment
 	return nil
 }
 
+// DoRemoteDeployment uploads the build directory into a new release directory below the working
+// directory of the remote host and switches the current symlink to it afterwards. Only the newest
+// releases are kept. FTP and FTPS deployments upload into the working directory itself.
 func (dpl *DeploymentService) DoRemoteDeployment(ctx context.Context, deployment *entity.RemoteDeployment, build *builder.Build) error {
 	if !deployment.Enabled {
 		return ErrDisabled
@@ -98,101 +91,154 @@ func (dpl *DeploymentService) DoRemoteDeployment(ctx context.Context, deployment
 	if ctx.Err() != nil {
 		return ErrCanceled
 	}
+	if err := deployment.Validate(); err != nil {
+		return err
+	}
+	if deployment.GetConnectionType() != entity.ConnectionSFTP {
+		return dpl.doFTPDeployment(ctx, deployment, build)
+	}
 
-	// first, the pre deployment actions
-	sshConfig := &ssh.ClientConfig{
-		//HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		User: deployment.Username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(deployment.Password),
-		},
+	sshClient, err := dpl.dial(deployment, build.AddReportEntry)
+	if err != nil {
+		return err
 	}
-	sshConfig.HostKeyCallback = func(_ string, _ net.Addr, _ ssh.PublicKey) error {
-		return nil
+	defer sshClient.Close()
+
+	// first, the pre deployment actions
+	if err = runSteps(sshClient, deployment.PreDeploymentSteps); err != nil {
+		return err
 	}
 
-	sshClient, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", deployment.Host, deployment.Port), sshConfig)
+	// then, the actual deployment
+	sftpClient, err := sftp.NewClient(sshClient)
 	if err != nil {
 		return err
 	}
+	defer sftpClient.Close()
 
-	if len(deployment.PreDeploymentSteps) > 0 {
-		for _, action := range deployment.PreDeploymentSteps {
-			session, err := sshClient.NewSession()
-			if err != nil {
-				return err
-			}
-			if err = session.Run(action); err != nil {
-				return err
-			}
-			_ = session.Close()
-		}
+	release := build.GetRelease()
+	if release == "" {
+		release = ReleaseName(0, time.Now())
+	}
+	releaseDir := path.Join(deployment.WorkingDirectory, releasesDir, release)
+	if err = sftpClient.MkdirAll(path.Dir(releaseDir)); err != nil {
+		return fmt.Errorf("could not create directory '%s': %s", path.Dir(releaseDir), err.Error())
+	}
+	// a release directory left behind by an earlier attempt is replaced
+	_ = sftpClient.RemoveAll(releaseDir)
+	if err = uploadDir(sftpClient, build.GetBuildDir(), releaseDir); err != nil {
+		_ = sftpClient.RemoveAll(releaseDir)
+		return err
 	}
 
-	srcDir := build.GetBuildDir()
-	targetDir := deployment.WorkingDirectory
-	elements, err := os.ReadDir(srcDir)
+	atomic, err := switchRelease(sftpClient, deployment.WorkingDirectory, release)
 	if err != nil {
 		return err
 	}
+	if !atomic {
+		build.AddReportEntryf("%s does not support atomic renames; switched release non-atomically", deployment.Host)
+	}
+	build.AddReportEntry(fmt.Sprintf("deployed release %s to %s", release, deployment.Host))
 
-	session, err := sshClient.NewSession()
+	removed, err := pruneReleases(sftpClient, deployment.WorkingDirectory, deployment.GetKeepReleases())
+	if len(removed) > 0 {
+		build.AddReportEntry(fmt.Sprintf("removed old releases from %s: %s", deployment.Host, strings.Join(removed, ", ")))
+	}
+	if err != nil {
+		build.AddReportEntry(fmt.Sprintf("could not remove old releases from %s: %s", deployment.Host, err.Error()))
+	}
+
+	// then, the post deployment actions
+	return runSteps(sshClient, deployment.PostDeploymentSteps)
+}
+
+// RollbackRemoteDeployment switches the current symlink of the remote host back to an earlier release,
+// which has to be still present. The pre and post deployment steps run as for a deployment.
+func (dpl *DeploymentService) RollbackRemoteDeployment(ctx context.Context, deployment *entity.RemoteDeployment, release string, report func(string)) error {
+	if !deployment.Enabled {
+		return ErrDisabled
+	}
+	if ctx.Err() != nil {
+		return ErrCanceled
+	}
+	if !deployment.SupportsReleases() {
+		return ErrReleasesUnsupported
+	}
+	if !isReleaseName(release) {
+		return ErrReleaseNotFound
+	}
+
+	sshClient, err := dpl.dial(deployment, report)
 	if err != nil {
 		return err
 	}
+	defer sshClient.Close()
 
-	// then, the actual deployment
 	sftpClient, err := sftp.NewClient(sshClient)
 	if err != nil {
 		return err
 	}
+	defer sftpClient.Close()
 
-	for _, elem := range elements {
-		if elem.IsDir() {
-			if err = sftpClient.MkdirAll(targetDir + "/" + elem.Name()); err != nil {
-				build.AddReportEntryf("failed to create directory '%s': %s", elem, err.Error())
-			}
-			continue
-		}
-		// create destination file
-		dstFile, err := sftpClient.Create(targetDir + "/" + elem.Name())
-		if err != nil {
-			return err
+	// make sure the release exists before anything is stopped
+	if _, err = sftpClient.Stat(path.Join(deployment.WorkingDirectory, releasesDir, release)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrReleaseNotFound
 		}
+		return err
+	}
+
+	if err = runSteps(sshClient, deployment.PreDeploymentSteps); err != nil {
+		return err
+	}
+	atomic, err := switchRelease(sftpClient, deployment.WorkingDirectory, release)
+	if err != nil {
+		return err
+	}
+	if !atomic {
+		report(fmt.Sprintf("%s does not support atomic renames; switched release non-atomically", deployment.Host))
+	}
+	report(fmt.Sprintf("rolled back %s to release %s", deployment.Host, release))
 
-		// create source file
-		srcFile, err := os.Open(filepath.Join(srcDir, elem.Name()))
+	return runSteps(sshClient, deployment.PostDeploymentSteps)
+}
+
+// dial connects to the remote host of the deployment, verifying its host key
+func (dpl *DeploymentService) dial(deployment *entity.RemoteDeployment, report func(string)) (*ssh.Client, error) {
+	address := net.JoinHostPort(deployment.Host, strconv.Itoa(deployment.GetPort()))
+
+	auth, closeAgent, err := authMethods(deployment)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+	algorithms, err := hostKeyAlgorithms(dpl.KnownHosts, address)
+	if err != nil {
+		return nil, err
+	}
+
+	sshConfig := &ssh.ClientConfig{
+		User:              deployment.Username,
+		Auth:              auth,
+		HostKeyCallback:   hostKeyCallback(dpl.KnownHosts, deployment, report),
+		HostKeyAlgorithms: algorithms,
+	}
+
+	return ssh.Dial("tcp", address, sshConfig)
+}
+
+// runSteps runs the given commands on the remote host, one session each
+func runSteps(client *ssh.Client, steps []string) error {
+	for _, action := range steps {
+		session, err := client.NewSession()
 		if err != nil {
 			return err
 		}
-
-		// copy source file to destination file
-		_, err = io.Copy(dstFile, srcFile)
+		err = session.Run(action)
+		_ = session.Close()
 		if err != nil {
 			return err
 		}
-		_ = dstFile.Close()
-		_ = srcFile.Close()
-	}
-
-	_ = session.Close()
-
-	// then, the post deployment actions
-	if len(deployment.PostDeploymentSteps) > 0 {
-		for _, action := range deployment.PostDeploymentSteps {
-			session, err := sshClient.NewSession()
-			if err != nil {
-				return err
-			}
-			if err = session.Run(action); err != nil {
-				return err
-			}
-			_ = session.Close()
-		}
 	}
-
-	_ = sftpClient.Close()
-	_ = sshClient.Close()
-
 	return nil
 }
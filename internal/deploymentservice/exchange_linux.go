@@ -0,0 +1,18 @@
+//go:build linux
+
+package deploymentservice
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// exchangeDirs atomically exchanges the directories a and b
+func exchangeDirs(a, b string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, a, unix.AT_FDCWD, b, unix.RENAME_EXCHANGE)
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) {
+		return errExchangeUnsupported
+	}
+	return err
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package deploymentservice
+
+// exchangeDirs atomically exchanges the directories a and b
+func exchangeDirs(a, b string) error {
+	return errExchangeUnsupported
+}
@@ -0,0 +1,217 @@
+package deploymentservice
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/builder"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+const (
+	ftpDialTimeout = 30 * time.Second
+	// ftpUploadSuffix is appended to the names of files while they are uploaded
+	ftpUploadSuffix = ".tbs-upload"
+)
+
+// ftpConn is the part of an FTP connection used for deployments
+type ftpConn interface {
+	CurrentDir() (string, error)
+	ChangeDir(path string) error
+	MakeDir(path string) error
+	Stor(path string, r io.Reader) error
+	Rename(from, to string) error
+	Delete(path string) error
+}
+
+// doFTPDeployment uploads the build directory into the working directory of the remote host
+// using FTP or FTPS. The working directory is created if necessary.
+func (dpl *DeploymentService) doFTPDeployment(ctx context.Context, deployment *entity.RemoteDeployment, build *builder.Build) error {
+	conn, err := dialFTP(ctx, deployment)
+	if err != nil {
+		return err
+	}
+	defer conn.Quit()
+
+	workingDir, err := absFTPPath(conn, deployment.WorkingDirectory)
+	if err != nil {
+		return err
+	}
+	if err = makeFTPDirAll(conn, workingDir); err != nil {
+		return err
+	}
+	if err = uploadDirFTP(conn, build.GetBuildDir(), workingDir); err != nil {
+		return err
+	}
+	build.AddReportEntry(fmt.Sprintf("uploaded build directory to %s", deployment.Describe()))
+
+	return nil
+}
+
+// dialFTP connects and logs in to the remote host of the deployment. Data connections are always
+// passive. FTPS connections switch to TLS before logging in.
+func dialFTP(ctx context.Context, deployment *entity.RemoteDeployment) (*ftp.ServerConn, error) {
+	options := []ftp.DialOption{
+		ftp.DialWithContext(ctx),
+		ftp.DialWithTimeout(ftpDialTimeout),
+		ftp.DialWithDisabledEPSV(deployment.DisableEPSV),
+	}
+	if deployment.GetConnectionType() == entity.ConnectionFTPS {
+		tlsConfig, err := ftpTLSConfig(deployment)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, ftp.DialWithExplicitTLS(tlsConfig))
+	}
+
+	address := net.JoinHostPort(deployment.Host, strconv.Itoa(deployment.GetPort()))
+	conn, err := ftp.Dial(address, options...)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", address, err)
+	}
+
+	username := deployment.Username
+	if username == "" {
+		username = "anonymous"
+	}
+	if err = conn.Login(username, deployment.Password); err != nil {
+		_ = conn.Quit()
+		return nil, fmt.Errorf("could not log in to %s: %w", address, err)
+	}
+	return conn, nil
+}
+
+// ftpTLSConfig returns the TLS configuration of an FTPS deployment
+func ftpTLSConfig(deployment *entity.RemoteDeployment) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         deployment.Host,
+		InsecureSkipVerify: deployment.TLSSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if deployment.TLSCAFile != "" {
+		pem, err := os.ReadFile(deployment.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file '%s': %w", deployment.TLSCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file '%s' does not contain any PEM encoded certificate", deployment.TLSCAFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// absFTPPath resolves a path relative to the directory the connection started in, so
+// changing the directory later does not change the meaning of the path
+func absFTPPath(conn ftpConn, p string) (string, error) {
+	if path.IsAbs(p) {
+		return path.Clean(p), nil
+	}
+	dir, err := conn.CurrentDir()
+	if err != nil {
+		return "", fmt.Errorf("could not determine current directory: %w", err)
+	}
+	return path.Join(dir, p), nil
+}
+
+// makeFTPDirAll creates the absolute directory dir and all missing parents
+func makeFTPDirAll(conn ftpConn, dir string) error {
+	current := "/"
+	for _, name := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		current = path.Join(current, name)
+		if err := makeFTPDir(conn, current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeFTPDir creates the directory dir unless it exists already
+func makeFTPDir(conn ftpConn, dir string) error {
+	err := conn.MakeDir(dir)
+	if err == nil {
+		return nil
+	}
+	// FTP servers do not report reliably why a directory could not be created
+	if conn.ChangeDir(dir) == nil {
+		return nil
+	}
+	return fmt.Errorf("could not create directory '%s': %w", dir, err)
+}
+
+// uploadDirFTP recursively copies the local directory src into the remote directory dst, replacing
+// existing files. FTP knows neither file modes nor symbolic links, so linked files are uploaded
+// as copies and linked directories are skipped.
+func uploadDirFTP(conn ftpConn, src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := path.Join(dst, filepath.ToSlash(rel))
+
+		switch {
+		case d.IsDir():
+			return makeFTPDir(conn, target)
+		case d.Type()&fs.ModeSymlink != 0:
+			info, err := os.Stat(p)
+			if err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+		case !d.Type().IsRegular():
+			// sockets, devices and the like cannot be transferred
+			return nil
+		}
+
+		if err = uploadFileFTP(conn, p, target); err != nil {
+			return fmt.Errorf("could not upload file '%s': %w", target, err)
+		}
+		return nil
+	})
+}
+
+// uploadFileFTP uploads the file next to dst first and renames it afterwards,
+// so a file being uploaded is never served incomplete
+func uploadFileFTP(conn ftpConn, src, dst string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tmp := dst + ftpUploadSuffix
+	if err = conn.Stor(tmp, file); err != nil {
+		return err
+	}
+	if err = conn.Rename(tmp, dst); err == nil {
+		return nil
+	}
+	// some servers refuse to rename a file over an existing one
+	if conn.Delete(dst) == nil {
+		if err = conn.Rename(tmp, dst); err == nil {
+			return nil
+		}
+	}
+	_ = conn.Delete(tmp)
+	return err
+}
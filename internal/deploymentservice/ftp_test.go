@@ -0,0 +1,193 @@
+package deploymentservice
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// fakeFTP is an in-memory FTP server which, like many real ones, refuses to rename over existing files
+type fakeFTP struct {
+	cwd   string
+	dirs  map[string]bool
+	files map[string]string
+}
+
+func newFakeFTP(cwd string) *fakeFTP {
+	f := &fakeFTP{cwd: cwd, dirs: map[string]bool{"/": true}, files: make(map[string]string)}
+	_ = makeFTPDirAll(f, cwd)
+	f.cwd = cwd
+	return f
+}
+
+func (f *fakeFTP) CurrentDir() (string, error) { return f.cwd, nil }
+
+func (f *fakeFTP) ChangeDir(p string) error {
+	if !f.dirs[p] {
+		return errors.New("550 no such directory")
+	}
+	f.cwd = p
+	return nil
+}
+
+func (f *fakeFTP) MakeDir(p string) error {
+	if _, isFile := f.files[p]; isFile || f.dirs[p] || !f.dirs[path.Dir(p)] {
+		return errors.New("550 could not create directory")
+	}
+	f.dirs[p] = true
+	return nil
+}
+
+func (f *fakeFTP) Stor(p string, r io.Reader) error {
+	if !f.dirs[path.Dir(p)] {
+		return errors.New("553 no such directory")
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	f.files[p] = string(b)
+	return nil
+}
+
+func (f *fakeFTP) Rename(from, to string) error {
+	content, ok := f.files[from]
+	if !ok {
+		return errors.New("550 no such file")
+	}
+	if _, exists := f.files[to]; exists {
+		return errors.New("553 file exists")
+	}
+	delete(f.files, from)
+	f.files[to] = content
+	return nil
+}
+
+func (f *fakeFTP) Delete(p string) error {
+	if _, ok := f.files[p]; !ok {
+		return errors.New("550 no such file")
+	}
+	delete(f.files, p)
+	return nil
+}
+
+func TestUploadDirFTP(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "bin", "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "bin", "app"), []byte("binary"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "bin", "nested", "config.yml"), []byte("a: b"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bin/app", filepath.Join(src, "app")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bin", filepath.Join(src, "linked")); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := newFakeFTP("/home/deploy")
+	workingDir, err := absFTPPath(conn, "sites/myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workingDir != "/home/deploy/sites/myapp" {
+		t.Fatalf("expected the working directory to be relative to the home directory, got %s", workingDir)
+	}
+	if err = makeFTPDirAll(conn, workingDir); err != nil {
+		t.Fatal(err)
+	}
+	conn.files["/home/deploy/sites/myapp/bin/app"] = "old binary"
+
+	if err = uploadDirFTP(conn, src, workingDir); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"/home/deploy/sites/myapp/app":                   "binary",
+		"/home/deploy/sites/myapp/bin/app":               "binary",
+		"/home/deploy/sites/myapp/bin/nested/config.yml": "a: b",
+	}
+	if !reflect.DeepEqual(conn.files, want) {
+		t.Errorf("unexpected files %v", conn.files)
+	}
+	dirs := make([]string, 0, len(conn.dirs))
+	for d := range conn.dirs {
+		if strings.HasPrefix(d, workingDir) {
+			dirs = append(dirs, d)
+		}
+	}
+	sort.Strings(dirs)
+	if !reflect.DeepEqual(dirs, []string{workingDir, workingDir + "/bin", workingDir + "/bin/nested"}) {
+		t.Errorf("unexpected directories %v", dirs)
+	}
+}
+
+func TestMakeFTPDirAllFails(t *testing.T) {
+	conn := newFakeFTP("/")
+	conn.files["/srv"] = "a file"
+
+	err := makeFTPDirAll(conn, "/srv/myapp")
+	if err == nil || !strings.Contains(err.Error(), "could not create directory '/srv'") {
+		t.Errorf("expected the directory not to be created, got %v", err)
+	}
+}
+
+func TestDoRemoteDeploymentValidation(t *testing.T) {
+	dpl := &DeploymentService{}
+	tests := []struct {
+		name       string
+		deployment entity.RemoteDeployment
+		err        string
+	}{
+		{"unknown connection type", entity.RemoteDeployment{Enabled: true, ConnectionType: "scp"}, "unknown connection type 'scp'"},
+		{"ftp with steps", entity.RemoteDeployment{Enabled: true, ConnectionType: "ftp", PostDeploymentSteps: []string{"systemctl restart app"}}, "require connection type sftp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := dpl.DoRemoteDeployment(context.Background(), &tt.deployment, newArtifactBuild(t, "zipped"))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestRollbackRemoteDeploymentFTP(t *testing.T) {
+	dpl := &DeploymentService{}
+	deployment := &entity.RemoteDeployment{Enabled: true, ConnectionType: "FTPS"}
+	if err := dpl.RollbackRemoteDeployment(context.Background(), deployment, "20210101000000-1", func(string) {}); err != ErrReleasesUnsupported {
+		t.Errorf("expected ErrReleasesUnsupported, got %v", err)
+	}
+}
+
+func TestFTPTLSConfig(t *testing.T) {
+	deployment := &entity.RemoteDeployment{Host: "ftp.example.org", TLSSkipVerify: true}
+	config, err := ftpTLSConfig(deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ServerName != "ftp.example.org" || !config.InsecureSkipVerify || config.RootCAs != nil {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	deployment.TLSCAFile = filepath.Join(t.TempDir(), "ca.pem")
+	if err = os.WriteFile(deployment.TLSCAFile, []byte("no certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ftpTLSConfig(deployment); err == nil {
+		t.Error("expected a CA file without certificates to be refused")
+	}
+}
@@ -0,0 +1,173 @@
+package deploymentservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/builder"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// maxErrorBody is the number of bytes of an unexpected response which are added to the error
+const maxErrorBody = 512
+
+// statusError is returned for a response with an unexpected status code
+type statusError struct {
+	code int
+	body string
+}
+
+func (e statusError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("unexpected response status %d", e.code)
+	}
+	return fmt.Sprintf("unexpected response status %d: %s", e.code, e.body)
+}
+
+// DoHTTPDeployment sends the artifact to the URL of the deployment. Requests failing because
+// of the network, a server error or rate limiting are retried with an increasing backoff.
+func (dpl *DeploymentService) DoHTTPDeployment(ctx context.Context, deployment *entity.HTTPDeployment, build *builder.Build) error {
+	if !deployment.Enabled {
+		return ErrDisabled
+	}
+	if ctx.Err() != nil {
+		return ErrCanceled
+	}
+	if body := deployment.GetBody(); body != entity.HTTPBodyMultipart && body != entity.HTTPBodyRaw {
+		return fmt.Errorf("unknown body type '%s'", body)
+	}
+	if _, err := os.Stat(build.GetArtifact()); err != nil {
+		return fmt.Errorf("could not find artifact file '%s': %w", build.GetArtifact(), err)
+	}
+
+	attempts := deployment.Retries + 1
+	for attempt := 1; ; attempt++ {
+		err := dpl.sendArtifact(ctx, deployment, build.GetArtifact())
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ErrCanceled
+		}
+		if attempt >= attempts || !isRetryable(err) {
+			return err
+		}
+
+		backoff := deployment.GetRetryBackoff(attempt)
+		build.AddReportEntry(fmt.Sprintf("attempt %d of %d failed: %s; retrying in %s", attempt, attempts, err, backoff))
+		select {
+		case <-ctx.Done():
+			return ErrCanceled
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// sendArtifact makes a single request and checks the status of the response
+func (dpl *DeploymentService) sendArtifact(ctx context.Context, deployment *entity.HTTPDeployment, artifact string) error {
+	ctx, cancel := context.WithTimeout(ctx, deployment.GetTimeout())
+	defer cancel()
+
+	file, err := os.Open(artifact)
+	if err != nil {
+		return fmt.Errorf("could not open artifact file '%s': %w", artifact, err)
+	}
+	defer file.Close()
+
+	var (
+		body        io.Reader = file
+		contentType           = "application/octet-stream"
+		length      int64     = -1
+	)
+	if deployment.GetBody() == entity.HTTPBodyMultipart {
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		go func() {
+			pw.CloseWithError(writeMultipart(mw, deployment, file))
+		}()
+		defer pr.Close()
+		body = pr
+		contentType = mw.FormDataContentType()
+	} else if info, err := file.Stat(); err == nil {
+		length = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, deployment.GetMethod(), deployment.URL, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = length
+	for k, v := range deployment.Headers {
+		req.Header.Set(k, v)
+	}
+	// the boundary of a multipart body must not be overridden
+	if req.Header.Get("Content-Type") == "" || deployment.GetBody() == entity.HTTPBodyMultipart {
+		req.Header.Set("Content-Type", contentType)
+	}
+	switch {
+	case deployment.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+deployment.BearerToken)
+	case deployment.Username != "":
+		req.SetBasicAuth(deployment.Username, deployment.Password)
+	}
+
+	client := dpl.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !deployment.IsExpectedStatus(resp.StatusCode) {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return statusError{code: resp.StatusCode, body: strings.TrimSpace(string(b))}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// writeMultipart writes the additional form fields and the artifact as multipart form
+func writeMultipart(mw *multipart.Writer, deployment *entity.HTTPDeployment, file *os.File) error {
+	// sorted, so the request is the same every time
+	names := make([]string, 0, len(deployment.Fields))
+	for name := range deployment.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := mw.WriteField(name, deployment.Fields[name]); err != nil {
+			return err
+		}
+	}
+
+	part, err := mw.CreateFormFile(deployment.GetFieldName(), filepath.Base(file.Name()))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(part, file); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// isRetryable reports whether a failed request might succeed when repeated. Client errors
+// like a missing authorization will not.
+func isRetryable(err error) bool {
+	var se statusError
+	if !errors.As(err, &se) {
+		return true
+	}
+	return se.code >= 500 || se.code == http.StatusTooManyRequests || se.code == http.StatusRequestTimeout
+}
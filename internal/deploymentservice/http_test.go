@@ -0,0 +1,171 @@
+package deploymentservice
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/builder"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// newArtifactBuild returns a build with an artifact containing the given content
+func newArtifactBuild(t *testing.T, content string) *builder.Build {
+	t.Helper()
+	artifact := filepath.Join(t.TempDir(), "project", "artifact", "app.zip")
+	if err := os.MkdirAll(filepath.Dir(artifact), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(artifact, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return builder.FromArtifact(&entity.BuildDefinition{}, artifact)
+}
+
+func TestDoHTTPDeploymentMultipart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected method POST, got %s", r.Method)
+		}
+		if u, p, ok := r.BasicAuth(); !ok || u != "deploy" || p != "secret" {
+			t.Errorf("expected basic auth, got %q %q", u, p)
+		}
+		if r.Header.Get("X-Version") != "1.2.3" {
+			t.Errorf("expected the version header, got %q", r.Header.Get("X-Version"))
+		}
+		file, header, err := r.FormFile("package")
+		if err != nil {
+			t.Errorf("expected the artifact in the form: %s", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		b, _ := io.ReadAll(file)
+		if header.Filename != "app.zip" || string(b) != "zipped" {
+			t.Errorf("unexpected file %s with content %q", header.Filename, b)
+		}
+		if r.FormValue("channel") != "stable" {
+			t.Errorf("expected the channel field, got %q", r.FormValue("channel"))
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	dpl := &DeploymentService{HTTPClient: srv.Client()}
+	deployment := &entity.HTTPDeployment{
+		Enabled:   true,
+		URL:       srv.URL + "/upload",
+		Headers:   map[string]string{"X-Version": "1.2.3"},
+		Username:  "deploy",
+		Password:  "secret",
+		FieldName: "package",
+		Fields:    map[string]string{"channel": "stable"},
+	}
+	if err := dpl.DoHTTPDeployment(context.Background(), deployment, newArtifactBuild(t, "zipped")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDoHTTPDeploymentRaw(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("expected method PUT, got %s", r.Method)
+		}
+		if r.Header.Get("Authorization") != "Bearer t0k3n" {
+			t.Errorf("expected bearer auth, got %q", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("Content-Type") != "application/zip" {
+			t.Errorf("expected the configured content type, got %q", r.Header.Get("Content-Type"))
+		}
+		b, _ := io.ReadAll(r.Body)
+		if string(b) != "zipped" || r.ContentLength != 6 {
+			t.Errorf("unexpected body %q of length %d", b, r.ContentLength)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	dpl := &DeploymentService{HTTPClient: srv.Client()}
+	deployment := &entity.HTTPDeployment{
+		Enabled:        true,
+		Method:         "put",
+		URL:            srv.URL + "/app.zip",
+		Headers:        map[string]string{"Content-Type": "application/zip"},
+		BearerToken:    "t0k3n",
+		Body:           entity.HTTPBodyRaw,
+		ExpectedStatus: []int{http.StatusAccepted},
+	}
+	if err := dpl.DoHTTPDeployment(context.Background(), deployment, newArtifactBuild(t, "zipped")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDoHTTPDeploymentRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		requests int32
+		err      string
+	}{
+		{name: "success after server errors", statuses: []int{503, 502, 200}, retries: 3, requests: 3},
+		{name: "retries exhausted", statuses: []int{503, 503, 503}, retries: 1, requests: 2, err: "unexpected response status 503: unavailable"},
+		{name: "client error", statuses: []int{401, 200}, retries: 3, requests: 1, err: "unexpected response status 401"},
+		{name: "rate limited", statuses: []int{429, 204}, retries: 1, requests: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&requests, 1)
+				w.WriteHeader(tt.statuses[n-1])
+				_, _ = w.Write([]byte("unavailable"))
+			}))
+			defer srv.Close()
+
+			dpl := &DeploymentService{HTTPClient: srv.Client()}
+			deployment := &entity.HTTPDeployment{
+				Enabled:      true,
+				URL:          srv.URL,
+				Retries:      tt.retries,
+				RetryBackoff: time.Millisecond,
+			}
+			build := newArtifactBuild(t, "zipped")
+			err := dpl.DoHTTPDeployment(context.Background(), deployment, build)
+			if tt.err == "" && err != nil {
+				t.Errorf("expected success, got %s", err)
+			}
+			if tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+			if n := atomic.LoadInt32(&requests); n != tt.requests {
+				t.Errorf("expected %d requests, got %d", tt.requests, n)
+			}
+			if tt.requests > 1 && !strings.Contains(build.GetReport(), "attempt 1 of") {
+				t.Errorf("expected the retry to be reported, got %q", build.GetReport())
+			}
+		})
+	}
+}
+
+func TestDoHTTPDeploymentCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	dpl := &DeploymentService{HTTPClient: srv.Client()}
+	deployment := &entity.HTTPDeployment{Enabled: true, URL: srv.URL, Retries: 5, RetryBackoff: time.Hour}
+	if err := dpl.DoHTTPDeployment(ctx, deployment, newArtifactBuild(t, "zipped")); err != ErrCanceled {
+		t.Errorf("expected ErrCanceled, got %v", err)
+	}
+}
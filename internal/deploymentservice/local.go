@@ -0,0 +1,301 @@
+package deploymentservice
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/builder"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// errExchangeUnsupported is returned if two directories cannot be exchanged atomically
+var errExchangeUnsupported = errors.New("deploymentservice: atomic exchange is not supported")
+
+// localTarget writes files below a local directory with the modes and owner of a deployment
+type localTarget struct {
+	fileMode fs.FileMode
+	// keepMode makes extracted files keep the mode recorded in the artifact
+	keepMode bool
+	dirMode  fs.FileMode
+	uid, gid int
+}
+
+func newLocalTarget(deployment *entity.LocalDeployment) (*localTarget, error) {
+	if err := deployment.Validate(); err != nil {
+		return nil, err
+	}
+	fileMode, _ := deployment.GetFileMode()
+	dirMode, _ := deployment.GetDirMode()
+	uid, gid, err := lookupOwner(deployment.Owner)
+	if err != nil {
+		return nil, err
+	}
+	return &localTarget{
+		fileMode: fileMode,
+		keepMode: deployment.FileMode == "",
+		dirMode:  dirMode,
+		uid:      uid,
+		gid:      gid,
+	}, nil
+}
+
+// DoLocalDeployment copies the artifact to a file or into a directory, or extracts it into a directory.
+// Every file is written under a temporary name and renamed afterwards. With clean, the target directory
+// is prepared next to the existing one and exchanged with it as a whole.
+func (dpl *DeploymentService) DoLocalDeployment(ctx context.Context, deployment *entity.LocalDeployment, build *builder.Build) error {
+	if !deployment.Enabled {
+		return ErrDisabled
+	}
+	if ctx.Err() != nil {
+		return ErrCanceled
+	}
+	if deployment.Path == "" {
+		return fmt.Errorf("the path of the local deployment is empty")
+	}
+	target, err := newLocalTarget(deployment)
+	if err != nil {
+		return err
+	}
+
+	artifact := build.GetArtifact()
+	path := filepath.Clean(deployment.Path)
+	if !deployment.IsDirectory() {
+		if err = target.mkdirAll(filepath.Dir(path)); err != nil {
+			return err
+		}
+		if err = target.copyFile(artifact, path, target.fileMode); err != nil {
+			return fmt.Errorf("could not copy artifact (%s) to target (%s): %w", artifact, path, err)
+		}
+		build.AddReportEntry(fmt.Sprintf("copied artifact to %s", path))
+		return nil
+	}
+
+	fill := func(dir string) error {
+		if deployment.Extract {
+			return target.extract(ctx, artifact, dir)
+		}
+		return target.copyFile(artifact, filepath.Join(dir, filepath.Base(artifact)), target.fileMode)
+	}
+	if err = target.mkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+	if !deployment.Clean {
+		if err = target.mkdirAll(path); err != nil {
+			return err
+		}
+		if err = fill(path); err != nil {
+			return err
+		}
+	} else {
+		atomic, err := target.replaceDir(path, fill)
+		if err != nil {
+			return err
+		}
+		if !atomic {
+			build.AddReportEntry(fmt.Sprintf("could not exchange %s atomically; replaced it non-atomically", path))
+		}
+	}
+
+	if deployment.Extract {
+		build.AddReportEntry(fmt.Sprintf("extracted artifact into %s", path))
+	} else {
+		build.AddReportEntry(fmt.Sprintf("copied artifact into %s", path))
+	}
+	return nil
+}
+
+// replaceDir fills a new directory next to dir and puts it in the place of dir. The directories are
+// exchanged atomically if the operating system and file system support it, otherwise false is returned.
+func (t *localTarget) replaceDir(dir string, fill func(dir string) error) (bool, error) {
+	staging, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+".tbs-*")
+	if err != nil {
+		return false, err
+	}
+	// the staging directory contains the old directory after the exchange
+	defer os.RemoveAll(staging)
+
+	if err = t.apply(staging, t.dirMode); err != nil {
+		return false, err
+	}
+	if err = fill(staging); err != nil {
+		return false, err
+	}
+
+	if _, err = os.Lstat(dir); errors.Is(err, fs.ErrNotExist) {
+		return true, os.Rename(staging, dir)
+	}
+	if err = exchangeDirs(staging, dir); err == nil {
+		return true, nil
+	}
+
+	old := staging + ".old"
+	if err = os.Rename(dir, old); err != nil {
+		return false, fmt.Errorf("could not move '%s' aside: %w", dir, err)
+	}
+	if err = os.Rename(staging, dir); err != nil {
+		_ = os.Rename(old, dir)
+		return false, fmt.Errorf("could not move new directory to '%s': %w", dir, err)
+	}
+	return false, os.RemoveAll(old)
+}
+
+// extract writes the contents of the zip file into the directory dir
+func (t *localTarget) extract(ctx context.Context, zipFile, dir string) error {
+	r, err := zip.OpenReader(zipFile)
+	if err != nil {
+		return fmt.Errorf("could not open artifact '%s': %w", zipFile, err)
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if ctx.Err() != nil {
+			return ErrCanceled
+		}
+		name := filepath.FromSlash(strings.TrimSuffix(f.Name, "/"))
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("artifact contains illegal path '%s'", f.Name)
+		}
+		target := filepath.Join(dir, name)
+
+		switch mode := f.Mode(); {
+		case mode.IsDir():
+			err = t.mkdirAll(target)
+		case mode.IsRegular():
+			if err = t.mkdirAll(filepath.Dir(target)); err != nil {
+				return err
+			}
+			fileMode := t.fileMode
+			if t.keepMode && mode.Perm() != 0 {
+				fileMode = mode.Perm()
+			}
+			err = t.writeFile(f, target, fileMode)
+		default:
+			return fmt.Errorf("artifact contains '%s', which is not a regular file", f.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("could not extract '%s': %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func (t *localTarget) writeFile(f *zip.File, dst string, mode fs.FileMode) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return t.write(rc, dst, mode)
+}
+
+func (t *localTarget) copyFile(src, dst string, mode fs.FileMode) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return t.write(file, dst, mode)
+}
+
+// write streams r into a temporary file next to dst, which is renamed to dst once complete
+func (t *localTarget) write(r io.Reader, dst string, mode fs.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tbs-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = t.apply(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// mkdirAll creates the directory dir and all missing parents with the mode and owner of the target.
+// Existing directories are left untouched.
+func (t *localTarget) mkdirAll(dir string) error {
+	info, err := os.Stat(dir)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("'%s' is not a directory", dir)
+		}
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err = t.mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+	if err = os.Mkdir(dir, t.dirMode); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return t.apply(dir, t.dirMode)
+}
+
+// apply sets the mode, which is not restricted by the umask this way, and the owner
+func (t *localTarget) apply(path string, mode fs.FileMode) error {
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+	if t.uid == -1 && t.gid == -1 {
+		return nil
+	}
+	if err := os.Lchown(path, t.uid, t.gid); err != nil {
+		return fmt.Errorf("could not change owner of '%s': %w", path, err)
+	}
+	return nil
+}
+
+// lookupOwner returns the IDs of the user and group of an owner like user:group, each given
+// by name or ID. Missing parts are -1.
+func lookupOwner(owner string) (int, int, error) {
+	uid, gid := -1, -1
+	if owner == "" {
+		return uid, gid, nil
+	}
+	userName, groupName, _ := strings.Cut(owner, ":")
+
+	if userName != "" {
+		id, err := strconv.Atoi(userName)
+		if err != nil {
+			u, err := user.Lookup(userName)
+			if err != nil {
+				return 0, 0, err
+			}
+			if id, err = strconv.Atoi(u.Uid); err != nil {
+				return 0, 0, fmt.Errorf("user '%s' has no numeric ID", userName)
+			}
+		}
+		uid = id
+	}
+	if groupName != "" {
+		id, err := strconv.Atoi(groupName)
+		if err != nil {
+			g, err := user.LookupGroup(groupName)
+			if err != nil {
+				return 0, 0, err
+			}
+			if id, err = strconv.Atoi(g.Gid); err != nil {
+				return 0, 0, fmt.Errorf("group '%s' has no numeric ID", groupName)
+			}
+		}
+		gid = id
+	}
+	return uid, gid, nil
+}
@@ -0,0 +1,187 @@
+package deploymentservice
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/builder"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+type zipEntry struct {
+	name    string
+	content string
+	mode    fs.FileMode
+}
+
+// newZipBuild returns a build whose artifact is a zip file containing the given entries
+func newZipBuild(t *testing.T, entries ...zipEntry) *builder.Build {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		header.SetMode(e.mode)
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return newArtifactBuild(t, buf.String())
+}
+
+func assertFile(t *testing.T, path, content string, mode fs.FileMode) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Errorf("expected file %s: %s", path, err)
+		return
+	}
+	if info.Mode().Perm() != mode {
+		t.Errorf("expected mode %v of %s, got %v", mode, path, info.Mode().Perm())
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || string(b) != content {
+		t.Errorf("expected content %q of %s, got %q (%v)", content, path, b, err)
+	}
+}
+
+func TestDoLocalDeploymentFile(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "releases", "app.zip")
+	deployment := &entity.LocalDeployment{Enabled: true, Path: target, FileMode: "0600", DirMode: "0750"}
+	build := newArtifactBuild(t, "zipped")
+
+	if err := (&DeploymentService{}).DoLocalDeployment(context.Background(), deployment, build); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, target, "zipped", 0600)
+	if info, err := os.Stat(filepath.Dir(target)); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("expected the directory to be created with mode 0750, got %v (%v)", info, err)
+	}
+	if !strings.Contains(build.GetReport(), "copied artifact to "+target) {
+		t.Errorf("expected the copy to be reported, got %q", build.GetReport())
+	}
+}
+
+func TestDoLocalDeploymentIntoDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "downloads")
+	deployment := &entity.LocalDeployment{Enabled: true, Path: dir + "/"}
+
+	if err := (&DeploymentService{}).DoLocalDeployment(context.Background(), deployment, newArtifactBuild(t, "zipped")); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, filepath.Join(dir, "app.zip"), "zipped", 0644)
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left, got %v (%v)", entries, err)
+	}
+}
+
+func TestDoLocalDeploymentExtract(t *testing.T) {
+	build := newZipBuild(t,
+		zipEntry{name: "bin/", mode: fs.ModeDir | 0755},
+		zipEntry{name: "bin/app", content: "binary", mode: 0750},
+		zipEntry{name: "config/app.yml", content: "a: b", mode: 0600},
+	)
+
+	t.Run("entry modes", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "app")
+		deployment := &entity.LocalDeployment{Enabled: true, Path: dir, Extract: true, DirMode: "0700"}
+		if err := (&DeploymentService{}).DoLocalDeployment(context.Background(), deployment, build); err != nil {
+			t.Fatal(err)
+		}
+		assertFile(t, filepath.Join(dir, "bin", "app"), "binary", 0750)
+		assertFile(t, filepath.Join(dir, "config", "app.yml"), "a: b", 0600)
+		if info, err := os.Stat(filepath.Join(dir, "config")); err != nil || info.Mode().Perm() != 0700 {
+			t.Errorf("expected the directory to be created with mode 0700, got %v (%v)", info, err)
+		}
+	})
+
+	t.Run("file mode", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "app")
+		deployment := &entity.LocalDeployment{Enabled: true, Path: dir, Extract: true, FileMode: "0640"}
+		if err := (&DeploymentService{}).DoLocalDeployment(context.Background(), deployment, build); err != nil {
+			t.Fatal(err)
+		}
+		assertFile(t, filepath.Join(dir, "bin", "app"), "binary", 0640)
+		assertFile(t, filepath.Join(dir, "config", "app.yml"), "a: b", 0640)
+	})
+}
+
+func TestDoLocalDeploymentClean(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "app")
+	if err := os.MkdirAll(filepath.Join(dir, "old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "old", "stale.txt"), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deployment := &entity.LocalDeployment{Enabled: true, Path: dir, Extract: true, Clean: true}
+	build := newZipBuild(t, zipEntry{name: "index.html", content: "new", mode: 0644})
+	if err := (&DeploymentService{}).DoLocalDeployment(context.Background(), deployment, build); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, filepath.Join(dir, "index.html"), "new", 0644)
+	if _, err := os.Stat(filepath.Join(dir, "old")); !os.IsNotExist(err) {
+		t.Errorf("expected stale files to be removed, got %v", err)
+	}
+	siblings, err := os.ReadDir(filepath.Dir(dir))
+	if err != nil || len(siblings) != 1 {
+		t.Errorf("expected the staging directory to be removed, got %v (%v)", siblings, err)
+	}
+}
+
+func TestDoLocalDeploymentErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		deployment entity.LocalDeployment
+		build      *builder.Build
+		err        string
+	}{
+		{"empty path", entity.LocalDeployment{Enabled: true}, newArtifactBuild(t, "zipped"), "path of the local deployment is empty"},
+		{"invalid mode", entity.LocalDeployment{Enabled: true, Path: t.TempDir(), FileMode: "rw-r--r--"}, newArtifactBuild(t, "zipped"), "invalid mode 'rw-r--r--'"},
+		{"invalid owner", entity.LocalDeployment{Enabled: true, Path: t.TempDir(), Owner: ":"}, newArtifactBuild(t, "zipped"), "invalid owner ':'"},
+		{"zip slip", entity.LocalDeployment{Enabled: true, Path: t.TempDir(), Extract: true},
+			newZipBuild(t, zipEntry{name: "../evil.sh", content: "rm -rf /", mode: 0755}), "illegal path '../evil.sh'"},
+		{"symbolic link", entity.LocalDeployment{Enabled: true, Path: t.TempDir(), Extract: true},
+			newZipBuild(t, zipEntry{name: "link", content: "/etc/passwd", mode: fs.ModeSymlink | 0777}), "not a regular file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&DeploymentService{}).DoLocalDeployment(context.Background(), &tt.deployment, tt.build)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestLookupOwner(t *testing.T) {
+	uid, gid, err := lookupOwner("")
+	if err != nil || uid != -1 || gid != -1 {
+		t.Errorf("expected an empty owner to change nothing, got %d %d (%v)", uid, gid, err)
+	}
+	uid, gid, err = lookupOwner("1000:")
+	if err != nil || uid != 1000 || gid != -1 {
+		t.Errorf("expected only the user ID, got %d %d (%v)", uid, gid, err)
+	}
+	if _, _, err = lookupOwner("no-such-user-tbs"); err == nil {
+		t.Error("expected an unknown user to be refused")
+	}
+}
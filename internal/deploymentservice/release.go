@@ -0,0 +1,178 @@
+package deploymentservice
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+const (
+	releasesDir   = "releases"
+	currentLink   = "current"
+	releaseFormat = "20060102150405"
+)
+
+var (
+	ErrReleaseNotFound     = errors.New("deploymentservice: release does not exist on the remote host")
+	ErrReleasesUnsupported = errors.New("deploymentservice: releases require connection type sftp")
+)
+
+// ReleaseName returns the name of the release directory a build execution is deployed to.
+// Names sort by the time of the deployment.
+func ReleaseName(executionID uint, t time.Time) string {
+	return fmt.Sprintf("%s-%d", t.UTC().Format(releaseFormat), executionID)
+}
+
+// uploadDir recursively copies the local directory src to the remote directory dst, which
+// must not exist yet. File modes and symbolic links are preserved.
+func uploadDir(client *sftp.Client, src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := path.Join(dst, filepath.ToSlash(rel))
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			if err = client.Mkdir(target); err != nil {
+				return fmt.Errorf("could not create directory '%s': %w", target, err)
+			}
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if err = client.Symlink(link, target); err != nil {
+				return fmt.Errorf("could not create symbolic link '%s': %w", target, err)
+			}
+			return nil
+		case d.Type().IsRegular():
+			if err = uploadFile(client, p, target); err != nil {
+				return fmt.Errorf("could not upload file '%s': %w", target, err)
+			}
+		default:
+			// sockets, devices and the like cannot be transferred
+			return nil
+		}
+
+		return client.Chmod(target, info.Mode().Perm())
+	})
+}
+
+func uploadFile(client *sftp.Client, src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := client.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dstFile, srcFile); err != nil {
+		_ = dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
+
+// switchRelease points the current symlink of the working directory to the given release.
+// The new link is created next to the current one and renamed over it, so the switch is atomic
+// if the server supports POSIX renames. Otherwise the old link is removed first and false is returned.
+func switchRelease(client *sftp.Client, workingDir, release string) (bool, error) {
+	if _, err := client.Stat(path.Join(workingDir, releasesDir, release)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, ErrReleaseNotFound
+		}
+		return false, err
+	}
+
+	current := path.Join(workingDir, currentLink)
+	tmp := path.Join(workingDir, "."+currentLink+"-"+release)
+	_ = client.Remove(tmp)
+	if err := client.Symlink(path.Join(releasesDir, release), tmp); err != nil {
+		return false, fmt.Errorf("could not create symbolic link '%s': %w", tmp, err)
+	}
+
+	if err := client.PosixRename(tmp, current); err == nil {
+		return true, nil
+	}
+	if err := client.Remove(current); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		_ = client.Remove(tmp)
+		return false, fmt.Errorf("could not replace '%s': %w", current, err)
+	}
+	if err := client.Rename(tmp, current); err != nil {
+		return false, fmt.Errorf("could not rename '%s' to '%s': %w", tmp, current, err)
+	}
+	return false, nil
+}
+
+// currentRelease returns the name of the release the current symlink of the working directory points to
+func currentRelease(client *sftp.Client, workingDir string) string {
+	target, err := client.ReadLink(path.Join(workingDir, currentLink))
+	if err != nil {
+		return ""
+	}
+	return path.Base(target)
+}
+
+// pruneReleases removes all but the newest keep releases of the working directory and returns
+// the names of the removed ones. The current release is never removed.
+func pruneReleases(client *sftp.Client, workingDir string, keep int) ([]string, error) {
+	dir := path.Join(workingDir, releasesDir)
+	entries, err := client.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() && isReleaseName(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) <= keep {
+		return nil, nil
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	current := currentRelease(client, workingDir)
+	removed := make([]string, 0, len(names)-keep)
+	for _, name := range names[keep:] {
+		if name == current {
+			continue
+		}
+		if err = client.RemoveAll(path.Join(dir, name)); err != nil {
+			return removed, fmt.Errorf("could not remove release '%s': %w", name, err)
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
+
+// isReleaseName reports whether name could have been returned by ReleaseName
+func isReleaseName(name string) bool {
+	stamp, id, ok := strings.Cut(name, "-")
+	if !ok || id == "" || strings.Trim(id, "0123456789") != "" {
+		return false
+	}
+	_, err := time.Parse(releaseFormat, stamp)
+	return err == nil
+}
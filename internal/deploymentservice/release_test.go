@@ -0,0 +1,161 @@
+package deploymentservice
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// newTestSFTPClient connects a client to an SFTP server serving the local file system
+func newTestSFTPClient(t *testing.T) *sftp.Client {
+	t.Helper()
+	clientRead, serverWrite := io.Pipe()
+	serverRead, clientWrite := io.Pipe()
+
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverRead, serverWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Serve() }()
+
+	client, err := sftp.NewClientPipe(clientRead, clientWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the server closes its end of the pipe first, otherwise the client waits for responses forever
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = client.Close()
+	})
+	return client
+}
+
+func TestReleaseName(t *testing.T) {
+	name := ReleaseName(42, time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC))
+	if name != "20210304050607-42" {
+		t.Errorf("expected 20210304050607-42, got %s", name)
+	}
+	if !isReleaseName(name) {
+		t.Errorf("expected %s to be a release name", name)
+	}
+	for _, s := range []string{"current", "20210304050607", "20210304050607-", "2021-42", "20210304050607-4a", "../20210304050607-1"} {
+		if isReleaseName(s) {
+			t.Errorf("expected %q not to be a release name", s)
+		}
+	}
+}
+
+func TestUploadDir(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "bin", "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "bin", "app"), []byte("binary"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "bin", "nested", "config.yml"), []byte("a: b"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bin/app", filepath.Join(src, "app")); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "release")
+	if err := uploadDir(newTestSFTPClient(t), src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, mode := range map[string]os.FileMode{
+		"bin/app":               0750,
+		"bin/nested/config.yml": 0600,
+		"bin/nested":            0755 | os.ModeDir,
+		"bin":                   0755 | os.ModeDir,
+		"app":                   0750, // the symlink is followed
+	} {
+		info, err := os.Stat(filepath.Join(dst, file))
+		if err != nil {
+			t.Errorf("expected %s to be uploaded: %s", file, err)
+			continue
+		}
+		if info.Mode() != mode {
+			t.Errorf("expected mode %s of %s, got %s", mode, file, info.Mode())
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "app")); err != nil || link != "bin/app" {
+		t.Errorf("expected app to link to bin/app, got %q (%v)", link, err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dst, "bin", "nested", "config.yml")); string(b) != "a: b" {
+		t.Errorf("unexpected content %q", b)
+	}
+}
+
+func TestSwitchRelease(t *testing.T) {
+	client := newTestSFTPClient(t)
+	wd := t.TempDir()
+	for _, r := range []string{"20210101000000-1", "20210102000000-2"} {
+		if err := os.MkdirAll(filepath.Join(wd, releasesDir, r), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(wd, releasesDir, r, "version"), []byte(r), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, r := range []string{"20210101000000-1", "20210102000000-2", "20210101000000-1"} {
+		if _, err := switchRelease(client, wd, r); err != nil {
+			t.Fatalf("could not switch to %s: %s", r, err)
+		}
+		if b, _ := os.ReadFile(filepath.Join(wd, currentLink, "version")); string(b) != r {
+			t.Errorf("expected current release %s, got %q", r, b)
+		}
+		if current := currentRelease(client, wd); current != r {
+			t.Errorf("expected current release %s, got %s", r, current)
+		}
+	}
+
+	if _, err := switchRelease(client, wd, "20210103000000-3"); err != ErrReleaseNotFound {
+		t.Errorf("expected ErrReleaseNotFound, got %v", err)
+	}
+	if current := currentRelease(client, wd); current != "20210101000000-1" {
+		t.Errorf("expected current release to be unchanged, got %s", current)
+	}
+}
+
+func TestPruneReleases(t *testing.T) {
+	client := newTestSFTPClient(t)
+	wd := t.TempDir()
+	releases := []string{"20210101000000-1", "20210102000000-2", "20210103000000-3", "20210104000000-4"}
+	for _, r := range append(releases, "backup") {
+		if err := os.MkdirAll(filepath.Join(wd, releasesDir, r, "sub"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the oldest release is live after a rollback
+	if _, err := switchRelease(client, wd, releases[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := pruneReleases(client, wd, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, []string{"20210102000000-2"}) {
+		t.Errorf("unexpected removed releases %v", removed)
+	}
+	entries, _ := os.ReadDir(filepath.Join(wd, releasesDir))
+	left := make([]string, 0, len(entries))
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	if !reflect.DeepEqual(left, []string{"20210101000000-1", "20210103000000-3", "20210104000000-4", "backup"}) {
+		t.Errorf("unexpected remaining releases %v", left)
+	}
+}
@@ -0,0 +1,185 @@
+package deploymentservice
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/builder"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// DoS3Deployment uploads the build directory, or only the artifact, to the bucket of an S3 compatible
+// object storage. In sync mode, objects below the prefix which were not uploaded are removed afterwards.
+func (dpl *DeploymentService) DoS3Deployment(ctx context.Context, deployment *entity.S3Deployment, build *builder.Build) error {
+	if !deployment.Enabled {
+		return ErrDisabled
+	}
+	if ctx.Err() != nil {
+		return ErrCanceled
+	}
+	// the prefix may have been emptied by a variable
+	if err := deployment.Validate(); err != nil {
+		return err
+	}
+
+	client, err := dpl.s3Client(deployment)
+	if err != nil {
+		return err
+	}
+
+	files, err := s3Files(deployment, build)
+	if err != nil {
+		return err
+	}
+	prefix := deployment.GetPrefix()
+	uploaded := make(map[string]bool, len(files))
+	for key, file := range files {
+		if ctx.Err() != nil {
+			return ErrCanceled
+		}
+		key = prefix + key
+		if err = putS3Object(ctx, client, deployment, key, file); err != nil {
+			return fmt.Errorf("could not upload '%s': %w", key, err)
+		}
+		uploaded[key] = true
+	}
+	build.AddReportEntry(fmt.Sprintf("uploaded %d files to %s", len(uploaded), deployment.Describe()))
+
+	if !deployment.Sync {
+		return nil
+	}
+	removed := 0
+	for obj := range client.ListObjects(ctx, deployment.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return fmt.Errorf("could not list objects: %w", obj.Err)
+		}
+		if uploaded[obj.Key] {
+			continue
+		}
+		if err = client.RemoveObject(ctx, deployment.Bucket, obj.Key, minio.RemoveObjectOptions{}); err != nil {
+			return fmt.Errorf("could not remove stale object '%s': %w", obj.Key, err)
+		}
+		removed++
+	}
+	build.AddReportEntry(fmt.Sprintf("removed %d stale objects from %s", removed, deployment.Describe()))
+
+	return nil
+}
+
+// s3Client connects to the endpoint of the deployment. Endpoints without scheme use HTTPS.
+func (dpl *DeploymentService) s3Client(deployment *entity.S3Deployment) (*minio.Client, error) {
+	endpoint := deployment.GetEndpoint()
+	secure := true
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint '%s': %w", endpoint, err)
+		}
+		switch u.Scheme {
+		case "https":
+		case "http":
+			secure = false
+		default:
+			return nil, fmt.Errorf("invalid endpoint '%s': unsupported scheme %s", endpoint, u.Scheme)
+		}
+		endpoint = u.Host
+	}
+
+	options := &minio.Options{
+		Creds:  credentials.NewStaticV4(deployment.AccessKeyID, deployment.SecretAccessKey, ""),
+		Secure: secure,
+		Region: deployment.Region,
+	}
+	if deployment.PathStyle {
+		options.BucketLookup = minio.BucketLookupPath
+	}
+	if dpl.HTTPClient != nil && dpl.HTTPClient.Transport != nil {
+		options.Transport = dpl.HTTPClient.Transport
+	}
+	return minio.New(endpoint, options)
+}
+
+// s3Files returns the local files to upload by their key relative to the prefix
+func s3Files(deployment *entity.S3Deployment, build *builder.Build) (map[string]string, error) {
+	if deployment.Artifact {
+		artifact := build.GetArtifact()
+		if _, err := os.Stat(artifact); err != nil {
+			return nil, fmt.Errorf("could not find artifact file '%s': %w", artifact, err)
+		}
+		return map[string]string{filepath.Base(artifact): artifact}, nil
+	}
+
+	src := build.GetBuildDir()
+	files := make(map[string]string)
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		// object storages know no symbolic links, linked files are uploaded as copies
+		if info, err := os.Stat(p); err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = p
+		return nil
+	})
+	return files, err
+}
+
+// putS3Object uploads a single file with its detected content type
+func putS3Object(ctx context.Context, client *minio.Client, deployment *entity.S3Deployment, key, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	contentType, err := detectContentType(f)
+	if err != nil {
+		return err
+	}
+
+	options := minio.PutObjectOptions{ContentType: contentType}
+	if deployment.Public {
+		options.UserMetadata = map[string]string{"x-amz-acl": "public-read"}
+	}
+	_, err = client.PutObject(ctx, deployment.Bucket, key, f, info.Size(), options)
+	return err
+}
+
+// detectContentType determines the content type of a file by its extension or, if the extension
+// is unknown, by its first bytes. The file is read from the start again afterwards.
+func detectContentType(f *os.File) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(f.Name())); contentType != "" {
+		return contentType, nil
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
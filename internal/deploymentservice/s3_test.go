@@ -0,0 +1,269 @@
+package deploymentservice
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+type fakeObject struct {
+	content     string
+	contentType string
+	acl         string
+}
+
+// fakeS3 is an S3 stand-in keeping the objects of a single bucket in memory. Requests are
+// expected to address the bucket in the path and signatures are not verified.
+type fakeS3 struct {
+	bucket      string
+	accessKeyID string
+	mut         sync.Mutex
+	objects     map[string]fakeObject
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential="+f.accessKeyID+"/") {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "" && r.URL.Query().Has("location"):
+		_, _ = w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></LocationConstraint>`))
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r.URL.Query().Get("prefix"))
+	case r.Method == http.MethodPut && key != "":
+		content, err := readS3Body(r)
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = fakeObject{content: content, contentType: r.Header.Get("Content-Type"), acl: r.Header.Get("X-Amz-Acl")}
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodDelete && key != "":
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key  string
+		Size int
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		MaxKeys     int
+		IsTruncated bool
+		Contents    []content
+	}{Name: f.bucket, Prefix: prefix, MaxKeys: 1000}
+	for key, obj := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, content{Key: key, Size: len(obj.content)})
+		}
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+// readS3Body returns the content of an upload, which may be sent in signed chunks
+func readS3Body(r *http.Request) (string, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		b, err := io.ReadAll(r.Body)
+		return string(b), err
+	}
+	var buf bytes.Buffer
+	br := bufio.NewReader(r.Body)
+	for {
+		header, err := br.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return "", err
+		}
+		if size == 0 {
+			return buf.String(), nil
+		}
+		if _, err = io.CopyN(&buf, br, size); err != nil {
+			return "", err
+		}
+		if _, err = br.Discard(2); err != nil {
+			return "", err
+		}
+	}
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
+
+func newFakeS3(t *testing.T, objects map[string]fakeObject) (*fakeS3, *entity.S3Deployment) {
+	t.Helper()
+	fake := &fakeS3{bucket: "downloads", accessKeyID: "AKID", objects: objects}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return fake, &entity.S3Deployment{
+		Enabled:         true,
+		Endpoint:        srv.URL,
+		Bucket:          "downloads",
+		Region:          "eu-central-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+	}
+}
+
+func TestDoS3DeploymentSync(t *testing.T) {
+	fake, deployment := newFakeS3(t, map[string]fakeObject{
+		"myapp/old.txt":   {content: "stale"},
+		"myapp/index.htm": {content: "replaced"},
+		"other/keep.txt":  {content: "unrelated"},
+	})
+	deployment.Prefix = "/myapp/"
+	deployment.Public = true
+	deployment.Sync = true
+
+	build := newArtifactBuild(t, "zipped")
+	buildDir := build.GetBuildDir()
+	files := map[string]string{
+		"index.htm":  "<!DOCTYPE html><html></html>",
+		"data.json":  `{"a": 1}`,
+		"bin/app":    "\x7fELF\x00\x00",
+		"bin/notes":  "plain text",
+		"nested/d/e": "",
+	}
+	for name, content := range files {
+		p := filepath.Join(buildDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := (&DeploymentService{}).DoS3Deployment(context.Background(), deployment, build); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"myapp/index.htm":  "text/html; charset=utf-8",
+		"myapp/data.json":  "application/json",
+		"myapp/bin/app":    "application/octet-stream",
+		"myapp/bin/notes":  "text/plain; charset=utf-8",
+		"myapp/nested/d/e": "text/plain; charset=utf-8",
+		"other/keep.txt":   "",
+	}
+	if len(fake.objects) != len(want) {
+		t.Errorf("expected %d objects, got %v", len(want), fake.objects)
+	}
+	for key, contentType := range want {
+		obj, ok := fake.objects[key]
+		if !ok {
+			t.Errorf("expected object %s", key)
+			continue
+		}
+		if obj.contentType != contentType {
+			t.Errorf("expected content type %q of %s, got %q", contentType, key, obj.contentType)
+		}
+		if name := strings.TrimPrefix(key, "myapp/"); name != key && (obj.content != files[name] || obj.acl != "public-read") {
+			t.Errorf("unexpected object %s: %+v", key, obj)
+		}
+	}
+	if !strings.Contains(build.GetReport(), "removed 1 stale objects") {
+		t.Errorf("expected the removal to be reported, got %q", build.GetReport())
+	}
+}
+
+func TestDoS3DeploymentArtifact(t *testing.T) {
+	fake, deployment := newFakeS3(t, map[string]fakeObject{"old.zip": {content: "old"}})
+	deployment.Artifact = true
+
+	if err := (&DeploymentService{}).DoS3Deployment(context.Background(), deployment, newArtifactBuild(t, "PK\x03\x04zipped")); err != nil {
+		t.Fatal(err)
+	}
+	obj, ok := fake.objects["app.zip"]
+	if !ok || obj.content != "PK\x03\x04zipped" || obj.contentType != "application/zip" || obj.acl != "" {
+		t.Errorf("unexpected artifact object %+v", obj)
+	}
+	if _, ok = fake.objects["old.zip"]; !ok {
+		t.Error("expected other objects to be kept without sync")
+	}
+}
+
+func TestDoS3DeploymentErrors(t *testing.T) {
+	_, deployment := newFakeS3(t, map[string]fakeObject{})
+	deployment.Artifact = true
+	deployment.AccessKeyID = "WRONG"
+	if err := (&DeploymentService{}).DoS3Deployment(context.Background(), deployment, newArtifactBuild(t, "zipped")); err == nil {
+		t.Error("expected wrong credentials to fail the deployment")
+	}
+
+	deployment.Endpoint = "ftp://example.org"
+	err := (&DeploymentService{}).DoS3Deployment(context.Background(), deployment, newArtifactBuild(t, "zipped"))
+	if err == nil || !strings.Contains(err.Error(), "unsupported scheme ftp") {
+		t.Errorf("expected the endpoint to be refused, got %v", err)
+	}
+}
+
+func TestDoS3DeploymentValidation(t *testing.T) {
+	fake, deployment := newFakeS3(t, map[string]fakeObject{"other/keep.txt": {content: "unrelated"}})
+	deployment.Artifact = true
+	deployment.Sync = true
+	deployment.Prefix = "/"
+
+	err := (&DeploymentService{}).DoS3Deployment(context.Background(), deployment, newArtifactBuild(t, "zipped"))
+	if err == nil || !strings.Contains(err.Error(), "sync_whole_bucket") {
+		t.Errorf("expected sync without prefix to be refused, got %v", err)
+	}
+	if len(fake.objects) != 1 {
+		t.Errorf("expected the bucket to be untouched, got %v", fake.objects)
+	}
+
+	deployment.SyncWholeBucket = true
+	if err = (&DeploymentService{}).DoS3Deployment(context.Background(), deployment, newArtifactBuild(t, "zipped")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.objects["app.zip"]; !ok || len(fake.objects) != 1 {
+		t.Errorf("expected the whole bucket to be synced with the opt-in, got %v", fake.objects)
+	}
+
+	deployment.Bucket = ""
+	err = (&DeploymentService{}).DoS3Deployment(context.Background(), deployment, newArtifactBuild(t, "zipped"))
+	if err == nil || !strings.Contains(err.Error(), "no bucket set") {
+		t.Errorf("expected a missing bucket to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package deploymentservice
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+var (
+	ErrUnknownHost     = errors.New("unknown host")
+	ErrHostKeyMismatch = errors.New("host key mismatch")
+	ErrNoAuthMethod    = errors.New("no authentication method configured")
+)
+
+// KnownHostStore keeps the trusted host keys of SSH servers
+type KnownHostStore interface {
+	GetKnownHostsByHost(host string) ([]entity.KnownHost, error)
+	AddKnownHost(kh *entity.KnownHost) error
+}
+
+// hostKeyCallback verifies the host key presented by the SSH server. A pinned fingerprint takes precedence,
+// otherwise the key has to be among the known keys of the host. Unknown hosts are only accepted, and their
+// key recorded, with trust on first use. Keys of known hosts which differ from the known ones are always rejected.
+func hostKeyCallback(store KnownHostStore, deployment *entity.RemoteDeployment, report func(string)) ssh.HostKeyCallback {
+	return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+		fingerprint := ssh.FingerprintSHA256(key)
+
+		if pinned := deployment.HostKeyFingerprint; pinned != "" {
+			if !strings.HasPrefix(pinned, "SHA256:") {
+				pinned = "SHA256:" + pinned
+			}
+			if fingerprint != pinned {
+				return fmt.Errorf("%w: %s presented %s, but %s is pinned", ErrHostKeyMismatch, hostname, fingerprint, pinned)
+			}
+			return nil
+		}
+
+		if store == nil {
+			return fmt.Errorf("%w: no known hosts available to verify %s (%s)", ErrUnknownHost, hostname, fingerprint)
+		}
+		host := knownhosts.Normalize(hostname)
+		known, err := store.GetKnownHostsByHost(host)
+		if err != nil {
+			return fmt.Errorf("could not get known hosts: %w", err)
+		}
+		for _, kh := range known {
+			if kh.Fingerprint == fingerprint {
+				return nil
+			}
+		}
+		// a different key of a known host is possibly an attack, so trust on first use does not apply
+		if len(known) > 0 {
+			return fmt.Errorf("%w: %s presented the %s key %s, which is not among its known keys", ErrHostKeyMismatch, host, key.Type(), fingerprint)
+		}
+
+		if !deployment.TrustOnFirstUse {
+			return fmt.Errorf("%w: %s presented the %s key %s; add it to the known hosts or pin its fingerprint", ErrUnknownHost, host, key.Type(), fingerprint)
+		}
+		err = store.AddKnownHost(&entity.KnownHost{
+			Host:        host,
+			KeyType:     key.Type(),
+			PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+			Fingerprint: fingerprint,
+		})
+		if err != nil {
+			return fmt.Errorf("could not record host key: %w", err)
+		}
+		report(fmt.Sprintf("trusted the %s key %s of %s on first use", key.Type(), fingerprint, host))
+		return nil
+	}
+}
+
+// hostKeyAlgorithms returns the algorithms of the known keys of the host, so the server cannot switch to
+// a key type which is not known yet. Without known keys, the defaults are used.
+func hostKeyAlgorithms(store KnownHostStore, address string) ([]string, error) {
+	if store == nil {
+		return nil, nil
+	}
+	known, err := store.GetKnownHostsByHost(knownhosts.Normalize(address))
+	if err != nil {
+		return nil, fmt.Errorf("could not get known hosts: %w", err)
+	}
+	algorithms := make([]string, 0, len(known))
+	for _, kh := range known {
+		// RSA keys are used with SHA-2 signatures by current servers
+		if kh.KeyType == ssh.KeyAlgoRSA {
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		algorithms = append(algorithms, kh.KeyType)
+	}
+	return algorithms, nil
+}
+
+// authMethods returns the configured authentication methods: private key, ssh-agent and password, tried in this
+// order. The returned func closes the connection to the agent and has to be called once the connection is closed.
+func authMethods(deployment *entity.RemoteDeployment) ([]ssh.AuthMethod, func(), error) {
+	var (
+		methods []ssh.AuthMethod
+		cleanup = func() {}
+	)
+
+	if deployment.PrivateKey != "" || deployment.PrivateKeyFile != "" {
+		key := []byte(deployment.PrivateKey)
+		if deployment.PrivateKeyFile != "" {
+			var err error
+			if key, err = os.ReadFile(deployment.PrivateKeyFile); err != nil {
+				return nil, nil, fmt.Errorf("could not read private key file: %w", err)
+			}
+		}
+		signer, err := parsePrivateKey(key, deployment.Passphrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	if deployment.UseAgent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, nil, errors.New("ssh-agent requested, but SSH_AUTH_SOCK is not set")
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not connect to ssh-agent: %w", err)
+		}
+		cleanup = func() { _ = conn.Close() }
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+
+	if deployment.Password != "" {
+		methods = append(methods, ssh.Password(deployment.Password))
+	}
+
+	if len(methods) == 0 {
+		return nil, nil, ErrNoAuthMethod
+	}
+	return methods, cleanup, nil
+}
+
+// parsePrivateKey parses a PEM encoded private key, which is decrypted using the passphrase, if protected
+func parsePrivateKey(key []byte, passphrase string) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if passphrase == "" {
+			return nil, errors.New("the private key is protected by a passphrase, but none is configured")
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %w", err)
+	}
+	return signer, nil
+}
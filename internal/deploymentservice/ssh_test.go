@@ -0,0 +1,163 @@
+package deploymentservice
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+type fakeKnownHosts struct {
+	hosts []entity.KnownHost
+}
+
+func (f *fakeKnownHosts) GetKnownHostsByHost(host string) ([]entity.KnownHost, error) {
+	found := make([]entity.KnownHost, 0)
+	for _, kh := range f.hosts {
+		if kh.Host == host {
+			found = append(found, kh)
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeKnownHosts) AddKnownHost(kh *entity.KnownHost) error {
+	f.hosts = append(f.hosts, *kh)
+	return nil
+}
+
+func newTestKey(t *testing.T) (ed25519.PrivateKey, ssh.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, sshPub
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	_, key := newTestKey(t)
+	_, otherKey := newTestKey(t)
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2222}
+	known := entity.KnownHost{Host: "[deploy.example.com]:2222", KeyType: key.Type(), Fingerprint: ssh.FingerprintSHA256(key)}
+
+	tests := []struct {
+		name       string
+		deployment entity.RemoteDeployment
+		known      []entity.KnownHost
+		key        ssh.PublicKey
+		wantErr    error
+		wantAdded  int
+	}{
+		{name: "pinned", deployment: entity.RemoteDeployment{HostKeyFingerprint: ssh.FingerprintSHA256(key)}, key: key},
+		{name: "pinned without prefix", deployment: entity.RemoteDeployment{HostKeyFingerprint: ssh.FingerprintSHA256(key)[len("SHA256:"):]}, key: key},
+		{name: "pinned mismatch", deployment: entity.RemoteDeployment{HostKeyFingerprint: ssh.FingerprintSHA256(otherKey)}, key: key, wantErr: ErrHostKeyMismatch},
+		{name: "known", known: []entity.KnownHost{known}, key: key},
+		{name: "known mismatch", known: []entity.KnownHost{known}, key: otherKey, wantErr: ErrHostKeyMismatch},
+		{name: "known mismatch with trust on first use", deployment: entity.RemoteDeployment{TrustOnFirstUse: true}, known: []entity.KnownHost{known}, key: otherKey, wantErr: ErrHostKeyMismatch},
+		{name: "unknown", key: key, wantErr: ErrUnknownHost},
+		{name: "trust on first use", deployment: entity.RemoteDeployment{TrustOnFirstUse: true}, key: key, wantAdded: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeKnownHosts{hosts: append([]entity.KnownHost{}, tt.known...)}
+			var reported []string
+			cb := hostKeyCallback(store, &tt.deployment, func(s string) { reported = append(reported, s) })
+
+			err := cb("deploy.example.com:2222", addr, tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if added := len(store.hosts) - len(tt.known); added != tt.wantAdded {
+				t.Fatalf("expected %d added known hosts, got %d", tt.wantAdded, added)
+			}
+			if tt.wantAdded > 0 {
+				kh := store.hosts[len(store.hosts)-1]
+				if kh.Host != "[deploy.example.com]:2222" || kh.Fingerprint != ssh.FingerprintSHA256(tt.key) || !kh.TrustedOnFirstUse() {
+					t.Errorf("unexpected known host %+v", kh)
+				}
+				if len(reported) != 1 {
+					t.Errorf("expected trusting the key to be reported, got %v", reported)
+				}
+			}
+		})
+	}
+}
+
+func TestHostKeyAlgorithms(t *testing.T) {
+	store := &fakeKnownHosts{hosts: []entity.KnownHost{
+		{Host: "deploy.example.com", KeyType: ssh.KeyAlgoED25519},
+		{Host: "deploy.example.com", KeyType: ssh.KeyAlgoRSA},
+	}}
+	algorithms, err := hostKeyAlgorithms(store, "deploy.example.com:22")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	want := []string{ssh.KeyAlgoED25519, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	if len(algorithms) != len(want) {
+		t.Fatalf("expected %v, got %v", want, algorithms)
+	}
+	for i := range want {
+		if algorithms[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, algorithms)
+			break
+		}
+	}
+
+	if algorithms, _ = hostKeyAlgorithms(store, "other.example.com:22"); len(algorithms) != 0 {
+		t.Errorf("expected the default algorithms for unknown hosts, got %v", algorithms)
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	priv, pub := newTestKey(t)
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := pem.EncodeToMemory(block)
+
+	if _, err = parsePrivateKey(key, ""); err == nil {
+		t.Error("expected an error without passphrase")
+	}
+	if _, err = parsePrivateKey(key, "wrong"); err == nil {
+		t.Error("expected an error with a wrong passphrase")
+	}
+	signer, err := parsePrivateKey(key, "correct horse")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if ssh.FingerprintSHA256(signer.PublicKey()) != ssh.FingerprintSHA256(pub) {
+		t.Error("expected the signer to belong to the key")
+	}
+}
+
+func TestAuthMethods(t *testing.T) {
+	if _, _, err := authMethods(&entity.RemoteDeployment{}); !errors.Is(err, ErrNoAuthMethod) {
+		t.Errorf("expected ErrNoAuthMethod, got %v", err)
+	}
+
+	methods, cleanup, err := authMethods(&entity.RemoteDeployment{Password: "secret"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	defer cleanup()
+	if len(methods) != 1 {
+		t.Errorf("expected 1 auth method, got %d", len(methods))
+	}
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	if _, _, err = authMethods(&entity.RemoteDeployment{UseAgent: true}); err == nil {
+		t.Error("expected an error without ssh-agent")
+	}
+}
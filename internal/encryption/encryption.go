@@ -0,0 +1,80 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const encryptedPrefix = "enc:v1:"
+
+var (
+	ErrNoMasterKey = errors.New("encryption: no master key configured")
+)
+
+// Encrypt encrypts the given plaintext using AES-256-GCM with a key derived from
+// the master key. The result is base64 encoded and carries a version prefix.
+func Encrypt(masterKey, plaintext string) (string, error) {
+	gcm, err := newGCM(masterKey)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value created by Encrypt. Values without the version prefix
+// are considered to be plaintext and are returned unchanged.
+func Decrypt(masterKey, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	gcm, err := newGCM(masterKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("could not decode encrypted value: %s", err.Error())
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt value: %s", err.Error())
+	}
+
+	return string(plain), nil
+}
+
+// IsEncrypted checks whether a given value was created by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+func newGCM(masterKey string) (cipher.AEAD, error) {
+	if masterKey == "" {
+		return nil, ErrNoMasterKey
+	}
+	key := sha256.Sum256([]byte(masterKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,60 @@
+package encryption
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	tests := []struct {
+		name      string
+		masterKey string
+		plaintext string
+	}{
+		{name: "simple value", masterKey: "master", plaintext: "my-secret"},
+		{name: "empty value", masterKey: "master", plaintext: ""},
+		{name: "special characters", masterKey: "a much longer master key !§$%&", plaintext: "p@ss:w/rd?&=#"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := Encrypt(tt.masterKey, tt.plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if !IsEncrypted(enc) {
+				t.Fatalf("expected encrypted value to carry the prefix, got '%s'", enc)
+			}
+			if tt.plaintext != "" && strings.Contains(enc, tt.plaintext) {
+				t.Fatalf("encrypted value contains the plaintext")
+			}
+			dec, err := Decrypt(tt.masterKey, enc)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if dec != tt.plaintext {
+				t.Errorf("Decrypt() got = %v, want %v", dec, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	enc, err := Encrypt("master", "value")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	if _, err := Decrypt("wrong", enc); err == nil {
+		t.Errorf("expected decrypting with the wrong key to fail")
+	}
+	if _, err := Decrypt("", enc); !errors.Is(err, ErrNoMasterKey) {
+		t.Errorf("expected ErrNoMasterKey, got %v", err)
+	}
+	if got, err := Decrypt("master", "plain value"); err != nil || got != "plain value" {
+		t.Errorf("expected plaintext to be returned unchanged, got '%s' (%v)", got, err)
+	}
+	if _, err := Encrypt("", "value"); !errors.Is(err, ErrNoMasterKey) {
+		t.Errorf("expected ErrNoMasterKey, got %v", err)
+	}
+}
@@ -105,3 +105,28 @@ type AzurePushPayload struct {
 	} `json:"resourceContainers"`
 	CreatedDate time.Time `json:"createdDate"`
 }
+
+// AzurePullRequestPayload represents the webhook payload of a pull request event from Azure DevOps
+type AzurePullRequestPayload struct {
+	EventType string `json:"eventType"`
+	Resource  struct {
+		PullRequestID int    `json:"pullRequestId"`
+		Title         string `json:"title"`
+		Status        string `json:"status"`
+		SourceRefName string `json:"sourceRefName"`
+		TargetRefName string `json:"targetRefName"`
+		CreatedBy     struct {
+			UniqueName string `json:"uniqueName"`
+		} `json:"createdBy"`
+		LastMergeSourceCommit struct {
+			CommitID string `json:"commitId"`
+		} `json:"lastMergeSourceCommit"`
+		Repository struct {
+			Name   string `json:"name"`
+			WebURL string `json:"webUrl"`
+		} `json:"repository"`
+		ForkSource *struct {
+			Name string `json:"name"`
+		} `json:"forkSource"`
+	} `json:"resource"`
+}
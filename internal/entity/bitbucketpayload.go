@@ -284,3 +284,38 @@ type BitBucketPushPayload struct {
 		Name      string `json:"name"`
 	} `json:"repository"`
 }
+
+// BitBucketPullRequestPayload represents the webhook payload of a pull request event from bitbucket
+type BitBucketPullRequestPayload struct {
+	PullRequest struct {
+		ID    int    `json:"id"`
+		Title string `json:"title"`
+		Links struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+		Source struct {
+			Branch struct {
+				Name string `json:"name"`
+			} `json:"branch"`
+			Commit struct {
+				Hash string `json:"hash"`
+			} `json:"commit"`
+			Repository struct {
+				FullName string `json:"full_name"`
+			} `json:"repository"`
+		} `json:"source"`
+		Destination struct {
+			Branch struct {
+				Name string `json:"name"`
+			} `json:"branch"`
+		} `json:"destination"`
+	} `json:"pullrequest"`
+	Actor struct {
+		Nickname string `json:"nickname"`
+	} `json:"actor"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
@@ -12,6 +12,7 @@ type (
 		gorm.Model
 		Caption         string
 		Token           string
+		WebhookSecret   string
 		Raw             string
 		Data            BuildDefinitionContent `gorm:"-"`
 		EditedBy        uint
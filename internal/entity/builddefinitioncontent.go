@@ -1,39 +1,386 @@
 package entity
 
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // BuildDefinitionContent is the counterpart of the YAML string
 // of a build definition
 type BuildDefinitionContent struct {
-	ProjectType string     `yaml:"project_type"`
-	Repository  Repository `yaml:"repository"`
-	Setup       []string   `yaml:"setup,omitempty"`
-	Test        []string   `yaml:"test,omitempty"`
-	PreBuild    []string   `yaml:"pre_build,omitempty"`
-	Build       []string   `yaml:"build"`
-	PostBuild   []string   `yaml:"post_build,omitempty"`
-	Deployments struct {
-		LocalDeployments  []LocalDeployment  `yaml:"local_deployments,omitempty"`
-		EmailDeployments  []EmailDeployment  `yaml:"email_deployments,omitempty"`
-		RemoteDeployments []RemoteDeployment `yaml:"remote_deployments,omitempty"`
-	} `yaml:"deployments"`
+	ProjectType  string       `yaml:"project_type"`
+	Repository   Repository   `yaml:"repository"`
+	Checkout     Checkout     `yaml:"checkout,omitempty"`
+	Parameters   []Parameter  `yaml:"parameters,omitempty"`
+	PullRequest  PullRequest  `yaml:"pull_request,omitempty"`
+	StatusReport StatusReport `yaml:"status_report,omitempty"`
+	Polling      Polling      `yaml:"polling,omitempty"`
+	Paths        PathFilter   `yaml:"paths,omitempty"`
+	Concurrency  Concurrency  `yaml:"concurrency,omitempty"`
+	Setup        []string     `yaml:"setup,omitempty"`
+	Test         []string     `yaml:"test,omitempty"`
+	PreBuild     []string     `yaml:"pre_build,omitempty"`
+	Build        []string     `yaml:"build"`
+	PostBuild    []string     `yaml:"post_build,omitempty"`
+	Deployments  Deployments  `yaml:"deployments"`
 }
 
 type Repository struct {
-	Hoster       string `yaml:"hoster"`
-	Url          string `yaml:"hoster_url"`
-	Name         string `yaml:"name"`
-	AccessUser   string `yaml:"access_user"`
-	AccessSecret string `yaml:"access_secret"`
-	Branch       string `yaml:"branch"`
+	Hoster       string   `yaml:"hoster"`
+	Url          string   `yaml:"hoster_url"`
+	Name         string   `yaml:"name"`
+	AccessUser   string   `yaml:"access_user"`
+	AccessSecret string   `yaml:"access_secret"`
+	Branch       string   `yaml:"branch"`
+	Branches     []string `yaml:"branches,omitempty"`
+	Tags         []string `yaml:"tags,omitempty"`
+	// SSHUrl is used to access the repository via SSH, if the build definition has a deploy key
+	SSHUrl string `yaml:"ssh_url,omitempty"`
+	// Generic configures webhooks of the generic hoster
+	Generic GenericWebhook `yaml:"generic,omitempty"`
+}
+
+// GenericWebhook maps the JSON payload sent to the generic hoster to the values needed to trigger
+// a build. The values are JSONPath-like expressions, e.g. "$.push.changes[0].ref" or "commits[-1].id".
+type GenericWebhook struct {
+	// Ref is the full ref, e.g. "refs/heads/main". A plain name is considered a branch.
+	Ref string `yaml:"ref,omitempty"`
+	// Branch and Tag are alternatives to Ref, if the payload contains the plain names
+	Branch string `yaml:"branch,omitempty"`
+	Tag    string `yaml:"tag,omitempty"`
+	// Commit is required. An empty value or zeros denote the deletion of the branch or tag.
+	Commit string `yaml:"commit,omitempty"`
+	// Repository has to yield the repository name of the build definition. If not set, the repository is not checked.
+	Repository string `yaml:"repository,omitempty"`
+	// Auth is either "token" (default), "hmac" or "none"
+	Auth string `yaml:"auth,omitempty"`
+	// SecretHeader is the header containing the token or signature, X-Webhook-Secret or X-Webhook-Signature by default
+	SecretHeader string `yaml:"secret_header,omitempty"`
+}
+
+// GetSecretHeader returns the header containing the token or signature, depending on the auth
+func (g GenericWebhook) GetSecretHeader() string {
+	switch {
+	case g.SecretHeader != "":
+		return g.SecretHeader
+	case g.Auth == "hmac":
+		return "X-Webhook-Signature"
+	default:
+		return "X-Webhook-Secret"
+	}
+}
+
+// GetBranch returns the default branch of the repository, used for builds
+// not triggered by a push
+func (r Repository) GetBranch() string {
+	if r.Branch == "" {
+		return "master"
+	}
+	return r.Branch
+}
+
+// GetBranchPatterns returns the patterns pushed branches have to match in order
+// to trigger a build. Without explicit patterns, only the default branch is built.
+func (r Repository) GetBranchPatterns() []string {
+	if len(r.Branches) > 0 {
+		return r.Branches
+	}
+	return []string{r.GetBranch()}
+}
+
+// Checkout controls how the repository is checked out for a build
+type Checkout struct {
+	// Depth limits the fetched history to the given number of commits; the full history by default
+	Depth int `yaml:"depth,omitempty"`
+	// Submodules checks out the submodules recursively
+	Submodules bool `yaml:"submodules,omitempty"`
+	// LFS downloads the files stored with Git LFS; requires git-lfs to be installed
+	LFS bool `yaml:"lfs,omitempty"`
+	// SparseCheckout lists the directories to check out; all files by default
+	SparseCheckout []string `yaml:"sparse_checkout,omitempty"`
+}
+
+// PullRequest controls builds of pull requests (merge requests in GitLab's terms)
+type PullRequest struct {
+	Enabled bool `yaml:"enabled"`
+	// Branches are the patterns the target branch has to match, the repository's branch patterns by default
+	Branches []string `yaml:"branches,omitempty"`
+	// Checkout is either "head" (default) to build the head commit or "merge" to build the merge commit
+	Checkout string `yaml:"checkout,omitempty"`
+	// Steps are the names of the sections to run, all sections by default
+	Steps []string `yaml:"steps,omitempty"`
+	// Deploy enables the deployments, which are disabled for pull requests by default
+	Deploy bool `yaml:"deploy"`
+	// AllowForks allows building pull requests from other repositories
+	AllowForks bool `yaml:"allow_forks"`
+}
+
+// StatusReport controls reporting the build status back to the git hoster as commit status
+type StatusReport struct {
+	Enabled bool `yaml:"enabled"`
+	// ApiUrl is the base url of the hoster's API, derived from the repository url by default
+	ApiUrl string `yaml:"api_url,omitempty"`
+	// Token is used to authenticate against the API, the repository's access secret by default
+	Token string `yaml:"token,omitempty"`
+	// Context is the name of the status, "tiny-build-server" by default
+	Context string `yaml:"context,omitempty"`
+}
+
+// PathFilter restricts builds triggered by pushes and pull requests to changes of certain files.
+// The patterns are matched against the paths of the changed files, relative to the repository root.
+type PathFilter struct {
+	// Include lists the patterns of which at least one changed file has to match; all files by default
+	Include []string `yaml:"include,omitempty"`
+	// Exclude lists the patterns of files whose changes never trigger a build
+	Exclude []string `yaml:"exclude,omitempty"`
+}
+
+// IsSet checks whether any pattern is configured
+func (f PathFilter) IsSet() bool {
+	return len(f.Include) > 0 || len(f.Exclude) > 0
+}
+
+// Polling controls polling the repository for new commits, for repositories which cannot send webhooks
+type Polling struct {
+	Enabled bool `yaml:"enabled"`
+	// Interval is the time between two polls, 5 minutes by default and at least one minute
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// MaxBackoff limits the time between two polls after consecutive errors, one hour by default
+	MaxBackoff time.Duration `yaml:"max_backoff,omitempty"`
 }
 
+// GetInterval returns the time between two polls
+func (p Polling) GetInterval() time.Duration {
+	if p.Interval <= 0 {
+		return 5 * time.Minute
+	}
+	if p.Interval < time.Minute {
+		return time.Minute
+	}
+	return p.Interval
+}
+
+// GetMaxBackoff returns the maximum time between two polls after errors
+func (p Polling) GetMaxBackoff() time.Duration {
+	backoff := p.MaxBackoff
+	if backoff <= 0 {
+		backoff = time.Hour
+	}
+	if backoff < p.GetInterval() {
+		return p.GetInterval()
+	}
+	return backoff
+}
+
+// Concurrency controls how builds triggered in quick succession for the same branch or tag are handled
+type Concurrency struct {
+	// QuietPeriod delays triggered builds; triggers arriving within the period replace the waiting build
+	QuietPeriod time.Duration `yaml:"quiet_period,omitempty"`
+	// CancelSuperseded cancels running builds of the same branch or tag once a newer build starts
+	CancelSuperseded bool `yaml:"cancel_superseded,omitempty"`
+}
+
+// ParameterType is the type of a build parameter
+type ParameterType string
+
+const (
+	ParameterTypeString  ParameterType = "string"
+	ParameterTypeChoice  ParameterType = "choice"
+	ParameterTypeBoolean ParameterType = "boolean"
+)
+
+// Parameter is a value which can be supplied when running a build manually.
+// Builds triggered otherwise use the default value.
+type Parameter struct {
+	Name        string        `yaml:"name"`
+	Type        ParameterType `yaml:"type"`
+	Default     string        `yaml:"default,omitempty"`
+	Choices     []string      `yaml:"choices,omitempty"`
+	Description string        `yaml:"description,omitempty"`
+}
+
+type Deployments struct {
+	// Environments are the named stages targets can be assigned to, e.g. staging and production
+	Environments      []Environment      `yaml:"environments,omitempty"`
+	LocalDeployments  []LocalDeployment  `yaml:"local_deployments,omitempty"`
+	EmailDeployments  []EmailDeployment  `yaml:"email_deployments,omitempty"`
+	RemoteDeployments []RemoteDeployment `yaml:"remote_deployments,omitempty"`
+	HTTPDeployments   []HTTPDeployment   `yaml:"http_deployments,omitempty"`
+	S3Deployments     []S3Deployment     `yaml:"s3_deployments,omitempty"`
+}
+
+// Validate checks the deployment targets for settings which cannot work
+func (d Deployments) Validate() error {
+	for i, ld := range d.LocalDeployments {
+		if err := ld.Validate(); err != nil {
+			return fmt.Errorf("local deployment %d (%s): %w", i+1, ld.Path, err)
+		}
+	}
+	for i, rd := range d.RemoteDeployments {
+		if err := rd.Validate(); err != nil {
+			return fmt.Errorf("remote deployment %d (%s): %w", i+1, rd.Host, err)
+		}
+	}
+	for i, sd := range d.S3Deployments {
+		if err := sd.Validate(); err != nil {
+			return fmt.Errorf("s3 deployment %d (%s): %w", i+1, sd.Bucket, err)
+		}
+	}
+	return nil
+}
+
+// GetEnvironment returns the environment with the given name
+func (d Deployments) GetEnvironment(name string) (Environment, bool) {
+	for _, env := range d.Environments {
+		if env.Name == name {
+			return env, true
+		}
+	}
+	return Environment{}, false
+}
+
+// SetApprovers assigns the resolved approvers to their environments
+func (d *Deployments) SetApprovers(approvers []EnvironmentApprover) {
+	for i := range d.Environments {
+		env := &d.Environments[i]
+		env.ApproverIDs = nil
+		for _, a := range approvers {
+			if a.Environment == env.Name {
+				env.ApproverIDs = append(env.ApproverIDs, a.UserID)
+			}
+		}
+	}
+}
+
+// Environment is a named stage deployment targets belong to. Deployments to an environment with
+// approvers wait until one of them approves.
+type Environment struct {
+	Name string `yaml:"name"`
+	// Approvers are the email addresses or display names of the users who may approve or reject
+	// deployments. They are resolved to users when the build definition is saved.
+	Approvers []string `yaml:"approvers,omitempty"`
+	// ApproverIDs are the IDs of the users the approvers were resolved to
+	ApproverIDs []uint `yaml:"-"`
+	// ApprovalTimeout is the time after which a deployment awaiting approval expires, 24 hours by default
+	ApprovalTimeout time.Duration `yaml:"approval_timeout,omitempty"`
+}
+
+// IsGated checks whether deployments to the environment need to be approved
+func (e Environment) IsGated() bool {
+	return len(e.Approvers) > 0
+}
+
+// IsApprover checks whether the user may approve or reject deployments to the environment. Only the
+// users the approvers were resolved to qualify, never users who merely carry an approver's name.
+func (e Environment) IsApprover(u User) bool {
+	if u.ID == 0 {
+		return false
+	}
+	for _, id := range e.ApproverIDs {
+		if id == u.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetApprovalTimeout returns the time after which a deployment awaiting approval expires
+func (e Environment) GetApprovalTimeout() time.Duration {
+	if e.ApprovalTimeout <= 0 {
+		return 24 * time.Hour
+	}
+	return e.ApprovalTimeout
+}
+
+// LocalDeployment copies the artifact to a path of the build server, or extracts it there
 type LocalDeployment struct {
-	Enabled bool   `yaml:"enabled"`
-	Path    string `yaml:"path"`
+	Enabled bool `yaml:"enabled"`
+	// Path is the file the artifact is copied to. An existing directory or a path ending with a slash
+	// is a directory the artifact is copied into, or extracted into with Extract.
+	Path string `yaml:"path"`
+	// Environment is the name of the environment the target belongs to
+	Environment string `yaml:"environment,omitempty"`
+	// Extract extracts the contents of the artifact into the directory Path instead of copying the artifact
+	Extract bool `yaml:"extract,omitempty"`
+	// Clean replaces the target directory as a whole, so files which are not part of the deployment are removed
+	Clean bool `yaml:"clean,omitempty"`
+	// FileMode is the octal mode of the written files, 0644 by default. Extracted files keep their mode by default.
+	FileMode string `yaml:"file_mode,omitempty"`
+	// DirMode is the octal mode of the created directories, 0755 by default
+	DirMode string `yaml:"dir_mode,omitempty"`
+	// Owner is the user and optionally the group, as user:group, owning the written files and directories.
+	// Both can be given by name or ID.
+	Owner string `yaml:"owner,omitempty"`
+}
+
+// IsDirectory checks whether the path of the deployment is a directory rather than a file
+func (ld LocalDeployment) IsDirectory() bool {
+	if ld.Extract || strings.HasSuffix(ld.Path, "/") || strings.HasSuffix(ld.Path, string(filepath.Separator)) {
+		return true
+	}
+	info, err := os.Stat(ld.Path)
+	return err == nil && info.IsDir()
+}
+
+// GetFileMode returns the mode of the written files
+func (ld LocalDeployment) GetFileMode() (fs.FileMode, error) {
+	return parseMode(ld.FileMode, 0644)
+}
+
+// GetDirMode returns the mode of the created directories
+func (ld LocalDeployment) GetDirMode() (fs.FileMode, error) {
+	return parseMode(ld.DirMode, 0755)
+}
+
+// Validate checks the modes and the owner
+func (ld LocalDeployment) Validate() error {
+	if _, err := ld.GetFileMode(); err != nil {
+		return err
+	}
+	if _, err := ld.GetDirMode(); err != nil {
+		return err
+	}
+	if user, group, _ := strings.Cut(ld.Owner, ":"); ld.Owner != "" && user == "" && group == "" {
+		return fmt.Errorf("invalid owner '%s', expected user:group", ld.Owner)
+	}
+	return nil
+}
+
+// parseMode parses an octal file mode like 0640, returning def for an empty string
+func parseMode(s string, def fs.FileMode) (fs.FileMode, error) {
+	if s == "" {
+		return def, nil
+	}
+	mode, err := strconv.ParseUint(strings.TrimPrefix(s, "0o"), 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid mode '%s', expected an octal mode like 0644", s)
+	}
+	return fs.FileMode(mode), nil
+}
+
+// Describe returns a description of the target of the deployment
+func (ld LocalDeployment) Describe() string {
+	return ld.Path
 }
 
 type EmailDeployment struct {
 	Enabled bool   `yaml:"enabled"`
 	Address string `yaml:"address"`
+	// Environment is the name of the environment the target belongs to
+	Environment string `yaml:"environment,omitempty"`
+}
+
+// Describe returns a description of the target of the deployment
+func (ed EmailDeployment) Describe() string {
+	return "mailto:" + ed.Address
 }
 
 type RemoteDeployment struct {
@@ -46,6 +393,285 @@ type RemoteDeployment struct {
 	WorkingDirectory    string   `yaml:"working_directory"`
 	PreDeploymentSteps  []string `yaml:"pre_deployment_steps"`
 	PostDeploymentSteps []string `yaml:"post_deployment_steps"`
+	// PrivateKey is a PEM encoded private key used instead of or in addition to the password
+	PrivateKey string `yaml:"private_key,omitempty"`
+	// PrivateKeyFile is the path of a private key file on the build server
+	PrivateKeyFile string `yaml:"private_key_file,omitempty"`
+	// Passphrase decrypts a passphrase protected private key
+	Passphrase string `yaml:"passphrase,omitempty"`
+	// UseAgent authenticates using the keys of the ssh-agent the build server can reach via SSH_AUTH_SOCK
+	UseAgent bool `yaml:"use_agent,omitempty"`
+	// HostKeyFingerprint pins the SHA256 fingerprint of the host key, e.g. "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"
+	HostKeyFingerprint string `yaml:"host_key_fingerprint,omitempty"`
+	// TrustOnFirstUse records the host key when connecting to an unknown host instead of refusing the connection
+	TrustOnFirstUse bool `yaml:"trust_on_first_use,omitempty"`
+	// KeepReleases is the number of releases kept in the working directory, defaults to 5
+	KeepReleases int `yaml:"keep_releases,omitempty"`
+	// Environment is the name of the environment the target belongs to
+	Environment string `yaml:"environment,omitempty"`
+	// DisableEPSV makes FTP connections use PASV instead of EPSV for passive mode, for servers behind NAT
+	DisableEPSV bool `yaml:"disable_epsv,omitempty"`
+	// TLSSkipVerify accepts any certificate of an FTPS server
+	TLSSkipVerify bool `yaml:"tls_skip_verify,omitempty"`
+	// TLSCAFile is the path of a PEM file on the build server with the certificates an FTPS server certificate is verified against
+	TLSCAFile string `yaml:"tls_ca_file,omitempty"`
+}
+
+// ConnectionType is the protocol a remote deployment uploads the build with
+type ConnectionType string
+
+const (
+	ConnectionSFTP ConnectionType = "sftp"
+	ConnectionFTP  ConnectionType = "ftp"
+	// ConnectionFTPS is FTP with explicit TLS
+	ConnectionFTPS ConnectionType = "ftps"
+)
+
+// GetConnectionType returns the protocol of the deployment, SFTP by default
+func (rd RemoteDeployment) GetConnectionType() ConnectionType {
+	if rd.ConnectionType == "" {
+		return ConnectionSFTP
+	}
+	return ConnectionType(strings.ToLower(rd.ConnectionType))
+}
+
+// GetPort returns the port of the remote host, which defaults to the port of the connection type
+func (rd RemoteDeployment) GetPort() int {
+	switch {
+	case rd.Port != 0:
+		return rd.Port
+	case rd.GetConnectionType() == ConnectionSFTP:
+		return 22
+	default:
+		return 21
+	}
+}
+
+// SupportsReleases checks whether the deployment uploads into release directories which can be rolled back.
+// This requires symbolic links, which only SFTP can create.
+func (rd RemoteDeployment) SupportsReleases() bool {
+	return rd.GetConnectionType() == ConnectionSFTP
+}
+
+// Validate checks the connection type and whether the settings can be used with it
+func (rd RemoteDeployment) Validate() error {
+	switch rd.GetConnectionType() {
+	case ConnectionSFTP:
+		return nil
+	case ConnectionFTP, ConnectionFTPS:
+		if len(rd.PreDeploymentSteps) > 0 || len(rd.PostDeploymentSteps) > 0 {
+			return fmt.Errorf("pre and post deployment steps require connection type %s", ConnectionSFTP)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown connection type '%s', expected one of %s, %s and %s", rd.ConnectionType, ConnectionSFTP, ConnectionFTP, ConnectionFTPS)
+	}
+}
+
+// Describe returns a description of the target of the deployment, without credentials
+func (rd RemoteDeployment) Describe() string {
+	return fmt.Sprintf("%s://%s@%s%s", rd.GetConnectionType(), rd.Username, net.JoinHostPort(rd.Host, strconv.Itoa(rd.GetPort())), path.Clean("/"+rd.WorkingDirectory))
+}
+
+// GetKeepReleases returns the number of releases to keep on the remote host
+func (rd RemoteDeployment) GetKeepReleases() int {
+	if rd.KeepReleases < 1 {
+		return 5
+	}
+	return rd.KeepReleases
+}
+
+// HTTPBody is the way an HTTP deployment sends the artifact
+type HTTPBody string
+
+const (
+	// HTTPBodyMultipart sends the artifact as a file of a multipart form
+	HTTPBodyMultipart HTTPBody = "multipart"
+	// HTTPBodyRaw sends the artifact as the request body
+	HTTPBodyRaw HTTPBody = "raw"
+)
+
+// HTTPDeployment sends the artifact to a URL, e.g. an artifact repository or an update server
+type HTTPDeployment struct {
+	Enabled bool `yaml:"enabled"`
+	// Method is the HTTP method, POST by default
+	Method string `yaml:"method,omitempty"`
+	URL    string `yaml:"url"`
+	// Headers are added to the request, e.g. an API key
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Username and Password authenticate with basic auth
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	// BearerToken authenticates with an Authorization header instead of basic auth
+	BearerToken string `yaml:"bearer_token,omitempty"`
+	// Body is either multipart (the default) or raw
+	Body HTTPBody `yaml:"body,omitempty"`
+	// FieldName is the name of the form field of the artifact in a multipart body, file by default
+	FieldName string `yaml:"field_name,omitempty"`
+	// Fields are additional form fields of a multipart body
+	Fields map[string]string `yaml:"fields,omitempty"`
+	// ExpectedStatus are the status codes of a successful response, any 2xx status by default
+	ExpectedStatus []int `yaml:"expected_status,omitempty"`
+	// Retries is the number of times a failed request is repeated
+	Retries int `yaml:"retries,omitempty"`
+	// RetryBackoff is the time to wait before the first retry, which doubles for every further retry; 1 second by default
+	RetryBackoff time.Duration `yaml:"retry_backoff,omitempty"`
+	// Timeout limits every single request, 5 minutes by default
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Environment is the name of the environment the target belongs to
+	Environment string `yaml:"environment,omitempty"`
+}
+
+// Describe returns a description of the target of the deployment, without credentials and query
+func (hd HTTPDeployment) Describe() string {
+	u, err := url.Parse(hd.URL)
+	if err != nil {
+		return hd.GetMethod() + " " + hd.URL
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return hd.GetMethod() + " " + u.String()
+}
+
+// GetMethod returns the HTTP method of the request
+func (hd HTTPDeployment) GetMethod() string {
+	if hd.Method == "" {
+		return "POST"
+	}
+	return strings.ToUpper(hd.Method)
+}
+
+// GetBody returns the way the artifact is sent
+func (hd HTTPDeployment) GetBody() HTTPBody {
+	if hd.Body == "" {
+		return HTTPBodyMultipart
+	}
+	return hd.Body
+}
+
+// GetFieldName returns the name of the form field of the artifact
+func (hd HTTPDeployment) GetFieldName() string {
+	if hd.FieldName == "" {
+		return "file"
+	}
+	return hd.FieldName
+}
+
+// IsExpectedStatus checks whether a response with the given status code counts as success
+func (hd HTTPDeployment) IsExpectedStatus(code int) bool {
+	if len(hd.ExpectedStatus) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, c := range hd.ExpectedStatus {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRetryBackoff returns the time to wait before the given retry, starting at 1
+func (hd HTTPDeployment) GetRetryBackoff(retry int) time.Duration {
+	backoff := hd.RetryBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for i := 1; i < retry; i++ {
+		backoff *= 2
+	}
+	return backoff
+}
+
+// GetTimeout returns the time limit of a single request
+func (hd HTTPDeployment) GetTimeout() time.Duration {
+	if hd.Timeout <= 0 {
+		return 5 * time.Minute
+	}
+	return hd.Timeout
+}
+
+// S3Deployment uploads the build directory or the artifact to a bucket of an S3 compatible object storage
+type S3Deployment struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the host of the object storage, optionally with port and scheme; AWS S3 by default
+	Endpoint string `yaml:"endpoint,omitempty"`
+	Bucket   string `yaml:"bucket"`
+	// Prefix is prepended to the keys of the uploaded objects, like a directory
+	Prefix          string `yaml:"prefix,omitempty"`
+	Region          string `yaml:"region,omitempty"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	// PathStyle addresses the bucket in the path instead of the host name, which some storages require
+	PathStyle bool `yaml:"path_style,omitempty"`
+	// Artifact uploads the artifact only instead of the build directory
+	Artifact bool `yaml:"artifact,omitempty"`
+	// Public makes the uploaded objects readable by anyone
+	Public bool `yaml:"public,omitempty"`
+	// Sync removes the objects below the prefix which were not uploaded
+	Sync bool `yaml:"sync,omitempty"`
+	// SyncWholeBucket allows Sync without prefix, which removes every other object of the bucket
+	SyncWholeBucket bool `yaml:"sync_whole_bucket,omitempty"`
+	// Environment is the name of the environment the target belongs to
+	Environment string `yaml:"environment,omitempty"`
+}
+
+// Validate checks that a bucket is set and that sync cannot empty the bucket by accident
+func (sd S3Deployment) Validate() error {
+	if sd.Bucket == "" {
+		return fmt.Errorf("no bucket set")
+	}
+	if sd.Sync && sd.GetPrefix() == "" && !sd.SyncWholeBucket {
+		return fmt.Errorf("sync without prefix removes all other objects of the bucket, set sync_whole_bucket to allow it")
+	}
+	return nil
+}
+
+// Describe returns a description of the target of the deployment, without credentials
+func (sd S3Deployment) Describe() string {
+	return fmt.Sprintf("s3://%s/%s (%s)", sd.Bucket, sd.GetPrefix(), sd.GetEndpoint())
+}
+
+// GetEndpoint returns the endpoint of the object storage
+func (sd S3Deployment) GetEndpoint() string {
+	if sd.Endpoint == "" {
+		return "s3.amazonaws.com"
+	}
+	return sd.Endpoint
+}
+
+// GetPrefix returns the prefix of the object keys, which is either empty or ends with a slash
+func (sd S3Deployment) GetPrefix() string {
+	prefix := strings.Trim(sd.Prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// GetPullRequestSteps returns the steps of the sections which run for pull requests
+func (bdc *BuildDefinitionContent) GetPullRequestSteps() ([]string, error) {
+	if len(bdc.PullRequest.Steps) == 0 {
+		return bdc.GetSteps(), nil
+	}
+
+	sections := map[string][]string{
+		"setup":      bdc.Setup,
+		"test":       bdc.Test,
+		"pre_build":  bdc.PreBuild,
+		"build":      bdc.Build,
+		"post_build": bdc.PostBuild,
+	}
+	allSteps := make([]string, 0)
+	for _, name := range bdc.PullRequest.Steps {
+		steps, ok := sections[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown section %s in pull_request steps", name)
+		}
+		allSteps = append(allSteps, steps...)
+	}
+
+	return allSteps, nil
 }
 
 func (bdc *BuildDefinitionContent) GetSteps() []string {
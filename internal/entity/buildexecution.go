@@ -1,8 +1,11 @@
 package entity
 
 import (
-	"gorm.io/gorm"
+	"encoding/json"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // BuildExecution consists of metadata for a build definition
@@ -10,11 +13,25 @@ type BuildExecution struct {
 	gorm.Model
 	BuildDefinitionID uint
 	ManuallyRunBy     uint
+	Branch            string
+	Tag               string
+	Ref               string
+	CommitSHA         string
+	CommitMessage     string `gorm:"type:text"`
+	CommitAuthor      string
+	CommitURL         string
+	Release           bool
+	PullRequest       int
+	PullRequestURL    string
+	Version           string
 	ActionLog         string
 	Status            BuildStatus
 	ArtifactPath      string
 	ExecutionTime     float64
 	ExecutedAt        time.Time
+	Parameters        string
+	// SupersededBy is the commit of the newer build which superseded this one, if known
+	SupersededBy string
 }
 
 func NewBuildExecution(bdID, userID uint) *BuildExecution {
@@ -29,3 +46,77 @@ func NewBuildExecution(bdID, userID uint) *BuildExecution {
 		ExecutedAt:        time.Now(),
 	}
 }
+
+// SetRef records the branch or tag the execution builds. Builds of a tag are releases.
+func (be *BuildExecution) SetRef(ref GitRef) {
+	be.Branch = ref.Branch
+	be.Tag = ref.Tag
+	be.Ref = ref.Ref
+	be.Release = ref.IsTag()
+}
+
+// GetRef returns the branch or tag the execution builds
+func (be BuildExecution) GetRef() GitRef {
+	return GitRef{Branch: be.Branch, Tag: be.Tag, Ref: be.Ref}
+}
+
+// SetCommit records the commit the execution builds. Empty values of the commit do not
+// overwrite values already known.
+func (be *BuildExecution) SetCommit(c WebhookCommit) {
+	if c.SHA != "" {
+		be.CommitSHA = c.SHA
+	}
+	if c.Message != "" {
+		be.CommitMessage = strings.TrimSpace(c.Message)
+	}
+	if c.Author != "" {
+		be.CommitAuthor = c.Author
+	}
+	if c.URL != "" {
+		be.CommitURL = c.URL
+	}
+}
+
+// ShortCommitSHA returns the abbreviated SHA of the commit the execution builds
+func (be BuildExecution) ShortCommitSHA() string {
+	if len(be.CommitSHA) > 7 {
+		return be.CommitSHA[:7]
+	}
+	return be.CommitSHA
+}
+
+// CommitSubject returns the first line of the commit message
+func (be BuildExecution) CommitSubject() string {
+	subject, _, _ := strings.Cut(be.CommitMessage, "\n")
+	return strings.TrimSpace(subject)
+}
+
+// SetPullRequest records the pull request the execution builds
+func (be *BuildExecution) SetPullRequest(pr *WebhookPullRequest) {
+	be.PullRequest = pr.Number
+	be.PullRequestURL = pr.URL
+}
+
+// IsPullRequest checks whether the execution builds a pull request
+func (be BuildExecution) IsPullRequest() bool {
+	return be.PullRequest > 0
+}
+
+// GetParameters returns the build parameters the execution was run with
+func (be BuildExecution) GetParameters() map[string]string {
+	params := make(map[string]string)
+	if be.Parameters != "" {
+		_ = json.Unmarshal([]byte(be.Parameters), &params)
+	}
+	return params
+}
+
+// SetParameters records the build parameters the execution is run with
+func (be *BuildExecution) SetParameters(params map[string]string) {
+	if len(params) == 0 {
+		be.Parameters = ""
+		return
+	}
+	b, _ := json.Marshal(params)
+	be.Parameters = string(b)
+}
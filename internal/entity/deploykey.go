@@ -0,0 +1,15 @@
+package entity
+
+import "gorm.io/gorm"
+
+// DeployKey is the SSH key a build definition uses to access its repository. Only the public key
+// is ever shown; it has to be added to the repository at the git hoster.
+type DeployKey struct {
+	gorm.Model
+	BuildDefinitionID uint   `gorm:"uniqueIndex"`
+	PublicKey         string `gorm:"type:text"`
+	// PrivateKey is the PEM encoded private key, stored encrypted
+	PrivateKey  string `gorm:"type:text"`
+	Fingerprint string
+	CreatedBy   uint
+}
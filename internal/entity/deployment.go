@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeploymentKind is the kind of target a deployment deploys to
+type DeploymentKind string
+
+const (
+	DeploymentLocal  DeploymentKind = "local"
+	DeploymentEmail  DeploymentKind = "email"
+	DeploymentRemote DeploymentKind = "remote"
+	DeploymentHTTP   DeploymentKind = "http"
+	DeploymentS3     DeploymentKind = "s3"
+)
+
+// Deployment is the deployment of the artifact of a build execution to a single target.
+// Redeployments and retries create new deployments.
+type Deployment struct {
+	gorm.Model
+	BuildDefinitionID uint `gorm:"index"`
+	BuildExecutionID  uint `gorm:"index"`
+	Kind              DeploymentKind
+	// Environment is the name of the environment the target belongs to, if any
+	Environment string
+	// Index is the position of the target within the deployments of its kind in the build definition
+	Index int
+	// Target describes the target, e.g. the path of a local deployment
+	Target string
+	// Release is the name of the release directory of a successful remote deployment
+	Release string
+	Status  BuildStatus
+	Log     string `gorm:"type:text"`
+	// TriggeredBy is the ID of the user who redeployed, 0 for deployments of a build
+	TriggeredBy uint
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	// ExpiresAt is the time until which a deployment to a gated environment can be approved
+	ExpiresAt time.Time
+	// DecidedBy is the ID of the user who approved or rejected the deployment
+	DecidedBy uint
+	DecidedAt time.Time
+}
+
+// Finished reports whether the deployment is done, successful or not
+func (d Deployment) Finished() bool {
+	return !d.FinishedAt.IsZero()
+}
+
+// Duration returns how long the deployment took, rounded to milliseconds
+func (d Deployment) Duration() time.Duration {
+	if d.StartedAt.IsZero() || !d.Finished() {
+		return 0
+	}
+	return d.FinishedAt.Sub(d.StartedAt).Round(time.Millisecond)
+}
+
+// AwaitsApproval reports whether the deployment waits for the approval of its environment
+func (d Deployment) AwaitsApproval() bool {
+	return d.Status == StatusAwaitingApproval
+}
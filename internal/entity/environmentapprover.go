@@ -0,0 +1,13 @@
+package entity
+
+import "gorm.io/gorm"
+
+// EnvironmentApprover is a user who may approve deployments to an environment of a build definition.
+// The approvers listed in the build definition are resolved to users when it is saved, so renaming
+// a user account later does not grant or revoke the permission.
+type EnvironmentApprover struct {
+	gorm.Model
+	BuildDefinitionID uint   `gorm:"index"`
+	Environment       string `gorm:"size:255"`
+	UserID            uint
+}
@@ -23,11 +23,11 @@ type GiteaPushPayload struct {
 			Email    string `json:"Email"`
 			Username string `json:"username"`
 		} `json:"committer"`
-		Verification interface{}   `json:"verification"`
-		Timestamp    time.Time     `json:"timestamp"`
-		Added        []interface{} `json:"added"`
-		Removed      []interface{} `json:"removed"`
-		Modified     []string      `json:"modified"`
+		Verification interface{} `json:"verification"`
+		Timestamp    time.Time   `json:"timestamp"`
+		Added        []string    `json:"added"`
+		Removed      []string    `json:"removed"`
+		Modified     []string    `json:"modified"`
 	} `json:"commits"`
 	HeadCommit interface{} `json:"head_commit"`
 	Repository struct {
@@ -114,3 +114,28 @@ type GiteaPushPayload struct {
 		Username  string    `json:"username"`
 	} `json:"sender"`
 }
+
+// GiteaPullRequestPayload represents the webhook payload of a pull request event from Gitea
+type GiteaPullRequestPayload struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		HTMLURL string `json:"html_url"`
+		Title   string `json:"title"`
+		Head    struct {
+			Ref    string `json:"ref"`
+			SHA    string `json:"sha"`
+			RepoID int    `json:"repo_id"`
+		} `json:"head"`
+		Base struct {
+			Ref    string `json:"ref"`
+			RepoID int    `json:"repo_id"`
+		} `json:"base"`
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender struct {
+		Username string `json:"username"`
+	} `json:"sender"`
+}
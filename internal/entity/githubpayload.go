@@ -151,9 +151,9 @@ type GitHubPushPayload struct {
 			Email    string `json:"email"`
 			Username string `json:"username"`
 		} `json:"committer"`
-		Added    []interface{} `json:"added"`
-		Removed  []interface{} `json:"removed"`
-		Modified []string      `json:"modified"`
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
 	} `json:"commits"`
 	HeadCommit struct {
 		ID        string    `json:"id"`
@@ -172,8 +172,34 @@ type GitHubPushPayload struct {
 			Email    string `json:"email"`
 			Username string `json:"username"`
 		} `json:"committer"`
-		Added    []interface{} `json:"added"`
-		Removed  []interface{} `json:"removed"`
-		Modified []string      `json:"modified"`
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
 	} `json:"head_commit"`
 }
+
+// GitHubPullRequestPayload represents the webhook payload of a pull request event from GitHub
+type GitHubPullRequestPayload struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		HTMLURL string `json:"html_url"`
+		Title   string `json:"title"`
+		Head    struct {
+			Ref  string `json:"ref"`
+			SHA  string `json:"sha"`
+			Repo struct {
+				FullName string `json:"full_name"`
+			} `json:"repo"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+}
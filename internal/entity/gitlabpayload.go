@@ -51,9 +51,34 @@ type GitLabPushPayload struct {
 			Name  string `json:"name"`
 			Email string `json:"Email"`
 		} `json:"author"`
-		Added    []string      `json:"added"`
-		Modified []string      `json:"modified"`
-		Removed  []interface{} `json:"removed"`
+		Added    []string `json:"added"`
+		Modified []string `json:"modified"`
+		Removed  []string `json:"removed"`
 	} `json:"commits"`
 	TotalCommitsCount int `json:"total_commits_count"`
 }
+
+// GitLabMergeRequestPayload represents the webhook payload of a merge request event from GitLab
+type GitLabMergeRequestPayload struct {
+	ObjectKind string `json:"object_kind"`
+	User       struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID             int    `json:"iid"`
+		Title           string `json:"title"`
+		URL             string `json:"url"`
+		Action          string `json:"action"`
+		OldRev          string `json:"oldrev"`
+		SourceBranch    string `json:"source_branch"`
+		TargetBranch    string `json:"target_branch"`
+		SourceProjectID int    `json:"source_project_id"`
+		TargetProjectID int    `json:"target_project_id"`
+		LastCommit      struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+	} `json:"object_attributes"`
+}
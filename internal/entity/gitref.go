@@ -0,0 +1,22 @@
+package entity
+
+// GitRef is the branch or tag a build is triggered for. Exactly one of both is set.
+// If Ref is set, e.g. to "refs/pull/1/head" for pull requests, that ref is checked out instead.
+type GitRef struct {
+	Branch string
+	Tag    string
+	Ref    string
+}
+
+// IsTag checks whether the ref refers to a tag
+func (r GitRef) IsTag() bool {
+	return r.Tag != ""
+}
+
+// Name returns the name of the branch or tag
+func (r GitRef) Name() string {
+	if r.IsTag() {
+		return r.Tag
+	}
+	return r.Branch
+}
@@ -0,0 +1,21 @@
+package entity
+
+import "gorm.io/gorm"
+
+// KnownHost is a trusted host key of an SSH server deployments connect to
+type KnownHost struct {
+	gorm.Model
+	// Host is the normalized address, e.g. "example.com" for port 22 or "[example.com]:2222" otherwise
+	Host      string `gorm:"index;size:255"`
+	KeyType   string
+	PublicKey string `gorm:"type:text"`
+	// Fingerprint is the SHA256 fingerprint of the public key
+	Fingerprint string
+	// AddedBy is the user who added the key; 0 if it was trusted on first use
+	AddedBy uint
+}
+
+// TrustedOnFirstUse checks whether the key was recorded when first connecting to the host
+func (kh KnownHost) TrustedOnFirstUse() bool {
+	return kh.AddedBy == 0
+}
@@ -0,0 +1,22 @@
+package entity
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PollState is the commit a ref of a polled repository pointed to when it was last polled.
+// A poll state without ref marks that the repository of the build definition has been polled.
+type PollState struct {
+	gorm.Model
+	BuildDefinitionID uint   `gorm:"uniqueIndex:idx_poll_state"`
+	Ref               string `gorm:"uniqueIndex:idx_poll_state;size:255"`
+	SHA               string
+	PolledAt          time.Time
+}
+
+// IsMarker checks whether the poll state only marks that the repository has been polled
+func (ps PollState) IsMarker() bool {
+	return ps.Ref == ""
+}
@@ -9,7 +9,12 @@ const (
 	StatusRunning            BuildStatus = "running"
 	StatusPartiallySucceeded BuildStatus = "partially_succeeded"
 	StatusCanceled           BuildStatus = "canceled"
+	StatusSuperseded         BuildStatus = "superseded"
 	StatusUnknown            BuildStatus = "unknown"
+	// StatusAwaitingApproval, StatusRejected and StatusExpired are only used for deployments to gated environments
+	StatusAwaitingApproval BuildStatus = "awaiting_approval"
+	StatusRejected         BuildStatus = "rejected"
+	StatusExpired          BuildStatus = "expired"
 )
 
 func (bs BuildStatus) String() string {
@@ -2,12 +2,52 @@ package entity
 
 import "gorm.io/gorm"
 
+// SecretMask is displayed instead of secret values
+const SecretMask = "***"
+
+// VariableScope determines where a variable is available
+type VariableScope string
+
+const (
+	// VariableScopeGlobal variables are managed by administrators and available to every build definition
+	VariableScopeGlobal VariableScope = "global"
+	// VariableScopeUser variables belong to a user and are available to the build definitions of that user
+	// and, if public, to the build definitions of every other user
+	VariableScopeUser VariableScope = "user"
+	// VariableScopeDefinition variables are only available to a specific build definition
+	VariableScopeDefinition VariableScope = "definition"
+)
+
+func (vs VariableScope) String() string {
+	return string(vs)
+}
+
 // UserVariable has a name and a value and is, if available,
 // programmatically inserted into the content of a build definition
 type UserVariable struct {
 	gorm.Model
-	UserEntryID uint
-	Variable    string
-	Value       string
-	Public      bool
+	UserEntryID       uint
+	Variable          string
+	Value             string
+	Public            bool
+	Secret            bool
+	Scope             VariableScope `gorm:"type:varchar(20);default:user"`
+	BuildDefinitionID uint
+}
+
+// MaskedValue returns the value of the variable, if it is not a secret
+func (uv UserVariable) MaskedValue() string {
+	if uv.Secret {
+		return SecretMask
+	}
+	return uv.Value
+}
+
+// GetScope returns the scope of the variable; variables without
+// an explicit scope are user variables
+func (uv UserVariable) GetScope() VariableScope {
+	if uv.Scope == "" {
+		return VariableScopeUser
+	}
+	return uv.Scope
 }
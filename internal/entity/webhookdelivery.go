@@ -0,0 +1,108 @@
+package entity
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// DeliveryVerdict is the outcome of processing a webhook delivery
+type DeliveryVerdict string
+
+const (
+	// DeliveryAccepted means the delivery triggered a build
+	DeliveryAccepted DeliveryVerdict = "accepted"
+	// DeliveryIgnored means the delivery was valid, but did not trigger a build
+	DeliveryIgnored DeliveryVerdict = "ignored"
+	// DeliverySkipped means the delivery would have triggered a build, but was skipped due to
+	// a path filter or a commit message directive
+	DeliverySkipped DeliveryVerdict = "skipped"
+	// DeliveryRejected means the delivery was invalid, e.g. failed verification
+	DeliveryRejected DeliveryVerdict = "rejected"
+)
+
+// sensitiveHeaders are masked when a delivery is recorded and displayed, as they might contain credentials
+var sensitiveHeaders = []string{"Authorization", "Cookie", "X-Gitlab-Token", "X-Gitea-Signature-Token", "X-Webhook-Secret", "X-Webhook-Signature"}
+
+// maskedValue replaces the values of sensitive headers
+const maskedValue = "********"
+
+// WebhookDelivery is an incoming webhook request as received, together with the outcome
+// of its processing. Deliveries can be replayed for debugging purposes.
+type WebhookDelivery struct {
+	gorm.Model
+	BuildDefinitionID uint
+	BuildExecutionID  uint
+	// ReplayOf is the ID of the delivery this one is a replay of
+	ReplayOf   uint
+	ReplayedBy uint
+	Hoster     string
+	Event      string
+	Ref        string
+	RemoteAddr string
+	Headers    string `gorm:"type:text"`
+	Body       string `gorm:"type:longtext"`
+	Verdict    DeliveryVerdict
+	Reason     string `gorm:"type:text"`
+	StatusCode int
+	// Verified is set once the signature or token of the delivery was verified. As the credentials
+	// are not recorded, replays of verified deliveries are not verified again.
+	Verified bool
+}
+
+// SetHeaders records the request headers of the delivery. The values of headers which might contain
+// credentials are masked, as well as those of the additionally given sensitive headers.
+func (d *WebhookDelivery) SetHeaders(h http.Header, sensitive ...string) {
+	masked := make(http.Header, len(h))
+	for name, values := range h {
+		masked[name] = values
+		if isSensitive(name, sensitive) {
+			masked[name] = []string{maskedValue}
+		}
+	}
+	b, _ := json.Marshal(masked)
+	d.Headers = string(b)
+}
+
+// GetHeaders returns the request headers of the delivery
+func (d WebhookDelivery) GetHeaders() http.Header {
+	h := make(http.Header)
+	if d.Headers != "" {
+		_ = json.Unmarshal([]byte(d.Headers), &h)
+	}
+	return h
+}
+
+// DisplayHeaders returns the request headers as sorted lines of "Name: value", with the values
+// of headers which might contain credentials and the additionally given sensitive headers masked.
+// Deliveries recorded before the headers were masked on recording are masked this way as well.
+func (d WebhookDelivery) DisplayHeaders(sensitive ...string) []string {
+	h := d.GetHeaders()
+	lines := make([]string, 0, len(h))
+	for name, values := range h {
+		for _, v := range values {
+			if isSensitive(name, sensitive) {
+				v = maskedValue
+			}
+			lines = append(lines, name+": "+v)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func isSensitive(name string, additional []string) bool {
+	matches := func(s string) bool {
+		return strings.EqualFold(name, s)
+	}
+	return slices.ContainsFunc(sensitiveHeaders, matches) || slices.ContainsFunc(additional, matches)
+}
+
+// IsReplay checks whether the delivery is a replay of an earlier one
+func (d WebhookDelivery) IsReplay() bool {
+	return d.ReplayOf > 0
+}
@@ -0,0 +1,102 @@
+package entity
+
+import "strings"
+
+// EventKind is the kind of event a git hoster sent a webhook request for
+type EventKind string
+
+const (
+	EventKindPush        EventKind = "push"
+	EventKindTag         EventKind = "tag"
+	EventKindPullRequest EventKind = "pull_request"
+	EventKindPing        EventKind = "ping"
+	EventKindOther       EventKind = "other"
+)
+
+// PullRequestAction is what happened to a pull request
+type PullRequestAction string
+
+const (
+	PullRequestOpened  PullRequestAction = "opened"
+	PullRequestUpdated PullRequestAction = "updated"
+	PullRequestClosed  PullRequestAction = "closed"
+	PullRequestOther   PullRequestAction = "other"
+)
+
+// WebhookEvent is the hoster independent representation of a webhook request
+type WebhookEvent struct {
+	GitRef
+	// Kind is the kind of event; only push, tag and pull request events trigger builds
+	Kind EventKind
+	// Type is the event type as sent by the hoster, e.g. "push" or "Tag Push Hook"
+	Type string
+	// Ref is the full ref, e.g. "refs/heads/main"
+	Ref string
+	// Before and After are the commit SHAs the ref pointed to before and after the push
+	Before     string
+	After      string
+	Commits    []WebhookCommit
+	Pusher     string
+	Repository string
+	// PullRequest is only set for pull request events
+	PullRequest *WebhookPullRequest
+}
+
+// WebhookPullRequest is a pull request (or merge request, in GitLab's terms) which was opened or updated
+type WebhookPullRequest struct {
+	Number       int
+	Title        string
+	URL          string
+	Action       PullRequestAction
+	SourceBranch string
+	TargetBranch string
+	// HeadRef is the ref pointing to the head commit of the pull request
+	HeadRef string
+	// MergeRef is the ref pointing to the merge commit, if the hoster provides one
+	MergeRef string
+	HeadSHA  string
+	// FromFork is set if the source branch belongs to another repository
+	FromFork bool
+}
+
+// WebhookCommit is a single commit contained in a push event
+type WebhookCommit struct {
+	SHA      string
+	Message  string
+	Author   string
+	URL      string
+	Added    []string
+	Modified []string
+	Removed  []string
+}
+
+// HeadCommit returns the commit the ref points to after the push, if contained in the event
+func (e *WebhookEvent) HeadCommit() (WebhookCommit, bool) {
+	if len(e.Commits) == 0 {
+		return WebhookCommit{}, false
+	}
+	for _, c := range e.Commits {
+		if c.SHA != "" && c.SHA == e.After {
+			return c, true
+		}
+	}
+	// the head commit is the one pushed last
+	return e.Commits[len(e.Commits)-1], true
+}
+
+// IsBuildable checks whether the event is supposed to trigger a build
+func (e *WebhookEvent) IsBuildable() bool {
+	switch e.Kind {
+	case EventKindPush, EventKindTag:
+		return !e.IsDeletion()
+	case EventKindPullRequest:
+		return e.PullRequest != nil && (e.PullRequest.Action == PullRequestOpened || e.PullRequest.Action == PullRequestUpdated)
+	default:
+		return false
+	}
+}
+
+// IsDeletion checks whether the event is the deletion of a branch or tag
+func (e *WebhookEvent) IsDeletion() bool {
+	return e.After == "" || strings.Trim(e.After, "0") == ""
+}
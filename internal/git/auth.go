@@ -0,0 +1,87 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+)
+
+// credentialHelper hands the credentials from the environment to git, so they never appear in
+// urls, process listings or the output of git
+const credentialHelper = `!f() { test "$1" = get && printf 'username=%s\npassword=%s\n' "$TBS_GIT_USERNAME" "$TBS_GIT_PASSWORD"; }; f`
+
+// Auth holds the credentials used to access a remote repository, either a username and password
+// for HTTPS or a private key for SSH
+type Auth struct {
+	Username string
+	Password string
+	// PrivateKey is the PEM encoded private SSH key
+	PrivateKey string
+	// KnownHostsFile is the known_hosts file used instead of the one of the user running the server.
+	// Unknown hosts are added on first use, changed host keys are rejected.
+	KnownHostsFile string
+}
+
+// Prepare returns the global options and the environment for git commands accessing the remote
+// repository with the credentials. The returned func removes temporary files and has to be called
+// once the commands are done.
+func (a Auth) Prepare() ([]string, []string, func(), error) {
+	var (
+		args    []string
+		env     = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		cleanup = func() {}
+	)
+
+	if a.Password != "" {
+		username := a.Username
+		if username == "" {
+			username = "nobody"
+		}
+		// the first, empty helper disables helpers configured elsewhere, which might store the credentials
+		args = append(args, "-c", "credential.helper=", "-c", "credential.helper="+credentialHelper)
+		env = append(env, "TBS_GIT_USERNAME="+username, "TBS_GIT_PASSWORD="+a.Password)
+	}
+
+	if a.PrivateKey != "" || a.KnownHostsFile != "" {
+		sshCommand := []string{"ssh", "-o", "BatchMode=yes"}
+		if a.PrivateKey != "" {
+			keyFile, err := writeKeyFile(a.PrivateKey)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			cleanup = func() { _ = os.Remove(keyFile) }
+			sshCommand = append(sshCommand, "-i", keyFile, "-o", "IdentitiesOnly=yes")
+		}
+		if a.KnownHostsFile != "" {
+			if err := os.MkdirAll(filepath.Dir(a.KnownHostsFile), 0700); err != nil {
+				cleanup()
+				return nil, nil, nil, err
+			}
+			sshCommand = append(sshCommand, "-o", "UserKnownHostsFile="+a.KnownHostsFile, "-o", "StrictHostKeyChecking=accept-new")
+		}
+		env = append(env, "GIT_SSH_COMMAND="+shellquote.Join(sshCommand...))
+	}
+
+	return args, env, cleanup, nil
+}
+
+// writeKeyFile writes the private key into a temporary file only readable by the current user
+func writeKeyFile(key string) (string, error) {
+	f, err := os.CreateTemp("", "tbs-key-")
+	if err != nil {
+		return "", err
+	}
+	// ssh refuses keys without a trailing newline
+	if _, err = f.WriteString(strings.TrimSpace(key) + "\n"); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	if err = f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -1,7 +1,12 @@
 package git
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
 	"os/exec"
+	"slices"
 	"strings"
 )
 
@@ -19,3 +24,153 @@ func GetCurrentVersionTag() string {
 
 	return ""
 }
+
+// Describe returns a version for the checked out commit of the repository in the given
+// directory. It is derived from the most recent tag, e.g. "v1.2.0-3-gabc1234", or
+// the abbreviated commit hash, if there is no tag at all.
+func Describe(ctx context.Context, dir string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "describe", "--tags", "--always")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// IsCommitSHA checks whether s is a full commit hash, i.e. 40 (SHA-1) or 64 (SHA-256) lowercase
+// hex characters. Hashes taken from requests have to be checked before they are passed to git.
+func IsCommitSHA(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Commit is a commit of a repository
+type Commit struct {
+	SHA     string
+	Author  string
+	Message string
+}
+
+// HeadCommitInfo returns the SHA, author and message of the checked out commit of the repository
+// in the given directory
+func HeadCommitInfo(ctx context.Context, dir string) (Commit, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "log", "-1", "--format=%H%x00%an <%ae>%x00%B")
+	output, err := cmd.Output()
+	if err != nil {
+		return Commit{}, err
+	}
+
+	return parseCommitInfo(string(output))
+}
+
+func parseCommitInfo(output string) (Commit, error) {
+	parts := strings.SplitN(output, "\x00", 3)
+	if len(parts) != 3 {
+		return Commit{}, fmt.Errorf("unexpected git log output %q", output)
+	}
+
+	return Commit{
+		SHA:     strings.TrimSpace(parts[0]),
+		Author:  strings.TrimSpace(parts[1]),
+		Message: strings.TrimSpace(parts[2]),
+	}, nil
+}
+
+// LsRemote lists the branches and tags of the remote repository with the commits they point to,
+// keyed by the full ref, e.g. "refs/heads/main". Annotated tags are resolved to their commit.
+func LsRemote(ctx context.Context, url string, auth Auth) (map[string]string, error) {
+	opts, env, cleanup, err := auth.Prepare()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	cmd := exec.CommandContext(ctx, "git", append(opts, "ls-remote", "--heads", "--tags", url)...)
+	cmd.Env = env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", err.Error(), strings.TrimSpace(stderr.String()))
+	}
+
+	return ParseLsRemote(string(output)), nil
+}
+
+// ParseLsRemote parses the output of git ls-remote
+func ParseLsRemote(output string) map[string]string {
+	refs := make(map[string]string)
+	for _, line := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		sha, ref, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok {
+			continue
+		}
+		// the peeled entry of an annotated tag is the commit, which takes precedence
+		if peeled := strings.TrimSuffix(ref, "^{}"); peeled != ref {
+			refs[peeled] = sha
+			continue
+		}
+		if _, exists := refs[ref]; !exists {
+			refs[ref] = sha
+		}
+	}
+	return refs
+}
+
+// ChangedFiles fetches the given refspecs of the remote repository into a temporary bare repository,
+// without file contents, and returns the files changed between the two commits of the given range,
+// e.g. "<before>..<after>" or "<base>...<head>".
+func ChangedFiles(ctx context.Context, url string, auth Auth, refspecs []string, diffRange string) ([]string, error) {
+	opts, env, cleanup, err := auth.Prepare()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	dir, err := os.MkdirTemp("", "tbs-diff-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	run := func(args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", slices.Concat(opts, []string{"-C", dir}, args)...)
+		cmd.Env = env
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %s: %s", args[0], err.Error(), strings.TrimSpace(stderr.String()))
+		}
+		return string(output), nil
+	}
+
+	if _, err = run("init", "--bare", "--quiet"); err != nil {
+		return nil, err
+	}
+	// the file names are part of the trees, so the blobs are not needed
+	fetchArgs := append([]string{"fetch", "--quiet", "--no-tags", "--filter=blob:none", "--end-of-options", url}, refspecs...)
+	if _, err = run(fetchArgs...); err != nil {
+		return nil, err
+	}
+	output, err := run("diff", "--name-only", "--no-renames", "--end-of-options", diffRange)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
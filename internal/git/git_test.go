@@ -0,0 +1,126 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLsRemote(t *testing.T) {
+	output := "1316f73b181936990972ab07e3d6c215367bf8cc\trefs/heads/main\n" +
+		"0311ed5c6bd5d9ed16f7520f62e04c051d748090\trefs/heads/feature/x\n" +
+		"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa\trefs/tags/v1.0.0\n" +
+		"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb\trefs/tags/v1.0.0^{}\n" +
+		"cccccccccccccccccccccccccccccccccccccccc\trefs/tags/v0.9.0\r\n"
+
+	want := map[string]string{
+		"refs/heads/main":      "1316f73b181936990972ab07e3d6c215367bf8cc",
+		"refs/heads/feature/x": "0311ed5c6bd5d9ed16f7520f62e04c051d748090",
+		"refs/tags/v1.0.0":     "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+		"refs/tags/v0.9.0":     "cccccccccccccccccccccccccccccccccccccccc",
+	}
+	if got := ParseLsRemote(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestIsCommitSHA(t *testing.T) {
+	tests := map[string]bool{
+		"1316f73b181936990972ab07e3d6c215367bf8cc":                         true,
+		"0311ed5c6bd5d9ed16f7520f62e04c051d7480900311ed5c6bd5d9ed16f75200": true,
+		"1316F73B181936990972AB07E3D6C215367BF8CC":                         false,
+		"1316f73": false,
+		"--output=/tmp/x..1316f73b181936990972ab07": false,
+		"": false,
+	}
+	for s, want := range tests {
+		if got := IsCommitSHA(s); got != want {
+			t.Errorf("IsCommitSHA(%q): expected %v, got %v", s, want, got)
+		}
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %s: %s", args, err.Error(), output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	write := func(name string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name+time.Now().String()), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("init", "--quiet", "--initial-branch=main")
+	write("main.go")
+	run("add", "-A")
+	run("commit", "--quiet", "-m", "initial")
+	before := run("rev-parse", "HEAD")
+
+	write("docs/index.md")
+	write("main.go")
+	run("add", "-A")
+	run("commit", "--quiet", "-m", "change")
+	after := run("rev-parse", "HEAD")
+
+	files, err := ChangedFiles(context.Background(), dir, Auth{}, []string{"+refs/heads/main:refs/tbs/head"}, before+".."+after)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	want := []string{"docs/index.md", "main.go"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("expected %v, got %v", want, files)
+	}
+
+	// a range looking like an option is not taken as such
+	output := filepath.Join(t.TempDir(), "output")
+	if _, err = ChangedFiles(context.Background(), dir, Auth{}, []string{"+refs/heads/main:refs/tbs/head"}, "--output="+output); err == nil {
+		t.Error("expected the range to be refused")
+	}
+	if _, err = os.Stat(output + ".."); !os.IsNotExist(err) {
+		t.Errorf("expected no file to be written, got %v", err)
+	}
+	if _, err = os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("expected no file to be written, got %v", err)
+	}
+}
+
+func TestParseCommitInfo(t *testing.T) {
+	output := "1316f73b181936990972ab07e3d6c215367bf8cc\x00Jane Doe <jane@example.com>\x00Fix the build\n\nThe tests were flaky.\n\n"
+	want := Commit{
+		SHA:     "1316f73b181936990972ab07e3d6c215367bf8cc",
+		Author:  "Jane Doe <jane@example.com>",
+		Message: "Fix the build\n\nThe tests were flaky.",
+	}
+	got, err := parseCommitInfo(output)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	if _, err = parseCommitInfo("1316f73b"); err == nil {
+		t.Error("expected an error for incomplete output")
+	}
+}
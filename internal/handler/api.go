@@ -2,8 +2,10 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
@@ -13,65 +15,89 @@ import (
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/builder"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/buildservice"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/deploymentservice"
-	"github.com/KaiserWerk/Tiny-Build-Server/internal/logging"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/common"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/git"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/network"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/scheduler"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/security"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/statusreporter"
 )
 
-type job struct {
-	local  *entity.LocalDeployment
-	email  *entity.EmailDeployment
-	remote *entity.RemoteDeployment
-	err    error
-}
-
-func (j job) nil() bool {
-	return j.local == nil && j.email == nil && j.remote == nil
-}
-
-const errMsg = "failed %s deployment: %s"
+const (
+	// maxPayloadSize is the maximum size of a webhook payload which is accepted
+	maxPayloadSize = 25 << 20
+	// diffTimeout limits the time to determine the changed files of a push using git
+	diffTimeout = 15 * time.Second
+	// deliveriesToKeep is the number of webhook deliveries kept per build definition
+	deliveriesToKeep = 100
+)
 
 // PayloadReceiveHandler takes care of accepting the payload from the webhook HTTP call
-// sent by a Git hoster
+// sent by a Git hoster. Every delivery is recorded together with the outcome.
 func (h *HTTPHandler) PayloadReceiveHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	logger := h.ContextLogger("PayloadReceiveHandler")
 
-	// get token
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		logger.Error("missing token")
-		http.Error(w, "could not determine token", http.StatusBadRequest)
+	// the signature is computed over the exact bytes sent, so keep them for the verification
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not read request body")
+		http.Error(w, "could not read request body", http.StatusBadRequest)
 		return
 	}
 
-	// find build definition by token
-	bd, err := h.DBService.FindBuildDefinition("token = ?", token)
-	if err != nil {
+	delivery := entity.WebhookDelivery{
+		RemoteAddr: r.RemoteAddr,
+		Body:       string(body),
+	}
+	delivery.SetHeaders(r.Header)
+
+	// get token and find build definition by token
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		logger.Error("missing token")
+		setVerdict(&delivery, entity.DeliveryRejected, http.StatusBadRequest, "could not determine token")
+	} else if bd, err := h.DBService.FindBuildDefinition("token = ?", token); err != nil {
 		logger.WithFields(logrus.Fields{
 			"error": err.Error(),
 			"token": token,
 		}).Error("could not find build definition for token")
-		http.Error(w, fmt.Sprintf("could not find build definition for token %s: %s", token, err.Error()), http.StatusNotFound)
+		setVerdict(&delivery, entity.DeliveryRejected, http.StatusNotFound, fmt.Sprintf("could not find build definition for token %s: %s", token, err.Error()))
+	} else {
+		h.processDelivery(&bd, &delivery, r, body)
+	}
+
+	h.saveDelivery(&delivery)
+
+	if delivery.StatusCode != http.StatusOK {
+		http.Error(w, delivery.Reason, delivery.StatusCode)
 		return
 	}
+	_, _ = fmt.Fprint(w, delivery.Reason)
+}
+
+// processDelivery verifies and parses a webhook delivery for the given build definition and
+// starts a build, if applicable. The outcome is recorded in the delivery.
+func (h *HTTPHandler) processDelivery(bd *entity.BuildDefinition, d *entity.WebhookDelivery, r *http.Request, body []byte) {
+	logger := h.ContextLogger("processDelivery")
+	d.BuildDefinitionID = bd.ID
 
 	if bd.Deleted {
 		logger.WithFields(logrus.Fields{
 			"id": bd.ID,
 		}).Info("requested deleted build definition")
-		http.Error(w, "requested deleted build definition", http.StatusNotFound)
+		setVerdict(d, entity.DeliveryRejected, http.StatusNotFound, "requested deleted build definition")
 		return
 	}
 
-	variables, err := h.DBService.GetAvailableVariablesForUser(bd.CreatedBy)
+	variables, err := h.resolveVariables(bd)
 	if err != nil {
-		logger.WithField("error", err.Error()).Error("could not determine variables for user")
-		http.Error(w, fmt.Sprintf("could not determine variables for user: %s", err.Error()), http.StatusNotFound)
+		logger.WithField("error", err.Error()).Error("could not determine variables for build definition")
+		setVerdict(d, entity.DeliveryRejected, http.StatusNotFound, "could not determine variables for build definition: "+err.Error())
 		return
 	}
 
@@ -79,39 +105,429 @@ func (h *HTTPHandler) PayloadReceiveHandler(w http.ResponseWriter, r *http.Reque
 	bdContent, err := common.UnmarshalBuildDefinition([]byte(bd.Raw), variables)
 	if err != nil {
 		logger.WithField("error", err.Error()).Error("could not unmarshal build definition")
-		http.Error(w, "could not unmarshal build definition content: "+err.Error(), http.StatusNotFound)
+		setVerdict(d, entity.DeliveryRejected, http.StatusNotFound, "could not unmarshal build definition content: "+err.Error())
 		return
 	}
 	bd.Data = bdContent
+	// the header carrying the secret of the generic hoster is configurable
+	if bdContent.Repository.Hoster == "generic" {
+		d.SetHeaders(r.Header, bdContent.Repository.Generic.GetSecretHeader())
+	}
 
-	// check if the correct headers, depending on the hoster, are set and
-	// have the correct values
-	if err = network.CheckPayloadRequestHeader(bdContent, r); err != nil {
-		logger.WithField("error", err.Error()).Error("request headers are incorrect")
-		http.Error(w, "request headers are incorrect", http.StatusBadRequest)
+	// builds which are not run manually use the default parameter values
+	params, err := common.ResolveParameters(bdContent.Parameters, nil)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not resolve build parameters")
+		setVerdict(d, entity.DeliveryRejected, http.StatusBadRequest, "could not resolve build parameters: "+err.Error())
 		return
 	}
 
-	logger.Debug("payload received")
+	hoster, err := network.HosterFor(bdContent)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not determine git hoster")
+		setVerdict(d, entity.DeliveryRejected, http.StatusBadRequest, err.Error())
+		return
+	}
+	d.Hoster = hoster.Name()
+
+	// replays of verified deliveries lack the masked credentials, so they are not verified again
+	if !d.Verified {
+		if bd.WebhookSecret == "" {
+			// unsigned deliveries are never trusted, the secret has to be regenerated
+			h.Logger.SetContext("audit").WithFields(logrus.Fields{
+				"event":             "webhook_rejected",
+				"buildDefinitionId": bd.ID,
+				"hoster":            hoster.Name(),
+				"remoteAddr":        d.RemoteAddr,
+				"reason":            "no webhook secret",
+			}).Warn("rejected webhook request for build definition without webhook secret")
+			setVerdict(d, entity.DeliveryRejected, http.StatusUnauthorized, "webhook verification failed: the build definition has no webhook secret")
+			return
+		}
+		if err = network.VerifySignature(hoster, bd.WebhookSecret, r, body); err != nil {
+			h.Logger.SetContext("audit").WithFields(logrus.Fields{
+				"event":             "webhook_rejected",
+				"buildDefinitionId": bd.ID,
+				"hoster":            hoster.Name(),
+				"remoteAddr":        d.RemoteAddr,
+				"reason":            err.Error(),
+			}).Warn("rejected webhook request which failed verification")
+			setVerdict(d, entity.DeliveryRejected, http.StatusUnauthorized, "webhook verification failed: "+err.Error())
+			return
+		}
+		d.Verified = true
+	}
+
+	// check if the correct headers, depending on the hoster, are set and
+	// parse the payload into an event
+	event, err := network.ParseWebhookEvent(bdContent, r, body)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not parse webhook request")
+		setVerdict(d, entity.DeliveryRejected, http.StatusBadRequest, "could not parse webhook request: "+err.Error())
+		return
+	}
+	d.Event = event.Type
+	d.Ref = event.Ref
+
+	logger.WithFields(logrus.Fields{
+		"kind": event.Kind,
+		"type": event.Type,
+		"ref":  event.Ref,
+	}).Debug("payload received")
+
+	// pings, deletions and other events are acknowledged, but do not trigger a build
+	if !event.IsBuildable() {
+		setVerdict(d, entity.DeliveryIgnored, http.StatusOK, fmt.Sprintf("event %s does not trigger a build", event.Type))
+		return
+	}
+	ref, err := network.ResolveRef(bdContent, event)
+	if err != nil {
+		logger.WithField("reason", err.Error()).Debug("event does not trigger a build")
+		setVerdict(d, entity.DeliveryIgnored, http.StatusOK, "no build triggered: "+err.Error())
+		return
+	}
+	if reason, skip := h.skipReason(bd, event); skip {
+		logger.WithField("reason", reason).Debug("build skipped")
+		setVerdict(d, entity.DeliverySkipped, http.StatusOK, "build skipped: "+reason)
+		return
+	}
 
-	// insert new build execution
 	be := entity.NewBuildExecution(bd.ID, 0)
-	if err := h.DBService.AddBuildExecution(be); err != nil {
+	be.SetRef(ref)
+	be.SetParameters(params)
+	be.CommitSHA = event.After
+	if head, ok := event.HeadCommit(); ok && head.SHA == event.After {
+		be.SetCommit(head)
+	}
+	if event.PullRequest != nil {
+		be.SetPullRequest(event.PullRequest)
+	}
+
+	// insert new build execution and start the actual build process
+	if err := h.StartBuild(bd, be, variables); err != nil {
 		logger.WithField("error", err.Error()).Error("failed to add build execution")
-		http.Error(w, "failed to add build execution", http.StatusBadRequest)
+		setVerdict(d, entity.DeliveryRejected, http.StatusBadRequest, "failed to add build execution")
 		return
 	}
+	d.BuildExecutionID = be.ID
+	setVerdict(d, entity.DeliveryAccepted, http.StatusOK, fmt.Sprintf("build execution %d started for %s", be.ID, ref.Name()))
+}
+
+// skipReason checks whether the build triggered by the event is to be skipped, either due to a directive
+// in the head commit's message or because none of the changed files matches the path filter. The changed
+// files are taken from the payload, if listed completely, otherwise they are determined using git.
+func (h *HTTPHandler) skipReason(bd *entity.BuildDefinition, event *entity.WebhookEvent) (string, bool) {
+	content := bd.Data
+	if directive, ok := network.SkipDirective(event); ok {
+		return fmt.Sprintf("the head commit message contains %s", directive), true
+	}
 
-	// start the actual build process
-	go h.InitiateBuildProcess(&bd, be)
+	// releases are built regardless of the changed files
+	if !content.Paths.IsSet() || event.Kind == entity.EventKindTag {
+		return "", false
+	}
+
+	files, ok := network.PayloadChangedFiles(event)
+	if !ok {
+		var err error
+		if files, err = h.diffChangedFiles(bd, event); err != nil {
+			h.ContextLogger("skipReason").WithField("error", err.Error()).Warn("could not determine changed files; path filter not applied")
+			return "", false
+		}
+	}
+
+	if _, ok = network.MatchPaths(content.Paths, files); !ok {
+		return fmt.Sprintf("none of the %d changed files matches the path filter", len(files)), true
+	}
+	return "", false
 }
 
-func (h *HTTPHandler) InitiateBuildProcess(bd *entity.BuildDefinition, be *entity.BuildExecution) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+// diffChangedFiles determines the files changed by a push or pull request using git
+func (h *HTTPHandler) diffChangedFiles(bd *entity.BuildDefinition, event *entity.WebhookEvent) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), diffTimeout)
 	defer cancel()
 
+	var (
+		refspecs  []string
+		diffRange string
+	)
+	if event.Kind == entity.EventKindPullRequest {
+		// changes of the pull request since it branched off the target branch
+		refspecs = []string{"+refs/heads/" + event.PullRequest.TargetBranch + ":refs/tbs/base", "+" + event.PullRequest.HeadRef + ":refs/tbs/head"}
+		diffRange = "refs/tbs/base...refs/tbs/head"
+	} else {
+		// the first push of a branch has nothing to compare against
+		if event.Before == "" || strings.Trim(event.Before, "0") == "" {
+			return nil, fmt.Errorf("no previous commit to compare against")
+		}
+		if !git.IsCommitSHA(event.Before) || !git.IsCommitSHA(event.After) {
+			return nil, fmt.Errorf("invalid commit range %q..%q", event.Before, event.After)
+		}
+		refspecs = []string{"+" + event.Ref + ":refs/tbs/head"}
+		diffRange = event.Before + ".." + event.After
+	}
+
+	repositoryUrl, auth, err := h.BuildService.GetRepositoryAccess(ctx, bd)
+	if err != nil {
+		return nil, err
+	}
+
+	return git.ChangedFiles(ctx, repositoryUrl, auth, refspecs, diffRange)
+}
+
+// setVerdict records the outcome of processing a webhook delivery
+func setVerdict(d *entity.WebhookDelivery, verdict entity.DeliveryVerdict, statusCode int, reason string) {
+	d.Verdict = verdict
+	d.StatusCode = statusCode
+	d.Reason = reason
+}
+
+// saveDelivery stores the webhook delivery and removes old deliveries of the same build definition
+func (h *HTTPHandler) saveDelivery(d *entity.WebhookDelivery) {
+	logger := h.ContextLogger("saveDelivery")
+	if err := h.DBService.AddWebhookDelivery(d); err != nil {
+		logger.WithField("error", err.Error()).Error("could not save webhook delivery")
+		return
+	}
+	if err := h.DBService.PruneWebhookDeliveries(d.BuildDefinitionID, deliveriesToKeep); err != nil {
+		logger.WithField("error", err.Error()).Error("could not prune webhook deliveries")
+	}
+}
+
+// RunBuildDefinitionHandler starts a build of the build definition identified by the token.
+// Only the owner of the build definition and admins may do so; they authenticate with email
+// address and password using basic auth. Build parameters and the branch or tag can be supplied
+// as JSON object in the form of {"branch": "main", "parameters": {"name": "value"}}. The branch
+// or tag has to match the patterns of the build definition. Builds of a tag are releases.
+func (h *HTTPHandler) RunBuildDefinitionHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	logger := h.ContextLogger("RunBuildDefinitionHandler")
+
+	email, password, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Tiny Build Server"`)
+		http.Error(w, "missing credentials", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.DBService.GetUserByEmail(email)
+	if err != nil || user.Locked || !security.DoesHashMatch(password, user.Password) {
+		logger.WithField("email", email).Info("invalid credentials")
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		logger.Error("missing token")
+		http.Error(w, "could not determine token", http.StatusBadRequest)
+		return
+	}
+
+	bd, err := h.DBService.FindBuildDefinition("token = ?", token)
+	if err != nil || bd.Deleted {
+		logger.WithField("token", token).Error("could not find build definition for token")
+		http.Error(w, "could not find build definition for token", http.StatusNotFound)
+		return
+	}
+	if bd.CreatedBy != user.ID && !user.Admin {
+		logger.WithFields(logrus.Fields{
+			"userId":            user.ID,
+			"buildDefinitionId": bd.ID,
+		}).Info("user is not allowed to run build definition")
+		http.Error(w, "you are not allowed to run this build definition", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Branch     string         `json:"branch"`
+		Tag        string         `json:"tag"`
+		Parameters map[string]any `json:"parameters"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			logger.WithField("error", err.Error()).Error("could not decode request body")
+			http.Error(w, "could not decode request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	input := make(map[string]string, len(req.Parameters))
+	for k, v := range req.Parameters {
+		input[k] = fmt.Sprintf("%v", v)
+	}
+
+	variables, err := h.resolveVariables(&bd)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not determine variables for build definition")
+		http.Error(w, "could not determine variables for build definition", http.StatusInternalServerError)
+		return
+	}
+
+	bdContent, err := common.UnmarshalBuildDefinition([]byte(bd.Raw), variables)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not unmarshal build definition")
+		http.Error(w, "could not unmarshal build definition content: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	bd.Data = bdContent
+
+	params, err := common.ResolveParameters(bdContent.Parameters, input)
+	if err != nil {
+		logger.WithField("error", err.Error()).Info("invalid build parameters")
+		http.Error(w, "invalid build parameters: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ref := entity.GitRef{Branch: req.Branch, Tag: req.Tag}
+	if ref.Tag != "" {
+		ref.Branch = ""
+	} else if ref.Branch == "" {
+		ref.Branch = bdContent.Repository.GetBranch()
+	}
+	// requested refs are subject to the same patterns as pushed ones
+	if req.Branch != "" || req.Tag != "" {
+		if ref, err = network.ResolveRef(bdContent, &entity.WebhookEvent{GitRef: ref}); err != nil {
+			logger.WithField("reason", err.Error()).Info("requested ref does not match")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	be := entity.NewBuildExecution(bd.ID, user.ID)
+	be.SetRef(ref)
+	be.SetParameters(params)
+	if err := h.StartBuild(&bd, be, variables); err != nil {
+		logger.WithField("error", err.Error()).Error("failed to add build execution")
+		http.Error(w, "failed to add build execution", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"id":         be.ID,
+		"branch":     be.Branch,
+		"tag":        be.Tag,
+		"release":    be.Release,
+		"parameters": params,
+	})
+}
+
+// LoadBuildDefinition resolves the variables available to the build definition and unmarshals
+// its content accordingly
+func (h *HTTPHandler) LoadBuildDefinition(bd *entity.BuildDefinition) ([]entity.UserVariable, error) {
+	variables, err := h.resolveVariables(bd)
+	if err != nil {
+		return nil, err
+	}
+
+	bdContent, err := common.UnmarshalBuildDefinition([]byte(bd.Raw), variables)
+	if err != nil {
+		return nil, err
+	}
+	bd.Data = bdContent
+
+	return variables, nil
+}
+
+// StartBuild records the new build execution for the given build definition and starts the build process
+func (h *HTTPHandler) StartBuild(bd *entity.BuildDefinition, be *entity.BuildExecution, variables []entity.UserVariable) error {
+	// triggered builds wait for the quiet period; newer triggers for the same ref replace them
+	quietPeriod := bd.Data.Concurrency.QuietPeriod
+	if quietPeriod > 0 && be.ManuallyRunBy == 0 && h.Scheduler != nil {
+		be.Status = entity.StatusCreated
+		if err := h.DBService.AddBuildExecution(be); err != nil {
+			return err
+		}
+		// the queued state is reported in the background, but always before any later state
+		reported := make(chan struct{})
+		queued := *be
+		go func() {
+			defer close(reported)
+			h.reportStatus(bd.Data, &queued, statusreporter.StatePending)
+		}()
+		h.Scheduler.Debounce(schedulerKey(be), be.CommitSHA, quietPeriod, func() {
+			<-reported
+			h.InitiateBuildProcess(bd, be, variables)
+		}, func(by string) {
+			<-reported
+			h.supersede(bd, be, by)
+		})
+		return nil
+	}
+
+	if err := h.DBService.AddBuildExecution(be); err != nil {
+		return err
+	}
+
+	go h.InitiateBuildProcess(bd, be, variables)
+
+	return nil
+}
+
+// supersede marks a queued build execution as superseded by a newer one, which builds the commit by,
+// and reports it as canceled
+func (h *HTTPHandler) supersede(bd *entity.BuildDefinition, be *entity.BuildExecution, by string) {
+	defer h.reportStatus(bd.Data, be, statusreporter.StateCanceled)
+	be.Status = entity.StatusSuperseded
+	be.SupersededBy = by
+	be.ActionLog = "build was superseded by a newer build before it started"
+	if err := h.DBService.UpdateBuildExecution(be); err != nil {
+		h.Logger.WithFields(logrus.Fields{
+			"ID":    be.ID,
+			"error": err.Error(),
+		}).Error("failed to update build execution")
+	}
+}
+
+// schedulerKey returns the key of the builds superseding each other, those of the same
+// build definition and ref
+func schedulerKey(be *entity.BuildExecution) scheduler.Key {
+	ref := be.Ref
+	if ref == "" {
+		if be.Tag != "" {
+			ref = "refs/tags/" + be.Tag
+		} else {
+			ref = "refs/heads/" + be.Branch
+		}
+	}
+	return scheduler.Key{BuildDefinitionID: be.BuildDefinitionID, Ref: ref}
+}
+
+// InitiateBuildProcess runs the build steps and deployments of the given build definition
+// and keeps the build execution up to date. Values of secret variables are masked in the report.
+func (h *HTTPHandler) InitiateBuildProcess(bd *entity.BuildDefinition, be *entity.BuildExecution, variables []entity.UserVariable) {
+	parent := context.Background()
+	// triggered builds may be canceled by newer builds of the same ref
+	if be.ManuallyRunBy == 0 && h.Scheduler != nil {
+		var done func()
+		parent, done = h.Scheduler.Start(parent, schedulerKey(be), be.CommitSHA, bd.Data.Concurrency.CancelSuperseded)
+		defer done()
+	}
+	ctx, cancel := context.WithTimeout(parent, 5*time.Minute)
+	defer cancel()
+
+	be.Status = entity.StatusRunning
+	be.ExecutedAt = time.Now()
+
 	logger := h.ContextLogger("InitiateBuildProcess")
 	build := builder.NewBuild(bd, h.BuildService.GetBasePath())
+	addSecrets(build, &bd.Data, variables)
+
+	// the commit of webhook builds is known upfront, the one of manual builds after the checkout
+	if be.CommitSHA != "" {
+		h.reportStatus(bd.Data, be, statusreporter.StateRunning)
+	}
+	defer func() {
+		h.reportStatus(bd.Data, be, statusreporter.StateFromBuildStatus(be.Status))
+	}()
+	defer func() {
+		if scheduler.IsSuperseded(ctx) {
+			build.AddReportEntry("build was canceled, because it was superseded by a newer build")
+			be.Status = entity.StatusSuperseded
+			be.SupersededBy = scheduler.SupersededBy(ctx)
+			h.saveReport(build, be)
+		}
+	}()
 
 	// set up directory structure for build
 	if err := build.Setup(ctx); err != nil {
@@ -122,18 +538,12 @@ func (h *HTTPHandler) InitiateBuildProcess(bd *entity.BuildDefinition, be *entit
 		return
 	}
 
-	// clone the repository
-	withCredentials := bd.Data.Repository.AccessSecret != ""
-	if withCredentials && bd.Data.Repository.AccessUser == "" {
-		bd.Data.Repository.AccessUser = "nobody"
-	}
-
-	// if no branch is set, use master as the default
-	if bd.Data.Repository.Branch == "" {
-		bd.Data.Repository.Branch = "master"
+	// if neither branch nor tag is set, use the default branch of the build definition
+	if be.Branch == "" && be.Tag == "" {
+		be.Branch = bd.Data.Repository.GetBranch()
 	}
-	data := bd.Data
-	repositoryUrl, err := h.BuildService.GetRepositoryUrl(ctx, &data, withCredentials)
+	// clone the repository
+	repositoryUrl, auth, err := h.BuildService.GetRepositoryAccess(ctx, bd)
 	if err != nil {
 		build.AddReportEntryf("could not determine repository url: %s", err.Error())
 		be.Status = entity.StatusFailed
@@ -141,7 +551,15 @@ func (h *HTTPHandler) InitiateBuildProcess(bd *entity.BuildDefinition, be *entit
 		return
 	}
 
-	err = h.BuildService.CloneRepository(ctx, bd.Data.Repository.Branch, repositoryUrl, build.GetCloneDir())
+	// build exactly the pushed commit; merge refs of pull requests point to a commit of their own
+	sha := be.CommitSHA
+	if be.IsPullRequest() && bd.Data.PullRequest.Checkout == "merge" {
+		sha = ""
+	}
+	output, err := h.BuildService.Checkout(ctx, repositoryUrl, auth, build.GetCloneDir(), be.GetRef(), sha, bd.Data.Checkout)
+	if output != "" {
+		build.AddReportEntry(output)
+	}
 	if err != nil {
 		build.AddReportEntryf("could not clone repository: %s", err.Error())
 		be.Status = entity.StatusFailed
@@ -149,17 +567,34 @@ func (h *HTTPHandler) InitiateBuildProcess(bd *entity.BuildDefinition, be *entit
 		return
 	}
 
-	// set up special variables
-	vars := []entity.UserVariable{{
-		Variable: "buildDir",
-		Value:    build.GetBuildDir(),
-	}, {
-		Variable: "cloneDir",
-		Value:    build.GetCloneDir(),
-	}}
+	// the commit of manual builds and details missing in the payload are taken from the checkout
+	if be.CommitSHA == "" || be.CommitMessage == "" {
+		if commit, err := git.HeadCommitInfo(ctx, build.GetCloneDir()); err != nil {
+			build.AddReportEntryf("could not determine commit: %s", err.Error())
+		} else if be.CommitSHA == "" || be.CommitSHA == commit.SHA {
+			reportRunning := be.CommitSHA == ""
+			be.SetCommit(entity.WebhookCommit{SHA: commit.SHA, Author: commit.Author, Message: commit.Message})
+			if reportRunning {
+				h.reportStatus(bd.Data, be, statusreporter.StateRunning)
+			}
+		}
+	}
+	if be.CommitURL == "" {
+		be.CommitURL = network.CommitURL(bd.Data.Repository, be.CommitSHA)
+	}
+
+	// releases are versioned by their tag, other builds by the most recent tag
+	be.Version = be.Tag
+	if be.Version == "" {
+		if be.Version, err = git.Describe(ctx, build.GetCloneDir()); err != nil {
+			build.AddReportEntryf("could not determine version: %s", err.Error())
+			be.Version = ""
+		}
+	}
+	build.SetVersion(be.Version)
 
 	// do the unmarshal again with updated variables
-	bdc, err := buildservice.GetPreparedContent(ctx, bd, vars)
+	bdc, err := buildservice.GetPreparedContent(ctx, bd, append(executionVariables(*be, build), variables...))
 	if err != nil {
 		build.AddReportEntryf("could not unmarshal build definition: %s", err.Error())
 		be.Status = entity.StatusFailed
@@ -170,6 +605,14 @@ func (h *HTTPHandler) InitiateBuildProcess(bd *entity.BuildDefinition, be *entit
 	stepErrors := make([]error, 0)
 
 	steps := bdc.GetSteps()
+	if be.IsPullRequest() {
+		if steps, err = bdc.GetPullRequestSteps(); err != nil {
+			build.AddReportEntryf("could not determine pull request steps: %s", err.Error())
+			be.Status = entity.StatusFailed
+			h.saveReport(build, be)
+			return
+		}
+	}
 	for _, step := range steps {
 		step = strings.Trim(step, "[]")
 		build.AddReportEntryf("step: %s", step)
@@ -273,75 +716,84 @@ func (h *HTTPHandler) InitiateBuildProcess(bd *entity.BuildDefinition, be *entit
 	be.Status = entity.StatusSucceeded
 	h.saveReport(build, be)
 
-	var numJobs = len(bdc.Deployments.LocalDeployments) + len(bdc.Deployments.EmailDeployments) + len(bdc.Deployments.RemoteDeployments)
-
-	jobs := make(chan job, numJobs)
-	results := make(chan job, numJobs)
-	for i := 0; i < 3; i++ { // 3 workers
-		go func(jobs <-chan job, results chan<- job, l logging.ILogger, b *builder.Build) {
-			for j := range jobs {
-				if j.local != nil {
-					l.Trace("processing local deployment")
-					if err := h.DeployService.DoLocalDeployment(ctx, j.local, b); err != nil && !errors.Is(err, deploymentservice.ErrDisabled) {
-						j.err = err
-					}
-				} else if j.email != nil {
-					l.Trace("processing email deployment")
-					if err := h.DeployService.DoEmailDeployment(ctx, j.email, bdc.Repository.Name, b); err != nil && !errors.Is(err, deploymentservice.ErrDisabled) {
-						j.err = err
-					}
-				} else if j.remote != nil {
-					l.Trace("processing remote deployment")
-					if err := h.DeployService.DoRemoteDeployment(ctx, j.remote, b); err != nil && !errors.Is(err, deploymentservice.ErrDisabled) {
-						j.err = err
-					}
-				}
-				// process job and put it into the result channel
-				results <- j
-			}
-		}(jobs, results, h.ContextLogger("deployWorkerPool"), build)
+	// deployments of pull requests have to be enabled explicitly
+	if be.IsPullRequest() && !bdc.PullRequest.Deploy {
+		build.AddReportEntry("deployments are disabled for pull requests")
+		h.saveReport(build, be)
+		return
 	}
 
-	for _, l := range bdc.Deployments.LocalDeployments {
-		jobs <- job{local: &l}
-		logger.Trace("adding local deployment")
+	build.SetRelease(deploymentservice.ReleaseName(be.ID, be.ExecutedAt))
+	h.runDeployments(ctx, be, build, bdc, deploymentJobs(bdc), 0)
+
+	build.AddReportEntry("all deployments finished")
+	h.saveReport(build, be)
+}
+
+// reportStatus posts the state of the build execution as commit status to the git hoster, if
+// enabled for the build definition. Failures are logged, but do not affect the build.
+func (h *HTTPHandler) reportStatus(content entity.BuildDefinitionContent, be *entity.BuildExecution, state statusreporter.State) {
+	if !content.StatusReport.Enabled || be.CommitSHA == "" {
+		return
 	}
-	for _, e := range bdc.Deployments.EmailDeployments {
-		jobs <- job{email: &e}
-		logger.Trace("adding email deployment")
+	logger := h.ContextLogger("reportStatus").WithFields(logrus.Fields{
+		"ID":    be.ID,
+		"state": state,
+	})
+
+	reporter, err := statusreporter.New(&content, nil)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not create status reporter")
+		return
 	}
-	for _, r := range bdc.Deployments.RemoteDeployments {
-		jobs <- job{remote: &r}
-		logger.Trace("adding remote deployment")
+
+	settings, err := h.DBService.GetAllSettings()
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not fetch settings")
+		return
+	}
+	baseUrl, ok := settings["base_url"]
+	if !ok || baseUrl == "" {
+		baseUrl = "http://127.0.0.1:8271"
 	}
-	close(jobs)
 
-	for i := 0; i < numJobs; i++ {
-		r, ok := <-results
-		if !ok {
-			continue
-		}
-		if r.nil() {
-			continue
-		}
-		if r.err != nil {
-			var msg string
-			if r.local != nil {
-				logger.Trace("local deployment failed")
-				msg = fmt.Sprintf(errMsg, "local", r.err)
-			} else if r.email != nil {
-				logger.Trace("email deployment failed")
-				msg = fmt.Sprintf(errMsg, "email", r.err)
-			} else if r.remote != nil {
-				logger.Trace("remote deployment failed")
-				msg = fmt.Sprintf(errMsg, "remote", r.err)
+	statusContext := content.StatusReport.Context
+	if statusContext == "" {
+		statusContext = statusreporter.DefaultContext
+	}
+
+	var description string
+	switch state {
+	case statusreporter.StatePending:
+		description = "The build is queued"
+	case statusreporter.StateRunning:
+		description = "The build is running"
+	case statusreporter.StateSuccess:
+		description = "The build succeeded"
+	case statusreporter.StateCanceled:
+		description = fmt.Sprintf("The build was %s", be.Status)
+		if be.Status == entity.StatusSuperseded {
+			description = "The build was superseded by a newer build"
+			if be.SupersededBy != "" {
+				description = "The build was superseded by " + be.SupersededBy
 			}
-			build.AddReportEntry(msg)
 		}
+	default:
+		description = fmt.Sprintf("The build finished with status %s", be.Status)
 	}
 
-	build.AddReportEntry("all deployments finished")
-	h.saveReport(build, be)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err = reporter.Report(ctx, statusreporter.Status{
+		SHA:         be.CommitSHA,
+		State:       state,
+		Description: description,
+		TargetURL:   fmt.Sprintf("%s/buildexecution/%d/show", strings.TrimSuffix(baseUrl, "/"), be.ID),
+		Context:     statusContext,
+	})
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not report build status")
+	}
 }
 
 func (h *HTTPHandler) saveReport(build *builder.Build, be *entity.BuildExecution) {
@@ -1,12 +1,25 @@
 package handler
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/dbservice"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/git"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/logging"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/scheduler"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/security"
 )
 
 var mockPayload = `{
@@ -198,13 +211,45 @@ var mockPayload = `{
   }
 }`
 
+// buildRecorder passes on build executions as soon as they are finished
+type buildRecorder struct {
+	dbservice.DBServiceMock
+	finished chan entity.BuildExecution
+}
+
+func (b *buildRecorder) UpdateBuildExecution(be *entity.BuildExecution) error {
+	if be.Status != entity.StatusCreated && be.Status != entity.StatusRunning {
+		select {
+		case b.finished <- *be:
+		default:
+		}
+	}
+	return nil
+}
+
+// unreachableBuildService lets builds fail, as the repository cannot be accessed
+type unreachableBuildService struct {
+	basePath string
+}
+
+func (u unreachableBuildService) Checkout(ctx context.Context, repositoryUrl string, auth git.Auth, path string, ref entity.GitRef, sha string, opts entity.Checkout) (string, error) {
+	return "", errors.New("repository is unreachable")
+}
+func (u unreachableBuildService) GetRepositoryAccess(ctx context.Context, bd *entity.BuildDefinition) (string, git.Auth, error) {
+	return "", git.Auth{}, errors.New("repository is unreachable")
+}
+func (u unreachableBuildService) GetBasePath() string {
+	return u.basePath
+}
+
 func TestPayloadReceiveHandler(t *testing.T) {
-	dbMock := &dbservice.DBServiceMock{}
+	dbMock := &buildRecorder{finished: make(chan entity.BuildExecution, 1)}
 	logger, _, _ := logging.NewLogger(logging.LevelDebug, "", "", logging.ModeDiscard)
 
 	handler := &HTTPHandler{
-		Logger:    logger,
-		DBService: dbMock,
+		Logger:       logger,
+		DBService:    dbMock,
+		BuildService: unreachableBuildService{basePath: t.TempDir()},
 	}
 
 	token := "123abc"
@@ -213,7 +258,7 @@ func TestPayloadReceiveHandler(t *testing.T) {
 	r := httptest.NewRequest("POST", "/payload/receive?token="+token, strings.NewReader(mockPayload))
 	r.Header.Set("X-GitHub-Delivery", "550e8400-e29b-41d4-a716-446655440000")
 	r.Header.Set("X-GitHub-Event", "push")
-	r.Header.Set("X-Hub-Signature", "sha1=1234567890abcdef1234567890abcdef12345678")
+	r.Header.Set("X-Hub-Signature-256", signPayload(mockPayload))
 
 	handler.PayloadReceiveHandler(w, r)
 
@@ -222,4 +267,321 @@ func TestPayloadReceiveHandler(t *testing.T) {
 	if resp.StatusCode != 200 {
 		t.Errorf("Expected status code 200, got %d", resp.StatusCode)
 	}
+
+	// the build runs in the background and must not outlive the test
+	select {
+	case be := <-dbMock.finished:
+		if be.Status != entity.StatusFailed {
+			t.Errorf("expected the build to fail, got status %s", be.Status)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the build to be started")
+	}
+}
+
+// signPayload returns the GitHub signature of a payload using the webhook secret of the mocked build definition
+func signPayload(payload string) string {
+	mac := hmac.New(sha256.New, []byte("webhooksecret"))
+	mac.Write([]byte(payload))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliveryRecorder records the webhook deliveries instead of storing them
+type deliveryRecorder struct {
+	dbservice.DBServiceMock
+	deliveries []entity.WebhookDelivery
+}
+
+func (d *deliveryRecorder) AddWebhookDelivery(delivery *entity.WebhookDelivery) error {
+	d.deliveries = append(d.deliveries, *delivery)
+	return nil
+}
+
+func TestPayloadReceiveHandler_RecordsDelivery(t *testing.T) {
+	logger, _, _ := logging.NewLogger(logging.LevelDebug, "", "", logging.ModeDiscard)
+
+	tests := []struct {
+		name        string
+		url         string
+		event       string
+		wantCode    int
+		wantVerdict entity.DeliveryVerdict
+	}{
+		{name: "missing token", url: "/payload/receive", event: "push", wantCode: 400, wantVerdict: entity.DeliveryRejected},
+		{name: "ping", url: "/payload/receive?token=123abc", event: "ping", wantCode: 200, wantVerdict: entity.DeliveryIgnored},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &deliveryRecorder{}
+			handler := &HTTPHandler{
+				Logger:    logger,
+				DBService: recorder,
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", tt.url, strings.NewReader(mockPayload))
+			r.Header.Set("X-GitHub-Delivery", "550e8400-e29b-41d4-a716-446655440000")
+			r.Header.Set("X-GitHub-Event", tt.event)
+			r.Header.Set("X-Hub-Signature-256", signPayload(mockPayload))
+
+			handler.PayloadReceiveHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status code %d, got %d", tt.wantCode, w.Code)
+			}
+			if len(recorder.deliveries) != 1 {
+				t.Fatalf("expected 1 recorded delivery, got %d", len(recorder.deliveries))
+			}
+			d := recorder.deliveries[0]
+			if d.Verdict != tt.wantVerdict {
+				t.Errorf("expected verdict %s, got %s (%s)", tt.wantVerdict, d.Verdict, d.Reason)
+			}
+			if d.StatusCode != tt.wantCode {
+				t.Errorf("expected recorded status code %d, got %d", tt.wantCode, d.StatusCode)
+			}
+			if d.Body != mockPayload {
+				t.Errorf("expected the body to be recorded")
+			}
+			if d.GetHeaders().Get("X-GitHub-Event") != tt.event {
+				t.Errorf("expected the headers to be recorded")
+			}
+		})
+	}
+}
+
+// unsignedDefinition returns a build definition without webhook secret
+type unsignedDefinition struct {
+	deliveryRecorder
+}
+
+func (u *unsignedDefinition) FindBuildDefinition(cond string, args ...any) (entity.BuildDefinition, error) {
+	bd, err := u.deliveryRecorder.FindBuildDefinition(cond, args...)
+	bd.WebhookSecret = ""
+	return bd, err
+}
+
+func TestPayloadReceiveHandler_RejectsWithoutSecret(t *testing.T) {
+	logger, _, _ := logging.NewLogger(logging.LevelDebug, "", "", logging.ModeDiscard)
+	recorder := &unsignedDefinition{}
+	handler := &HTTPHandler{
+		Logger:    logger,
+		DBService: recorder,
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/payload/receive?token=123abc", strings.NewReader(mockPayload))
+	r.Header.Set("X-GitHub-Delivery", "550e8400-e29b-41d4-a716-446655440000")
+	r.Header.Set("X-GitHub-Event", "push")
+
+	handler.PayloadReceiveHandler(w, r)
+
+	if w.Code != 401 {
+		t.Errorf("expected status code 401, got %d", w.Code)
+	}
+	if len(recorder.deliveries) != 1 || recorder.deliveries[0].Verdict != entity.DeliveryRejected {
+		t.Fatalf("expected a rejected delivery, got %+v", recorder.deliveries)
+	}
+	if !strings.Contains(recorder.deliveries[0].Reason, "no webhook secret") {
+		t.Errorf("expected the missing secret as reason, got %q", recorder.deliveries[0].Reason)
+	}
+}
+
+// genericDefinition returns a build definition using the generic hoster with a custom secret header
+type genericDefinition struct {
+	deliveryRecorder
+}
+
+func (g *genericDefinition) FindBuildDefinition(cond string, args ...any) (entity.BuildDefinition, error) {
+	bd, err := g.deliveryRecorder.FindBuildDefinition(cond, args...)
+	bd.Raw = `repository:
+  hoster: generic
+  name: user/repo
+  branch: master
+  generic:
+    ref: $.ref
+    commit: $.after
+    secret_header: X-Ci-Token
+`
+	return bd, err
+}
+
+func TestPayloadReceiveHandler_MasksSecretHeader(t *testing.T) {
+	const body = `{"ref": "refs/heads/feature", "after": "1316f73b181936990972ab07e3d6c215367bf8cc"}`
+	logger, _, _ := logging.NewLogger(logging.LevelDebug, "", "", logging.ModeDiscard)
+	recorder := &genericDefinition{}
+	handler := &HTTPHandler{
+		Logger:    logger,
+		DBService: recorder,
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/payload/receive?token=123abc", strings.NewReader(body))
+	r.Header.Set("X-Ci-Token", "webhooksecret")
+	r.Header.Set("X-Webhook-Signature", "webhooksecret")
+
+	handler.PayloadReceiveHandler(w, r)
+
+	if len(recorder.deliveries) != 1 {
+		t.Fatalf("expected 1 recorded delivery, got %d", len(recorder.deliveries))
+	}
+	d := recorder.deliveries[0]
+	if d.Verdict != entity.DeliveryIgnored || !d.Verified {
+		t.Fatalf("expected a verified, ignored delivery, got %s (%s)", d.Verdict, d.Reason)
+	}
+	if strings.Contains(d.Headers, "webhooksecret") {
+		t.Errorf("expected the secret to be masked, got %s", d.Headers)
+	}
+
+	// a replay of the verified delivery passes without the masked secret
+	bd, _ := recorder.FindBuildDefinition("token = ?", "123abc")
+	for _, verified := range []bool{true, false} {
+		replay := entity.WebhookDelivery{Headers: d.Headers, Body: d.Body, Verified: verified}
+		req := httptest.NewRequest("POST", "/api/v1/receive", strings.NewReader(body))
+		req.Header = d.GetHeaders()
+		handler.processDelivery(&bd, &replay, req, []byte(body))
+		if rejected := replay.Verdict == entity.DeliveryRejected; rejected == verified {
+			t.Errorf("expected the replay of a delivery verified %v to be rejected %v, got %s (%s)", verified, !verified, replay.Verdict, replay.Reason)
+		}
+	}
+}
+
+// apiUsers authenticates the owner and another user of the mocked build definition
+type apiUsers struct {
+	buildRecorder
+	users map[string]entity.User
+}
+
+func (a *apiUsers) GetUserByEmail(email string) (entity.User, error) {
+	if u, ok := a.users[email]; ok {
+		return u, nil
+	}
+	return entity.User{}, errors.New("no such user")
+}
+
+func TestRunBuildDefinitionHandler(t *testing.T) {
+	logger, _, _ := logging.NewLogger(logging.LevelDebug, "", "", logging.ModeDiscard)
+	hash, err := security.HashString("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := entity.User{Email: "owner@example.org", Password: hash}
+	owner.ID = 1
+	other := entity.User{Email: "other@example.org", Password: hash}
+	other.ID = 2
+	dbMock := &apiUsers{
+		buildRecorder: buildRecorder{finished: make(chan entity.BuildExecution, 1)},
+		users:         map[string]entity.User{owner.Email: owner, other.Email: other},
+	}
+	handler := &HTTPHandler{
+		Logger:       logger,
+		DBService:    dbMock,
+		BuildService: unreachableBuildService{basePath: t.TempDir()},
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		body     string
+		code     int
+	}{
+		{"no credentials", "", "", "", http.StatusUnauthorized},
+		{"wrong password", owner.Email, "wrong", "", http.StatusUnauthorized},
+		{"other user", other.Email, "secret", "", http.StatusForbidden},
+		{"unmatched branch", owner.Email, "secret", `{"branch": "feature"}`, http.StatusBadRequest},
+		{"unmatched tag", owner.Email, "secret", `{"tag": "v1.0.0"}`, http.StatusBadRequest},
+		{"owner", owner.Email, "secret", `{"branch": "master"}`, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/api/v1/run?token=abc123", strings.NewReader(tt.body))
+			if tt.email != "" {
+				r.SetBasicAuth(tt.email, tt.password)
+			}
+
+			handler.RunBuildDefinitionHandler(w, r)
+
+			if w.Code != tt.code {
+				t.Errorf("expected status code %d, got %d (%s)", tt.code, w.Code, strings.TrimSpace(w.Body.String()))
+			}
+		})
+	}
+
+	// the build runs in the background and must not outlive the test
+	select {
+	case be := <-dbMock.finished:
+		if be.ManuallyRunBy != owner.ID {
+			t.Errorf("expected the build to be run by the owner, got %d", be.ManuallyRunBy)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the build to be started")
+	}
+}
+
+func TestStartBuild_ReportsQueuedAndSupersededBuilds(t *testing.T) {
+	var (
+		mut      sync.Mutex
+		statuses = make(map[string][]string)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("could not decode status: %s", err.Error())
+			return
+		}
+		sha := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		mut.Lock()
+		statuses[sha] = append(statuses[sha], body["state"]+": "+body["description"])
+		mut.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	logger, _, _ := logging.NewLogger(logging.LevelDebug, "", "", logging.ModeDiscard)
+	dbMock := &buildRecorder{finished: make(chan entity.BuildExecution, 1)}
+	h := &HTTPHandler{
+		Logger:       logger,
+		DBService:    dbMock,
+		BuildService: unreachableBuildService{basePath: t.TempDir()},
+		Scheduler:    scheduler.New(),
+	}
+	bd := &entity.BuildDefinition{}
+	bd.Data.Repository = entity.Repository{Hoster: "gitea", Name: "user/repo"}
+	bd.Data.StatusReport = entity.StatusReport{Enabled: true, ApiUrl: srv.URL, Token: "tok"}
+	bd.Data.Concurrency.QuietPeriod = 200 * time.Millisecond
+
+	for _, sha := range []string{"aaa", "bbb"} {
+		be := entity.NewBuildExecution(1, 0)
+		be.SetRef(entity.GitRef{Branch: "main"})
+		be.CommitSHA = sha
+		if err := h.StartBuild(bd, be, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-dbMock.finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the newer build to run")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mut.Lock()
+		superseded, newer := statuses["aaa"], statuses["bbb"]
+		mut.Unlock()
+		if len(superseded) == 2 && len(newer) == 3 {
+			if superseded[0] != "pending: The build is queued" || superseded[1] != "warning: The build was superseded by bbb" {
+				t.Errorf("unexpected statuses of the superseded build: %v", superseded)
+			}
+			if newer[0] != "pending: The build is queued" || newer[1] != "pending: The build is running" {
+				t.Errorf("unexpected statuses of the newer build: %v", newer)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected all statuses to be reported, got %v", statuses)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
 }
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 	"gorm.io/gorm"
 )
 
@@ -64,20 +66,38 @@ func (h *HTTPHandler) BuildDefinitionAddHandler(w http.ResponseWriter, r *http.R
 			http.Redirect(w, r, "/builddefinition/add", http.StatusSeeOther)
 			return
 		}
+		if err := validateBuildDefinition(content); err != nil {
+			logger.WithField("error", err.Error()).Info("invalid build definition")
+			h.SessionService.AddMessage(w, "error", "Invalid build definition: "+err.Error())
+			http.Redirect(w, r, "/builddefinition/add", http.StatusSeeOther)
+			return
+		}
+		approvers, err := h.resolveApprovers(content)
+		if err != nil {
+			logger.WithField("error", err.Error()).Info("invalid build definition")
+			h.SessionService.AddMessage(w, "error", "Invalid build definition: "+err.Error())
+			http.Redirect(w, r, "/builddefinition/add", http.StatusSeeOther)
+			return
+		}
 
 		bd := entity.BuildDefinition{
-			Caption:   caption,
-			Token:     security.GenerateToken(20),
-			Raw:       content,
-			CreatedBy: currentUser.ID,
+			Caption:       caption,
+			Token:         security.GenerateToken(20),
+			WebhookSecret: security.GenerateToken(32),
+			Raw:           content,
+			CreatedBy:     currentUser.ID,
 		}
 
-		_, err := h.DBService.AddBuildDefinition(&bd)
+		_, err = h.DBService.AddBuildDefinition(&bd)
 		if err != nil {
 			logger.WithField("error", err.Error()).Error("could not insert build definition")
 			w.WriteHeader(500)
 			return
 		}
+		if err = h.DBService.SaveEnvironmentApprovers(bd.ID, approvers); err != nil {
+			logger.WithField("error", err.Error()).Error("could not save approvers")
+			h.SessionService.AddMessage(w, "error", "The approvers could not be saved! Please save the build definition again.")
+		}
 
 		http.Redirect(w, r, "/builddefinition/list", http.StatusSeeOther)
 		return
@@ -127,6 +147,19 @@ func (h *HTTPHandler) BuildDefinitionEditHandler(w http.ResponseWriter, r *http.
 			http.Redirect(w, r, fmt.Sprintf("/builddefinition/%s/edit", vars["id"]), http.StatusSeeOther)
 			return
 		}
+		if err := validateBuildDefinition(content); err != nil {
+			logger.WithField("error", err.Error()).Info("invalid build definition")
+			h.SessionService.AddMessage(w, "error", "Invalid build definition: "+err.Error())
+			http.Redirect(w, r, fmt.Sprintf("/builddefinition/%s/edit", vars["id"]), http.StatusSeeOther)
+			return
+		}
+		approvers, err := h.resolveApprovers(content)
+		if err != nil {
+			logger.WithField("error", err.Error()).Info("invalid build definition")
+			h.SessionService.AddMessage(w, "error", "Invalid build definition: "+err.Error())
+			http.Redirect(w, r, fmt.Sprintf("/builddefinition/%s/edit", vars["id"]), http.StatusSeeOther)
+			return
+		}
 
 		bd := entity.BuildDefinition{
 			Model:    gorm.Model{ID: uint(id)},
@@ -146,6 +179,10 @@ func (h *HTTPHandler) BuildDefinitionEditHandler(w http.ResponseWriter, r *http.
 			http.Redirect(w, r, fmt.Sprintf("/builddefinition/%s/edit", vars["id"]), http.StatusSeeOther)
 			return
 		}
+		if err = h.DBService.SaveEnvironmentApprovers(bd.ID, approvers); err != nil {
+			logger.WithField("error", err.Error()).Error("could not save approvers")
+			h.SessionService.AddMessage(w, "error", "The approvers could not be saved! Please save the build definition again.")
+		}
 
 		http.Redirect(w, r, "/builddefinition/list", http.StatusSeeOther)
 		return
@@ -240,9 +277,35 @@ func (h *HTTPHandler) BuildDefinitionShowHandler(w http.ResponseWriter, r *http.
 		}
 	}
 
+	variables, err := h.resolveVariables(&bd)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not resolve variables")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// the values of the variables, e.g. private user variables of the owner, are only
+	// shown to those who may manage the build definition
+	canManage := bd.CreatedBy == currentUser.ID || currentUser.Admin
+	if !canManage {
+		for i := range variables {
+			variables[i].Value = ""
+		}
+	}
+
+	// the private key never leaves the server
+	deployKey, err := h.DBService.GetDeployKey(bd.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.WithField("error", err.Error()).Error("could not get deploy key")
+	}
+	deployKey.PrivateKey = ""
+	// the deploy key is only used if the repository has an SSH url
+	var content entity.BuildDefinitionContent
+	_ = yaml.Unmarshal([]byte(bd.Raw), &content)
+
 	// TODO: caching!
 	data := struct {
 		BuildDefinition   entity.BuildDefinition
+		Variables         []entity.UserVariable
 		RecentExecutions  []entity.BuildExecution
 		CurrentUser       entity.User
 		TotalBuildCount   int
@@ -252,8 +315,12 @@ func (h *HTTPHandler) BuildDefinitionShowHandler(w http.ResponseWriter, r *http.
 		AvgRuntime        string
 		BaseUrl           string
 		Limit             int
+		CanManage         bool
+		DeployKey         entity.DeployKey
+		UsesDeployKey     bool
 	}{
 		BuildDefinition:   bd,
+		Variables:         variables,
 		RecentExecutions:  recentExecutions,
 		CurrentUser:       currentUser,
 		TotalBuildCount:   len(beList),
@@ -263,6 +330,9 @@ func (h *HTTPHandler) BuildDefinitionShowHandler(w http.ResponseWriter, r *http.
 		AvgRuntime:        fmt.Sprintf("%.2f", avg),
 		BaseUrl:           baseUrl,
 		Limit:             limit,
+		CanManage:         canManage,
+		DeployKey:         deployKey,
+		UsesDeployKey:     content.Repository.SSHUrl != "",
 	}
 
 	if err := templateservice.ExecuteTemplate(h.Injector(), w, "builddefinition_show.html", data); err != nil {
@@ -270,6 +340,50 @@ func (h *HTTPHandler) BuildDefinitionShowHandler(w http.ResponseWriter, r *http.
 	}
 }
 
+// BuildDefinitionSecretHandler generates a new webhook secret for an existing build definition.
+// Only the creator of the build definition and admins are allowed to do so.
+func (h *HTTPHandler) BuildDefinitionSecretHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		currentUser = r.Context().Value("user").(entity.User)
+		logger      = h.ContextLogger("BuildDefinitionSecretHandler")
+		vars        = mux.Vars(r)
+	)
+
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not parse build definition id")
+		http.Error(w, "could not parse build definition id", http.StatusBadRequest)
+		return
+	}
+	bd, err := h.DBService.GetBuildDefinitionById(uint(id))
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    id,
+		}).Error("could not get build definition by ID")
+		http.Error(w, "could not get build definition by ID", http.StatusNotFound)
+		return
+	}
+
+	if bd.CreatedBy != currentUser.ID && !currentUser.Admin {
+		logger.WithField("id", bd.ID).Info("user is not allowed to change the webhook secret")
+		h.SessionService.AddMessage(w, "error", "You are not allowed to change the webhook secret of this build definition")
+		http.Redirect(w, r, fmt.Sprintf("/builddefinition/%d/show", bd.ID), http.StatusSeeOther)
+		return
+	}
+
+	bd.WebhookSecret = security.GenerateToken(32)
+	if err = h.DBService.UpdateBuildDefinition(&bd); err != nil {
+		logger.WithField("error", err.Error()).Error("could not update build definition")
+		http.Error(w, "could not update build definition", http.StatusInternalServerError)
+		return
+	}
+
+	h.SessionService.AddMessage(w, "success", "A new webhook secret has been generated. Update the webhook at your git hoster accordingly.")
+	http.Redirect(w, r, fmt.Sprintf("/builddefinition/%d/show", bd.ID), http.StatusSeeOther)
+}
+
 // BuildDefinitionRemoveHandler removes an existing build definition
 func (h *HTTPHandler) BuildDefinitionRemoveHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
@@ -356,11 +470,12 @@ func (h *HTTPHandler) BuildDefinitionRestartHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	variables, err := h.DBService.GetAvailableVariablesForUser(currentUser.ID)
+	// variables are always resolved for the owner of the build definition, no matter who runs it
+	variables, err := h.resolveVariables(&bd)
 	if err != nil {
 		logger.WithFields(logrus.Fields{
-			"error":  err.Error(),
-			"userID": currentUser.ID,
+			"error": err.Error(),
+			"id":    bd.ID,
 		}).Error("could not get variables")
 		http.Redirect(w, r, fmt.Sprintf("/builddefinition/%d/show", bd.ID), http.StatusBadRequest)
 		return
@@ -375,16 +490,69 @@ func (h *HTTPHandler) BuildDefinitionRestartHandler(w http.ResponseWriter, r *ht
 	}
 	bd.Data = bdContent
 
-	// insert new build execution
-	be := entity.NewBuildExecution(bd.ID, 0)
-	if err := h.DBService.AddBuildExecution(be); err != nil {
+	// definitions with parameters ask for the values first
+	if len(bdContent.Parameters) > 0 && r.Method != http.MethodPost {
+		data := struct {
+			CurrentUser     entity.User
+			BuildDefinition entity.BuildDefinition
+			Branch          string
+			Parameters      []entity.Parameter
+		}{
+			CurrentUser:     currentUser,
+			BuildDefinition: bd,
+			Branch:          bdContent.Repository.GetBranch(),
+			Parameters:      bdContent.Parameters,
+		}
+
+		if err := templateservice.ExecuteTemplate(h.Injector(), w, "builddefinition_run.html", data); err != nil {
+			w.WriteHeader(404)
+		}
+		return
+	}
+
+	input := make(map[string]string)
+	if r.Method == http.MethodPost {
+		for _, p := range bdContent.Parameters {
+			if p.Type == entity.ParameterTypeBoolean {
+				input[p.Name] = fmt.Sprintf("%t", r.FormValue(p.Name) == "1")
+				continue
+			}
+			input[p.Name] = r.FormValue(p.Name)
+		}
+	}
+
+	params, err := common.ResolveParameters(bdContent.Parameters, input)
+	if err != nil {
+		logger.WithField("error", err.Error()).Info("invalid build parameters")
+		h.SessionService.AddMessage(w, "error", "Invalid build parameters: "+err.Error())
+		http.Redirect(w, r, fmt.Sprintf("/builddefinition/%d/restart", bd.ID), http.StatusSeeOther)
+		return
+	}
+
+	branch := r.FormValue("branch")
+	if branch == "" {
+		branch = bdContent.Repository.GetBranch()
+	}
+
+	// insert new build execution and start the build
+	be := entity.NewBuildExecution(bd.ID, currentUser.ID)
+	be.SetRef(entity.GitRef{Branch: branch})
+	be.SetParameters(params)
+	if err := h.StartBuild(&bd, be, variables); err != nil {
 		logger.WithField("error", err.Error()).Error("failed to add build execution")
 		http.Error(w, "failed to add build execution", http.StatusBadRequest)
 		return
 	}
-	be.ManuallyRunBy = currentUser.ID
-
-	go h.InitiateBuildProcess(&bd, be)
 
 	http.Redirect(w, r, fmt.Sprintf("/builddefinition/%d/show", bd.ID), http.StatusSeeOther)
 }
+
+// validateBuildDefinition checks the content of a build definition before it is saved. Variables are
+// resolved when the build runs, so content which cannot be parsed without them is not checked here.
+func validateBuildDefinition(raw string) error {
+	var content entity.BuildDefinitionContent
+	if err := yaml.Unmarshal([]byte(raw), &content); err != nil {
+		return nil
+	}
+	return content.Deployments.Validate()
+}
@@ -1,26 +1,37 @@
 package handler
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/builder"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/buildservice"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/templateservice"
 
 	"github.com/gorilla/mux"
 )
 
-// BuildExecutionListHandler lists all build executions in in descending order
+// BuildExecutionListHandler lists all build executions in in descending order,
+// optionally filtered by branch and searched by commit SHA, message or author
 func (h *HTTPHandler) BuildExecutionListHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	var (
 		currentUser = r.Context().Value("user").(entity.User)
 		logger      = h.ContextLogger("BuildExecutionListHandler")
+		branch      = r.URL.Query().Get("branch")
+		search      = strings.TrimSpace(r.URL.Query().Get("q"))
 	)
 
-	buildExecutions, err := h.DBService.GetNewestBuildExecutions(0, "")
+	query, args := buildExecutionFilter(branch, search)
+	buildExecutions, err := h.DBService.GetNewestBuildExecutions(0, query, args...)
 	if err != nil {
 		logger.WithField("error", err.Error()).Error("could not get build executions")
 		h.SessionService.AddMessage(w, "success", "Failed to fetch build executions")
@@ -41,16 +52,29 @@ func (h *HTTPHandler) BuildExecutionListHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	branches, err := h.DBService.GetBuildExecutionBranches()
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not get branches")
+		h.SessionService.AddMessage(w, "error", "Failed to fetch branch list")
+		return
+	}
+
 	data := struct {
 		CurrentUser      entity.User
 		BuildExecutions  []entity.BuildExecution
 		BuildDefinitions []entity.BuildDefinition
 		Users            []entity.User
+		Branch           string
+		Branches         []string
+		Search           string
 	}{
 		CurrentUser:      currentUser,
 		BuildExecutions:  buildExecutions,
 		BuildDefinitions: buildDefinitions,
 		Users:            users,
+		Branch:           branch,
+		Branches:         branches,
+		Search:           search,
 	}
 
 	if err := templateservice.ExecuteTemplate(h.Injector(), w, "buildexecution_list.html", data); err != nil {
@@ -58,6 +82,28 @@ func (h *HTTPHandler) BuildExecutionListHandler(w http.ResponseWriter, r *http.R
 	}
 }
 
+// buildExecutionFilter returns the query for the build executions of the branch, if set, whose
+// commit SHA starts with the search term or whose commit message or author contains it
+func buildExecutionFilter(branch, search string) (string, []any) {
+	conditions := make([]string, 0, 2)
+	args := make([]any, 0, 4)
+	if branch != "" {
+		conditions = append(conditions, "branch = ?")
+		args = append(args, branch)
+	}
+	if search != "" {
+		pattern := "%" + escapeLike(search) + "%"
+		conditions = append(conditions, "(commit_sha LIKE ? OR commit_message LIKE ? OR commit_author LIKE ?)")
+		args = append(args, escapeLike(search)+"%", pattern, pattern)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// escapeLike escapes the wildcards of LIKE patterns
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 // BuildExecutionShowHandler shows details of a specific build execution
 func (h *HTTPHandler) BuildExecutionShowHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
@@ -96,17 +142,129 @@ func (h *HTTPHandler) BuildExecutionShowHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if err = h.DBService.ExpireDeployments(time.Now()); err != nil {
+		logger.WithField("error", err.Error()).Error("could not expire deployments")
+	}
+	deployments, err := h.DBService.GetDeploymentsByBuildExecution(buildExecution.ID)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    id,
+		}).Error("could not get deployments")
+		w.WriteHeader(500)
+		return
+	}
+
 	data := struct {
 		CurrentUser     entity.User
 		BuildExecution  entity.BuildExecution
 		BuildDefinition entity.BuildDefinition
+		Deployments     []entity.Deployment
+		Releases        bool
 	}{
 		CurrentUser:     currentUser,
 		BuildExecution:  buildExecution,
 		BuildDefinition: buildDefinition,
+		Deployments:     deployments,
+		Releases: slices.ContainsFunc(deployments, func(d entity.Deployment) bool {
+			return d.Status == entity.StatusSucceeded && d.Release != ""
+		}),
 	}
 
 	if err = templateservice.ExecuteTemplate(h.Injector(), w, "buildexecution_show.html", data); err != nil {
 		w.WriteHeader(404)
 	}
 }
+
+// BuildExecutionRollbackHandler switches every remote deployment of the build definition back to the
+// release the build execution was last deployed to that host as. Only the creator of the build definition
+// and admins are allowed to do so, and hosts of environments with approvers are only rolled back for
+// the approvers of the environment.
+func (h *HTTPHandler) BuildExecutionRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		currentUser = r.Context().Value("user").(entity.User)
+		logger      = h.ContextLogger("BuildExecutionRollbackHandler")
+	)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not parse entry ID")
+		http.Error(w, "could not parse build execution id", http.StatusBadRequest)
+		return
+	}
+	be, bd, ok := h.findManageableExecution(w, r, uint(id), logger)
+	if !ok {
+		return
+	}
+	showUrl := fmt.Sprintf("/buildexecution/%d/show", be.ID)
+	deployments, err := h.DBService.GetDeploymentsByBuildExecution(be.ID)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    be.ID,
+		}).Error("could not get deployments")
+		http.Error(w, "could not get deployments", http.StatusInternalServerError)
+		return
+	}
+
+	variables, err := h.resolveVariables(&bd)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not resolve variables")
+		http.Error(w, "could not resolve variables", http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
+	defer cancel()
+	bdc, err := buildservice.GetPreparedContent(ctx, &bd, append(executionVariables(be, builder.FromArtifact(&bd, be.ArtifactPath)), variables...))
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not unmarshal build definition")
+		h.SessionService.AddMessage(w, "error", "The build definition could not be read: "+err.Error())
+		http.Redirect(w, r, showUrl, http.StatusSeeOther)
+		return
+	}
+	if err = h.loadApprovers(bd.ID, &bdc.Deployments); err != nil {
+		logger.WithField("error", err.Error()).Error("could not load approvers")
+		http.Error(w, "could not load approvers", http.StatusInternalServerError)
+		return
+	}
+
+	var rolledBack, failed []string
+	for _, j := range rollbackJobs(bdc, deployments) {
+		if !j.enabled() {
+			continue
+		}
+		if reason := rollbackRefusal(bdc, j, currentUser); reason != "" {
+			failed = append(failed, fmt.Sprintf("%s (%s)", j.remote.Host, reason))
+			continue
+		}
+		err := h.DeployService.RollbackRemoteDeployment(ctx, j.remote, j.deployment.Release, func(string) {})
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":   err.Error(),
+				"host":    j.remote.Host,
+				"release": j.deployment.Release,
+			}).Error("could not roll back remote deployment")
+			failed = append(failed, fmt.Sprintf("%s (%s)", j.remote.Host, err.Error()))
+			continue
+		}
+		rolledBack = append(rolledBack, fmt.Sprintf("%s (release %s)", j.remote.Host, j.deployment.Release))
+	}
+
+	h.Logger.SetContext("audit").WithFields(logrus.Fields{
+		"event":            "deployment_rolled_back",
+		"buildExecutionId": be.ID,
+		"userId":           currentUser.ID,
+		"hosts":            rolledBack,
+	}).Info("rolled back remote deployments")
+
+	switch {
+	case len(failed) > 0:
+		h.SessionService.AddMessage(w, "error", "Rollback failed on "+strings.Join(failed, ", "))
+	case len(rolledBack) == 0:
+		h.SessionService.AddMessage(w, "error", "This build execution has not been deployed to an enabled remote host.")
+	default:
+		h.SessionService.AddMessage(w, "success", "Rolled back on "+strings.Join(rolledBack, ", ")+".")
+	}
+	http.Redirect(w, r, showUrl, http.StatusSeeOther)
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildExecutionFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		branch    string
+		search    string
+		wantQuery string
+		wantArgs  []any
+	}{
+		{"none", "", "", "", []any{}},
+		{"branch", "main", "", "branch = ?", []any{"main"}},
+		{"search", "", "abc1234", "(commit_sha LIKE ? OR commit_message LIKE ? OR commit_author LIKE ?)",
+			[]any{"abc1234%", "%abc1234%", "%abc1234%"}},
+		{"branch and search with wildcards", "main", "100%_done", "branch = ? AND (commit_sha LIKE ? OR commit_message LIKE ? OR commit_author LIKE ?)",
+			[]any{"main", `100\%\_done%`, `%100\%\_done%`, `%100\%\_done%`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := buildExecutionFilter(tt.branch, tt.search)
+			if query != tt.wantQuery {
+				t.Errorf("expected query %q, got %q", tt.wantQuery, query)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("expected args %v, got %v", tt.wantArgs, args)
+			}
+		})
+	}
+}
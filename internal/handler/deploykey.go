@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/logging"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/sshkey"
+)
+
+// DeployKeyGenerateHandler generates a new SSH deploy key for a build definition, replacing an existing one.
+// Only the creator of the build definition and admins are allowed to do so.
+func (h *HTTPHandler) DeployKeyGenerateHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		currentUser = r.Context().Value("user").(entity.User)
+		logger      = h.ContextLogger("DeployKeyGenerateHandler")
+	)
+
+	bd, ok := h.findManageableDefinition(w, r, logger)
+	if !ok {
+		return
+	}
+
+	kp, err := sshkey.Generate(fmt.Sprintf("tiny-build-server-%d", bd.ID))
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not generate deploy key")
+		http.Error(w, "could not generate deploy key", http.StatusInternalServerError)
+		return
+	}
+	key := entity.DeployKey{
+		BuildDefinitionID: bd.ID,
+		PublicKey:         kp.PublicKey,
+		PrivateKey:        kp.PrivateKey,
+		Fingerprint:       kp.Fingerprint,
+		CreatedBy:         currentUser.ID,
+	}
+	if err = h.DBService.SaveDeployKey(&key); err != nil {
+		logger.WithField("error", err.Error()).Error("could not save deploy key")
+		http.Error(w, "could not save deploy key", http.StatusInternalServerError)
+		return
+	}
+
+	h.Logger.SetContext("audit").WithFields(logrus.Fields{
+		"event":             "deploy_key_generated",
+		"buildDefinitionId": bd.ID,
+		"userId":            currentUser.ID,
+		"fingerprint":       kp.Fingerprint,
+	}).Info("generated deploy key")
+
+	h.SessionService.AddMessage(w, "success", "A new deploy key has been generated. Add the public key to the repository at your git hoster.")
+	http.Redirect(w, r, fmt.Sprintf("/builddefinition/%d/show", bd.ID), http.StatusSeeOther)
+}
+
+// DeployKeyRemoveHandler removes the SSH deploy key of a build definition
+func (h *HTTPHandler) DeployKeyRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		currentUser = r.Context().Value("user").(entity.User)
+		logger      = h.ContextLogger("DeployKeyRemoveHandler")
+	)
+
+	bd, ok := h.findManageableDefinition(w, r, logger)
+	if !ok {
+		return
+	}
+
+	if err := h.DBService.DeleteDeployKey(bd.ID); err != nil {
+		logger.WithField("error", err.Error()).Error("could not remove deploy key")
+		http.Error(w, "could not remove deploy key", http.StatusInternalServerError)
+		return
+	}
+
+	h.Logger.SetContext("audit").WithFields(logrus.Fields{
+		"event":             "deploy_key_removed",
+		"buildDefinitionId": bd.ID,
+		"userId":            currentUser.ID,
+	}).Info("removed deploy key")
+
+	h.SessionService.AddMessage(w, "success", "The deploy key has been removed.")
+	http.Redirect(w, r, fmt.Sprintf("/builddefinition/%d/show", bd.ID), http.StatusSeeOther)
+}
+
+// findManageableDefinition fetches the build definition of the request, if the current user is its creator or an admin.
+// Otherwise, an error response is written.
+func (h *HTTPHandler) findManageableDefinition(w http.ResponseWriter, r *http.Request, logger logging.ILogger) (entity.BuildDefinition, bool) {
+	currentUser := r.Context().Value("user").(entity.User)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not parse build definition id")
+		http.Error(w, "could not parse build definition id", http.StatusBadRequest)
+		return entity.BuildDefinition{}, false
+	}
+	bd, err := h.DBService.GetBuildDefinitionById(uint(id))
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    id,
+		}).Error("could not get build definition by ID")
+		http.Error(w, "could not get build definition by ID", http.StatusNotFound)
+		return entity.BuildDefinition{}, false
+	}
+
+	if bd.CreatedBy != currentUser.ID && !currentUser.Admin {
+		logger.WithField("id", bd.ID).Info("user is not allowed to manage build definition")
+		h.SessionService.AddMessage(w, "error", "You are not allowed to manage this build definition")
+		http.Redirect(w, r, fmt.Sprintf("/builddefinition/%d/show", bd.ID), http.StatusSeeOther)
+		return entity.BuildDefinition{}, false
+	}
+
+	return bd, true
+}
@@ -0,0 +1,527 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/builder"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/buildservice"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/common"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/deploymentservice"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/logging"
+)
+
+// job is the deployment of a build to a single target of the build definition
+type job struct {
+	local  *entity.LocalDeployment
+	email  *entity.EmailDeployment
+	remote *entity.RemoteDeployment
+	http   *entity.HTTPDeployment
+	s3     *entity.S3Deployment
+	// index is the position of the target within the deployments of its kind
+	index      int
+	deployment *entity.Deployment
+	err        error
+}
+
+func (j job) kind() entity.DeploymentKind {
+	switch {
+	case j.local != nil:
+		return entity.DeploymentLocal
+	case j.email != nil:
+		return entity.DeploymentEmail
+	case j.http != nil:
+		return entity.DeploymentHTTP
+	case j.s3 != nil:
+		return entity.DeploymentS3
+	default:
+		return entity.DeploymentRemote
+	}
+}
+
+func (j job) target() string {
+	switch {
+	case j.local != nil:
+		return j.local.Describe()
+	case j.email != nil:
+		return j.email.Describe()
+	case j.http != nil:
+		return j.http.Describe()
+	case j.s3 != nil:
+		return j.s3.Describe()
+	default:
+		return j.remote.Describe()
+	}
+}
+
+func (j job) environment() string {
+	switch {
+	case j.local != nil:
+		return j.local.Environment
+	case j.email != nil:
+		return j.email.Environment
+	case j.http != nil:
+		return j.http.Environment
+	case j.s3 != nil:
+		return j.s3.Environment
+	default:
+		return j.remote.Environment
+	}
+}
+
+func (j job) enabled() bool {
+	switch {
+	case j.local != nil:
+		return j.local.Enabled
+	case j.email != nil:
+		return j.email.Enabled
+	case j.http != nil:
+		return j.http.Enabled
+	case j.s3 != nil:
+		return j.s3.Enabled
+	default:
+		return j.remote != nil && j.remote.Enabled
+	}
+}
+
+const (
+	errMsg = "failed %s deployment: %s"
+	// numDeployWorkers is the number of deployments running in parallel
+	numDeployWorkers = 3
+)
+
+// deploymentJobs returns a job for every deployment target of the build definition content
+func deploymentJobs(bdc *entity.BuildDefinitionContent) []job {
+	jobs := make([]job, 0)
+	for i := range bdc.Deployments.LocalDeployments {
+		jobs = append(jobs, job{local: &bdc.Deployments.LocalDeployments[i], index: i})
+	}
+	for i := range bdc.Deployments.EmailDeployments {
+		jobs = append(jobs, job{email: &bdc.Deployments.EmailDeployments[i], index: i})
+	}
+	for i := range bdc.Deployments.RemoteDeployments {
+		jobs = append(jobs, job{remote: &bdc.Deployments.RemoteDeployments[i], index: i})
+	}
+	for i := range bdc.Deployments.HTTPDeployments {
+		jobs = append(jobs, job{http: &bdc.Deployments.HTTPDeployments[i], index: i})
+	}
+	for i := range bdc.Deployments.S3Deployments {
+		jobs = append(jobs, job{s3: &bdc.Deployments.S3Deployments[i], index: i})
+	}
+	return jobs
+}
+
+// findDeploymentJob returns the job of the target a deployment was made to, if the target is still
+// part of the build definition content
+func findDeploymentJob(bdc *entity.BuildDefinitionContent, d entity.Deployment) (job, bool) {
+	for _, j := range deploymentJobs(bdc) {
+		if j.kind() == d.Kind && j.index == d.Index && j.target() == d.Target {
+			return j, true
+		}
+	}
+	return job{}, false
+}
+
+// rollbackJobs returns a job for every remote deployment target of the build definition content keeping
+// releases, which the build execution was deployed to successfully. The deployment of a job is the newest
+// successful deployment to the target, with the release to roll back to.
+func rollbackJobs(bdc *entity.BuildDefinitionContent, deployments []entity.Deployment) []job {
+	jobs := make([]job, 0)
+	for _, j := range deploymentJobs(bdc) {
+		if j.remote == nil || !j.remote.SupportsReleases() {
+			continue
+		}
+		// deployments are ordered oldest first
+		for i := range deployments {
+			d := &deployments[i]
+			if d.Status == entity.StatusSucceeded && d.Release != "" && d.Kind == j.kind() && d.Index == j.index && d.Target == j.target() {
+				j.deployment = d
+			}
+		}
+		if j.deployment != nil {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs
+}
+
+// rollbackRefusal returns why the user may not roll back the target of the job, or an empty string if
+// they may. Like deployments, rollbacks in environments with approvers need one of the approvers.
+func rollbackRefusal(bdc *entity.BuildDefinitionContent, j job, user entity.User) string {
+	env, found := bdc.Deployments.GetEnvironment(j.environment())
+	switch {
+	case j.environment() != "" && !found:
+		return fmt.Sprintf("environment '%s' is not defined", j.environment())
+	case env.IsGated() && !env.IsApprover(user):
+		return fmt.Sprintf("only the approvers of environment %s may roll back", env.Name)
+	}
+	return ""
+}
+
+// runDeployments deploys the build to the enabled targets of the given jobs on a pool of workers.
+// Every target gets a deployment of its own, keeping status and log; failures are added to
+// the report of the build as well.
+// Deployments to environments with approvers are only recorded and wait for approval, unless
+// the job already has an approved deployment.
+func (h *HTTPHandler) runDeployments(ctx context.Context, be *entity.BuildExecution, build *builder.Build, bdc *entity.BuildDefinitionContent, jobs []job, triggeredBy uint) {
+	logger := h.ContextLogger("runDeployments").WithField("buildExecutionId", be.ID)
+
+	queue := make([]job, 0, len(jobs))
+	for _, j := range jobs {
+		if !j.enabled() {
+			continue
+		}
+		if j.deployment != nil {
+			j.deployment.Status = entity.StatusCreated
+			h.saveDeployment(j.deployment)
+			queue = append(queue, j)
+			continue
+		}
+
+		j.deployment = &entity.Deployment{
+			BuildDefinitionID: be.BuildDefinitionID,
+			BuildExecutionID:  be.ID,
+			Kind:              j.kind(),
+			Index:             j.index,
+			Target:            j.target(),
+			Environment:       j.environment(),
+			Status:            entity.StatusCreated,
+			TriggeredBy:       triggeredBy,
+		}
+		env, found := bdc.Deployments.GetEnvironment(j.deployment.Environment)
+		switch {
+		case j.deployment.Environment != "" && !found:
+			j.deployment.Status = entity.StatusFailed
+			j.deployment.FinishedAt = time.Now()
+			j.deployment.Log = fmt.Sprintf("environment '%s' is not defined", j.deployment.Environment)
+			build.AddReportEntry(fmt.Sprintf(errMsg, j.kind(), j.deployment.Log))
+		case env.IsGated():
+			j.deployment.Status = entity.StatusAwaitingApproval
+			j.deployment.ExpiresAt = time.Now().Add(env.GetApprovalTimeout())
+			build.AddReportEntry(fmt.Sprintf("%s deployment to %s awaits approval for environment %s", j.kind(), j.target(), env.Name))
+		}
+		if err := h.DBService.AddDeployment(j.deployment); err != nil {
+			logger.WithField("error", err.Error()).Error("could not add deployment")
+		}
+		if j.deployment.Status == entity.StatusCreated {
+			queue = append(queue, j)
+		}
+	}
+
+	pending := make(chan job, len(queue))
+	results := make(chan job, len(queue))
+	for i := 0; i < numDeployWorkers; i++ {
+		go func() {
+			for j := range pending {
+				logger.Tracef("processing %s deployment", j.kind())
+				results <- h.deploy(ctx, j, build, bdc.Repository.Name)
+			}
+		}()
+	}
+	for _, j := range queue {
+		pending <- j
+	}
+	close(pending)
+
+	for range queue {
+		r := <-results
+		if r.err != nil {
+			logger.Tracef("%s deployment failed", r.kind())
+			build.AddReportEntry(fmt.Sprintf(errMsg, r.kind(), r.err))
+			continue
+		}
+		build.AddReportEntry(fmt.Sprintf("%s deployment to %s succeeded", r.kind(), r.target()))
+	}
+}
+
+// deploy runs a single deployment job, keeping its deployment up to date
+func (h *HTTPHandler) deploy(ctx context.Context, j job, build *builder.Build, repoName string) job {
+	d := j.deployment
+	d.Status = entity.StatusRunning
+	d.StartedAt = time.Now()
+	h.saveDeployment(d)
+
+	b := build.Fork()
+	b.AddReportEntry(fmt.Sprintf("deploying to %s", d.Target))
+	switch {
+	case j.local != nil:
+		j.err = h.DeployService.DoLocalDeployment(ctx, j.local, b)
+	case j.email != nil:
+		j.err = h.DeployService.DoEmailDeployment(ctx, j.email, repoName, b)
+	case j.remote != nil:
+		j.err = h.DeployService.DoRemoteDeployment(ctx, j.remote, b)
+	case j.http != nil:
+		j.err = h.DeployService.DoHTTPDeployment(ctx, j.http, b)
+	case j.s3 != nil:
+		j.err = h.DeployService.DoS3Deployment(ctx, j.s3, b)
+	}
+
+	d.FinishedAt = time.Now()
+	switch {
+	case j.err == nil:
+		b.AddReportEntry("deployment succeeded")
+		d.Status = entity.StatusSucceeded
+		if j.remote != nil && j.remote.SupportsReleases() {
+			d.Release = b.GetRelease()
+		}
+	case ctx.Err() != nil:
+		b.AddReportEntry("deployment canceled: " + j.err.Error())
+		d.Status = entity.StatusCanceled
+	default:
+		b.AddReportEntry("deployment failed: " + j.err.Error())
+		d.Status = entity.StatusFailed
+	}
+	d.Log = b.GetReport()
+	h.saveDeployment(d)
+
+	return j
+}
+
+func (h *HTTPHandler) saveDeployment(d *entity.Deployment) {
+	if err := h.DBService.UpdateDeployment(d); err != nil {
+		h.Logger.WithFields(logrus.Fields{
+			"ID":    d.ID,
+			"error": err.Error(),
+		}).Error("failed to update deployment")
+	}
+}
+
+// BuildExecutionRedeployHandler deploys the artifact of a build execution again to all enabled
+// targets of its build definition, without building it again
+func (h *HTTPHandler) BuildExecutionRedeployHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		currentUser = r.Context().Value("user").(entity.User)
+		logger      = h.ContextLogger("BuildExecutionRedeployHandler")
+	)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not parse entry ID")
+		http.Error(w, "could not parse build execution id", http.StatusBadRequest)
+		return
+	}
+	be, bd, ok := h.findManageableExecution(w, r, uint(id), logger)
+	if !ok {
+		return
+	}
+	showUrl := fmt.Sprintf("/buildexecution/%d/show", be.ID)
+
+	build, bdc, err := h.prepareRedeployment(r.Context(), be, bd)
+	if err != nil {
+		logger.WithField("error", err.Error()).Info("could not prepare redeployment")
+		h.SessionService.AddMessage(w, "error", "The artifact cannot be deployed again: "+err.Error())
+		http.Redirect(w, r, showUrl, http.StatusSeeOther)
+		return
+	}
+
+	h.Logger.SetContext("audit").WithFields(logrus.Fields{
+		"event":            "build_execution_redeployed",
+		"buildExecutionId": be.ID,
+		"userId":           currentUser.ID,
+	}).Info("redeployed build execution")
+
+	go h.redeploy(be, build, bdc, deploymentJobs(bdc), currentUser.ID)
+
+	h.SessionService.AddMessage(w, "success", "The artifact is being deployed again.")
+	http.Redirect(w, r, showUrl, http.StatusSeeOther)
+}
+
+// DeploymentRetryHandler runs a failed deployment again, if its target is still part of the build definition
+func (h *HTTPHandler) DeploymentRetryHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		currentUser = r.Context().Value("user").(entity.User)
+		logger      = h.ContextLogger("DeploymentRetryHandler")
+	)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not parse entry ID")
+		http.Error(w, "could not parse deployment id", http.StatusBadRequest)
+		return
+	}
+	d, err := h.DBService.GetDeploymentById(uint(id))
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    id,
+		}).Error("could not get deployment by ID")
+		http.Error(w, "could not find deployment", http.StatusNotFound)
+		return
+	}
+	be, bd, ok := h.findManageableExecution(w, r, d.BuildExecutionID, logger)
+	if !ok {
+		return
+	}
+	showUrl := fmt.Sprintf("/buildexecution/%d/show", be.ID)
+
+	if d.Status != entity.StatusFailed && d.Status != entity.StatusCanceled {
+		h.SessionService.AddMessage(w, "error", "Only failed deployments can be retried.")
+		http.Redirect(w, r, showUrl, http.StatusSeeOther)
+		return
+	}
+	build, bdc, err := h.prepareRedeployment(r.Context(), be, bd)
+	if err != nil {
+		logger.WithField("error", err.Error()).Info("could not prepare redeployment")
+		h.SessionService.AddMessage(w, "error", "The deployment cannot be retried: "+err.Error())
+		http.Redirect(w, r, showUrl, http.StatusSeeOther)
+		return
+	}
+	j, found := findDeploymentJob(bdc, d)
+	if !found || !j.enabled() {
+		h.SessionService.AddMessage(w, "error", "The target of the deployment is no longer part of the build definition or has been disabled.")
+		http.Redirect(w, r, showUrl, http.StatusSeeOther)
+		return
+	}
+
+	h.Logger.SetContext("audit").WithFields(logrus.Fields{
+		"event":            "deployment_retried",
+		"buildExecutionId": be.ID,
+		"deploymentId":     d.ID,
+		"userId":           currentUser.ID,
+	}).Info("retried deployment")
+
+	go h.redeploy(be, build, bdc, []job{j}, currentUser.ID)
+
+	h.SessionService.AddMessage(w, "success", "The deployment is being retried.")
+	http.Redirect(w, r, showUrl, http.StatusSeeOther)
+}
+
+// prepareRedeployment returns the build the artifact of the build execution was packed from,
+// together with the build definition content to deploy it with
+func (h *HTTPHandler) prepareRedeployment(ctx context.Context, be entity.BuildExecution, bd entity.BuildDefinition) (*builder.Build, *entity.BuildDefinitionContent, error) {
+	build, bdc, err := h.deploymentContent(ctx, be, bd)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = checkArtifact(build); err != nil {
+		return nil, nil, err
+	}
+	return build, bdc, nil
+}
+
+// checkArtifact makes sure the artifact and the build directory it was packed from still exist
+func checkArtifact(build *builder.Build) error {
+	if build.GetArtifact() == "" {
+		return errors.New("the build execution has no artifact")
+	}
+	for _, p := range []string{build.GetArtifact(), build.GetBuildDir()} {
+		if _, err := os.Stat(p); err != nil {
+			return errors.New("the artifact has been removed")
+		}
+	}
+	return nil
+}
+
+// deploymentContent returns the build of the build execution and the build definition content to
+// deploy it with. The build is not checked for existence.
+func (h *HTTPHandler) deploymentContent(ctx context.Context, be entity.BuildExecution, bd entity.BuildDefinition) (*builder.Build, *entity.BuildDefinitionContent, error) {
+	build := builder.FromArtifact(&bd, be.ArtifactPath)
+	variables, err := h.resolveVariables(&bd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not resolve variables: %w", err)
+	}
+	bdc, err := buildservice.GetPreparedContent(ctx, &bd, append(executionVariables(be, build), variables...))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not unmarshal build definition: %w", err)
+	}
+	addSecrets(build, bdc, variables)
+	build.SetVersion(be.Version)
+	build.SetRelease(deploymentservice.ReleaseName(be.ID, time.Now()))
+
+	return build, bdc, nil
+}
+
+// redeploy runs the given deployment jobs for an already finished build execution
+func (h *HTTPHandler) redeploy(be entity.BuildExecution, build *builder.Build, bdc *entity.BuildDefinitionContent, jobs []job, userID uint) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	h.runDeployments(ctx, &be, build, bdc, jobs, userID)
+}
+
+// findManageableExecution fetches the build execution with the given id and its build definition, if the
+// current user is the creator of the build definition or an admin. Otherwise, an error response is written.
+func (h *HTTPHandler) findManageableExecution(w http.ResponseWriter, r *http.Request, id uint, logger logging.ILogger) (entity.BuildExecution, entity.BuildDefinition, bool) {
+	currentUser := r.Context().Value("user").(entity.User)
+
+	be, err := h.DBService.GetBuildExecutionById(int(id))
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    id,
+		}).Error("could not scan buildExecution")
+		http.Error(w, "could not find build execution", http.StatusNotFound)
+		return entity.BuildExecution{}, entity.BuildDefinition{}, false
+	}
+	bd, err := h.DBService.GetBuildDefinitionById(be.BuildDefinitionID)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error":             err.Error(),
+			"buildDefinitionId": be.BuildDefinitionID,
+		}).Error("could not scan buildDefinition")
+		http.Error(w, "could not find build definition", http.StatusNotFound)
+		return entity.BuildExecution{}, entity.BuildDefinition{}, false
+	}
+
+	if bd.CreatedBy != currentUser.ID && !currentUser.Admin {
+		logger.WithField("id", bd.ID).Info("user is not allowed to manage build definition")
+		h.SessionService.AddMessage(w, "error", "You are not allowed to manage this build definition")
+		http.Redirect(w, r, fmt.Sprintf("/buildexecution/%d/show", be.ID), http.StatusSeeOther)
+		return entity.BuildExecution{}, entity.BuildDefinition{}, false
+	}
+
+	return be, bd, true
+}
+
+// executionVariables returns the special variables of a build execution. Build parameters
+// take precedence over all other variables.
+func executionVariables(be entity.BuildExecution, build *builder.Build) []entity.UserVariable {
+	vars := []entity.UserVariable{{
+		Variable: "buildDir",
+		Value:    build.GetBuildDir(),
+	}, {
+		Variable: "cloneDir",
+		Value:    build.GetCloneDir(),
+	}, {
+		Variable: "branch",
+		Value:    be.Branch,
+	}, {
+		Variable: "version",
+		Value:    be.Version,
+	}, {
+		Variable: "pullRequest",
+		Value:    fmt.Sprintf("%d", be.PullRequest),
+	}}
+	return append(vars, common.ParametersToVariables(be.GetParameters())...)
+}
+
+// addSecrets registers the values of secret variables and all credentials of the build definition
+// content as secrets of the build, so they are masked in reports
+func addSecrets(build *builder.Build, bdc *entity.BuildDefinitionContent, variables []entity.UserVariable) {
+	for _, v := range variables {
+		if v.Secret {
+			build.AddSecrets(v.Value)
+		}
+	}
+	build.AddSecrets(bdc.Repository.AccessSecret, bdc.StatusReport.Token)
+	for _, rd := range bdc.Deployments.RemoteDeployments {
+		build.AddSecrets(rd.Password, rd.PrivateKey, rd.Passphrase)
+	}
+	for _, hd := range bdc.Deployments.HTTPDeployments {
+		build.AddSecrets(hd.Password, hd.BearerToken)
+	}
+	for _, sd := range bdc.Deployments.S3Deployments {
+		build.AddSecrets(sd.SecretAccessKey)
+	}
+}
@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/builder"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/dbservice"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/logging"
+)
+
+// fakeDeployer fails all local deployments to /fail and succeeds otherwise
+type fakeDeployer struct{}
+
+func (fakeDeployer) DoLocalDeployment(ctx context.Context, deployment *entity.LocalDeployment, build *builder.Build) error {
+	build.AddReportEntry("copying artifact to " + deployment.Path)
+	if deployment.Path == "/fail" {
+		return errors.New("disk full")
+	}
+	return nil
+}
+func (fakeDeployer) DoEmailDeployment(ctx context.Context, deployment *entity.EmailDeployment, repoName string, build *builder.Build) error {
+	return nil
+}
+func (fakeDeployer) DoRemoteDeployment(ctx context.Context, deployment *entity.RemoteDeployment, build *builder.Build) error {
+	build.AddReportEntry("logging in with " + deployment.Password)
+	return nil
+}
+func (fakeDeployer) DoHTTPDeployment(ctx context.Context, deployment *entity.HTTPDeployment, build *builder.Build) error {
+	build.AddReportEntry("authorizing with " + deployment.BearerToken)
+	return nil
+}
+func (fakeDeployer) DoS3Deployment(ctx context.Context, deployment *entity.S3Deployment, build *builder.Build) error {
+	return nil
+}
+func (fakeDeployer) RollbackRemoteDeployment(ctx context.Context, deployment *entity.RemoteDeployment, release string, report func(string)) error {
+	return nil
+}
+
+// deploymentRecorder keeps the deployments in memory
+type deploymentRecorder struct {
+	dbservice.DBServiceMock
+	mut         sync.Mutex
+	deployments map[uint]entity.Deployment
+}
+
+func (d *deploymentRecorder) AddDeployment(deployment *entity.Deployment) error {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if d.deployments == nil {
+		d.deployments = make(map[uint]entity.Deployment)
+	}
+	deployment.ID = uint(len(d.deployments) + 1)
+	d.deployments[deployment.ID] = *deployment
+	return nil
+}
+
+func (d *deploymentRecorder) UpdateDeployment(deployment *entity.Deployment) error {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	d.deployments[deployment.ID] = *deployment
+	return nil
+}
+
+func TestRunDeployments(t *testing.T) {
+	logger, _, _ := logging.NewLogger(logging.LevelDebug, "", "", logging.ModeDiscard)
+	recorder := &deploymentRecorder{}
+	h := &HTTPHandler{
+		Logger:        logger,
+		DBService:     recorder,
+		DeployService: fakeDeployer{},
+	}
+
+	bdc := &entity.BuildDefinitionContent{}
+	bdc.Deployments.LocalDeployments = []entity.LocalDeployment{
+		{Enabled: true, Path: "/ok"},
+		{Enabled: true, Path: "/fail"},
+		{Enabled: false, Path: "/disabled"},
+	}
+	bdc.Deployments.RemoteDeployments = []entity.RemoteDeployment{
+		{Enabled: true, Host: "example.org", Username: "deploy", Password: "s3cr3t", WorkingDirectory: "/opt/app"},
+	}
+	bdc.Deployments.HTTPDeployments = []entity.HTTPDeployment{
+		{Enabled: true, URL: "https://example.org/upload?token=t0k3n", BearerToken: "t0k3n"},
+	}
+	be := &entity.BuildExecution{}
+	be.ID = 7
+	build := builder.NewBuild(&entity.BuildDefinition{}, t.TempDir())
+	addSecrets(build, bdc, nil)
+	build.SetRelease("20210304050607-7")
+
+	h.runDeployments(context.Background(), be, build, bdc, deploymentJobs(bdc), 3)
+
+	if len(recorder.deployments) != 4 {
+		t.Fatalf("expected 4 deployments, got %d", len(recorder.deployments))
+	}
+	want := map[string]entity.BuildStatus{
+		"/ok":                                  entity.StatusSucceeded,
+		"/fail":                                entity.StatusFailed,
+		"sftp://deploy@example.org:22/opt/app": entity.StatusSucceeded,
+		"POST https://example.org/upload":      entity.StatusSucceeded,
+	}
+	for _, d := range recorder.deployments {
+		if d.Status != want[d.Target] {
+			t.Errorf("expected status %s for %s, got %s", want[d.Target], d.Target, d.Status)
+		}
+		if d.BuildExecutionID != 7 || d.TriggeredBy != 3 || !d.Finished() {
+			t.Errorf("unexpected deployment %+v", d)
+		}
+		if strings.Contains(d.Log, "s3cr3t") || strings.Contains(d.Log, "t0k3n") {
+			t.Errorf("expected secrets to be masked in log of %s", d.Target)
+		}
+	}
+	if d := recorder.deployments[2]; !strings.Contains(d.Log, "disk full") || strings.Contains(d.Log, "/ok") {
+		t.Errorf("expected the log to contain the output of the deployment only, got %q", d.Log)
+	}
+	if d := recorder.deployments[3]; d.Kind != entity.DeploymentRemote || d.Release != "20210304050607-7" {
+		t.Errorf("expected the release of the remote deployment to be recorded, got %+v", d)
+	}
+	if !strings.Contains(build.GetReport(), "failed local deployment: disk full") {
+		t.Errorf("expected the failure to be reported, got %q", build.GetReport())
+	}
+}
+
+func TestFindDeploymentJob(t *testing.T) {
+	bdc := &entity.BuildDefinitionContent{}
+	bdc.Deployments.LocalDeployments = []entity.LocalDeployment{{Enabled: true, Path: "/a"}, {Enabled: true, Path: "/b"}}
+	bdc.Deployments.EmailDeployments = []entity.EmailDeployment{{Enabled: true, Address: "a@example.org"}}
+
+	j, ok := findDeploymentJob(bdc, entity.Deployment{Kind: entity.DeploymentLocal, Index: 1, Target: "/b"})
+	if !ok || j.local == nil || j.local.Path != "/b" {
+		t.Errorf("expected to find the second local deployment, got %+v", j)
+	}
+	if _, ok = findDeploymentJob(bdc, entity.Deployment{Kind: entity.DeploymentLocal, Index: 1, Target: "/c"}); ok {
+		t.Error("expected a changed target not to be found")
+	}
+	if _, ok = findDeploymentJob(bdc, entity.Deployment{Kind: entity.DeploymentEmail, Index: 0, Target: "mailto:a@example.org"}); !ok {
+		t.Error("expected to find the email deployment")
+	}
+}
+
+func TestRollbackJobs(t *testing.T) {
+	bdc := &entity.BuildDefinitionContent{}
+	bdc.Deployments.RemoteDeployments = []entity.RemoteDeployment{
+		{Enabled: true, Host: "a.example.org", Username: "deploy", WorkingDirectory: "/opt/app"},
+		{Enabled: true, Host: "b.example.org", Username: "deploy", WorkingDirectory: "/opt/app"},
+		{Enabled: true, Host: "c.example.org", Username: "deploy", WorkingDirectory: "/opt/app"},
+		{Enabled: true, ConnectionType: "ftp", Host: "d.example.org", Username: "deploy"},
+	}
+	remote := func(i int, release string, status entity.BuildStatus) entity.Deployment {
+		return entity.Deployment{
+			Kind:    entity.DeploymentRemote,
+			Index:   i,
+			Target:  bdc.Deployments.RemoteDeployments[i].Describe(),
+			Release: release,
+			Status:  status,
+		}
+	}
+	deployments := []entity.Deployment{
+		remote(0, "20210304050607-7", entity.StatusSucceeded),
+		remote(1, "20210304050607-7", entity.StatusSucceeded),
+		remote(0, "20210305000000-7", entity.StatusSucceeded),
+		remote(1, "", entity.StatusFailed),
+		remote(2, "", entity.StatusFailed),
+		remote(3, "", entity.StatusSucceeded),
+	}
+
+	jobs := rollbackJobs(bdc, deployments)
+	if len(jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(jobs))
+	}
+	want := map[string]string{
+		"a.example.org": "20210305000000-7",
+		"b.example.org": "20210304050607-7",
+	}
+	for _, j := range jobs {
+		if j.deployment.Release != want[j.remote.Host] {
+			t.Errorf("expected release %s for %s, got %s", want[j.remote.Host], j.remote.Host, j.deployment.Release)
+		}
+	}
+}
+
+func TestRollbackRefusal(t *testing.T) {
+	bdc := &entity.BuildDefinitionContent{}
+	bdc.Deployments.Environments = []entity.Environment{
+		{Name: "staging"},
+		{Name: "production", Approvers: []string{"Jane"}, ApproverIDs: []uint{7}},
+	}
+	owner := entity.User{Admin: true}
+	owner.ID = 3
+	approver := entity.User{}
+	approver.ID = 7
+
+	tests := []struct {
+		name        string
+		environment string
+		user        entity.User
+		wantRefused bool
+	}{
+		{"no environment", "", owner, false},
+		{"ungated environment", "staging", owner, false},
+		{"gated environment, approver", "production", approver, false},
+		{"gated environment, admin", "production", owner, true},
+		{"undefined environment", "qa", owner, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := job{remote: &entity.RemoteDeployment{Enabled: true, Host: "example.org", Environment: tt.environment}}
+			if reason := rollbackRefusal(bdc, j, tt.user); (reason != "") != tt.wantRefused {
+				t.Errorf("expected refused to be %t, got reason %q", tt.wantRefused, reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/security"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/templateservice"
+)
+
+// environmentHistory is the number of recent deployments the environment page is computed from
+const environmentHistory = 500
+
+var (
+	errDeploymentNotFound  = errors.New("deployment not found")
+	errNotAwaitingApproval = errors.New("the deployment does not await approval")
+	errApprovalExpired     = errors.New("the approval of the deployment has expired")
+	errUnknownEnvironment  = errors.New("the environment is no longer part of the build definition")
+	errNotApprover         = errors.New("you are not an approver of the environment")
+)
+
+// environmentStatus is what is currently deployed to an environment and what awaits approval
+type environmentStatus struct {
+	Environment entity.Environment
+	// Current holds the newest successful deployment of every target of the environment
+	Current []entity.Deployment
+	// Pending holds the deployments awaiting approval
+	Pending    []entity.Deployment
+	CanApprove bool
+}
+
+// environmentStatuses determines the status of each environment from the given deployments, newest first
+func environmentStatuses(envs []entity.Environment, deployments []entity.Deployment, user entity.User) []environmentStatus {
+	statuses := make([]environmentStatus, 0, len(envs))
+	for _, env := range envs {
+		status := environmentStatus{Environment: env, CanApprove: env.IsApprover(user)}
+		seen := make(map[string]bool)
+		for _, d := range deployments {
+			if d.Environment != env.Name {
+				continue
+			}
+			switch d.Status {
+			case entity.StatusSucceeded:
+				if !seen[d.Target] {
+					seen[d.Target] = true
+					status.Current = append(status.Current, d)
+				}
+			case entity.StatusAwaitingApproval:
+				status.Pending = append(status.Pending, d)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// resolveApprovers resolves the approvers of all environments of the raw build definition to users,
+// by email address or else by display name. Unknown approvers are an error.
+func (h *HTTPHandler) resolveApprovers(raw string) ([]entity.EnvironmentApprover, error) {
+	var content entity.BuildDefinitionContent
+	if err := yaml.Unmarshal([]byte(raw), &content); err != nil {
+		return nil, nil
+	}
+
+	approvers := make([]entity.EnvironmentApprover, 0)
+	for _, env := range content.Deployments.Environments {
+		for _, a := range env.Approvers {
+			u, err := h.DBService.GetUserByEmail(a)
+			if err != nil {
+				u, err = h.DBService.FindUser("display_name = ?", a)
+			}
+			if err != nil || u.ID == 0 {
+				return nil, fmt.Errorf("approver '%s' of environment '%s' is not a user", a, env.Name)
+			}
+			approvers = append(approvers, entity.EnvironmentApprover{Environment: env.Name, UserID: u.ID})
+		}
+	}
+	return approvers, nil
+}
+
+// loadApprovers assigns the approvers resolved when the build definition was saved to its environments
+func (h *HTTPHandler) loadApprovers(bdID uint, deployments *entity.Deployments) error {
+	approvers, err := h.DBService.GetEnvironmentApprovers(bdID)
+	if err != nil {
+		return fmt.Errorf("could not get approvers: %w", err)
+	}
+	deployments.SetApprovers(approvers)
+	return nil
+}
+
+// BuildDefinitionEnvironmentsHandler shows the environments of a build definition, what is currently
+// deployed to them and which deployments await approval
+func (h *HTTPHandler) BuildDefinitionEnvironmentsHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		currentUser = r.Context().Value("user").(entity.User)
+		logger      = h.ContextLogger("BuildDefinitionEnvironmentsHandler")
+	)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not parse build definition id")
+		http.Error(w, "could not parse build definition id", http.StatusBadRequest)
+		return
+	}
+	bd, err := h.DBService.GetBuildDefinitionById(uint(id))
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+			"id":    id,
+		}).Error("could not get build definition by ID")
+		http.Error(w, "could not get build definition by ID", http.StatusNotFound)
+		return
+	}
+	if _, err = h.LoadBuildDefinition(&bd); err != nil {
+		logger.WithField("error", err.Error()).Error("could not load build definition")
+		http.Error(w, "could not load build definition: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err = h.loadApprovers(bd.ID, &bd.Data.Deployments); err != nil {
+		logger.WithField("error", err.Error()).Error("could not load approvers")
+		http.Error(w, "could not load approvers", http.StatusInternalServerError)
+		return
+	}
+
+	if err = h.DBService.ExpireDeployments(time.Now()); err != nil {
+		logger.WithField("error", err.Error()).Error("could not expire deployments")
+	}
+	deployments, err := h.DBService.GetDeploymentsByBuildDefinition(bd.ID, environmentHistory)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not get deployments")
+		http.Error(w, "could not get deployments", http.StatusInternalServerError)
+		return
+	}
+	statuses := environmentStatuses(bd.Data.Deployments.Environments, deployments, currentUser)
+
+	// the executions are needed for their version and commit
+	ids := make([]uint, 0)
+	for _, s := range statuses {
+		for _, d := range append(s.Current, s.Pending...) {
+			ids = append(ids, d.BuildExecutionID)
+		}
+	}
+	executions := make(map[uint]entity.BuildExecution, len(ids))
+	if len(ids) > 0 {
+		found, err := h.DBService.FindBuildExecutions("id IN ?", ids)
+		if err != nil {
+			logger.WithField("error", err.Error()).Error("could not get build executions")
+			http.Error(w, "could not get build executions", http.StatusInternalServerError)
+			return
+		}
+		for _, be := range found {
+			executions[be.ID] = be
+		}
+	}
+
+	data := struct {
+		CurrentUser     entity.User
+		BuildDefinition entity.BuildDefinition
+		Environments    []environmentStatus
+		Executions      map[uint]entity.BuildExecution
+	}{
+		CurrentUser:     currentUser,
+		BuildDefinition: bd,
+		Environments:    statuses,
+		Executions:      executions,
+	}
+
+	if err = templateservice.ExecuteTemplate(h.Injector(), w, "builddefinition_environments.html", data); err != nil {
+		w.WriteHeader(404)
+	}
+}
+
+// DeploymentApproveHandler approves the deployments of a build execution to an environment
+func (h *HTTPHandler) DeploymentApproveHandler(w http.ResponseWriter, r *http.Request) {
+	h.handleDecision(w, r, true)
+}
+
+// DeploymentRejectHandler rejects the deployments of a build execution to an environment
+func (h *HTTPHandler) DeploymentRejectHandler(w http.ResponseWriter, r *http.Request) {
+	h.handleDecision(w, r, false)
+}
+
+func (h *HTTPHandler) handleDecision(w http.ResponseWriter, r *http.Request, approve bool) {
+	defer r.Body.Close()
+	var (
+		currentUser = r.Context().Value("user").(entity.User)
+		logger      = h.ContextLogger("handleDecision")
+	)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not parse deployment id")
+		http.Error(w, "could not parse deployment id", http.StatusBadRequest)
+		return
+	}
+
+	d, err := h.decideDeployment(r.Context(), currentUser, uint(id), approve)
+	if errors.Is(err, errDeploymentNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	showUrl := fmt.Sprintf("/buildexecution/%d/show", d.BuildExecutionID)
+	if err != nil {
+		h.SessionService.AddMessage(w, "error", "Could not decide on the deployment: "+err.Error())
+		http.Redirect(w, r, showUrl, http.StatusSeeOther)
+		return
+	}
+
+	if approve {
+		h.SessionService.AddMessage(w, "success", fmt.Sprintf("The deployments to %s have been approved and are running.", d.Environment))
+	} else {
+		h.SessionService.AddMessage(w, "success", fmt.Sprintf("The deployments to %s have been rejected.", d.Environment))
+	}
+	http.Redirect(w, r, showUrl, http.StatusSeeOther)
+}
+
+// APIDeploymentApproveHandler approves the deployments of a build execution to an environment.
+// The approver authenticates with email address and password using basic auth.
+func (h *HTTPHandler) APIDeploymentApproveHandler(w http.ResponseWriter, r *http.Request) {
+	h.handleAPIDecision(w, r, true)
+}
+
+// APIDeploymentRejectHandler rejects the deployments of a build execution to an environment.
+// The approver authenticates with email address and password using basic auth.
+func (h *HTTPHandler) APIDeploymentRejectHandler(w http.ResponseWriter, r *http.Request) {
+	h.handleAPIDecision(w, r, false)
+}
+
+func (h *HTTPHandler) handleAPIDecision(w http.ResponseWriter, r *http.Request, approve bool) {
+	defer r.Body.Close()
+	logger := h.ContextLogger("handleAPIDecision")
+
+	email, password, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Tiny Build Server"`)
+		http.Error(w, "missing credentials", http.StatusUnauthorized)
+		return
+	}
+	user, err := h.DBService.GetUserByEmail(email)
+	if err != nil || user.Locked || !security.DoesHashMatch(password, user.Password) {
+		logger.WithField("email", email).Info("invalid credentials")
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "could not parse deployment id", http.StatusBadRequest)
+		return
+	}
+
+	d, err := h.decideDeployment(r.Context(), user, uint(id), approve)
+	switch {
+	case errors.Is(err, errDeploymentNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, errNotApprover):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, errNotAwaitingApproval), errors.Is(err, errApprovalExpired), errors.Is(err, errUnknownEnvironment):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"id":               d.ID,
+		"buildExecutionId": d.BuildExecutionID,
+		"environment":      d.Environment,
+		"status":           d.Status,
+	})
+}
+
+// decideDeployment approves or rejects the deployment with the given id, together with all other deployments
+// of the same build execution awaiting approval for the same environment. Approved deployments start right away.
+func (h *HTTPHandler) decideDeployment(ctx context.Context, user entity.User, id uint, approve bool) (entity.Deployment, error) {
+	logger := h.ContextLogger("decideDeployment")
+
+	if err := h.DBService.ExpireDeployments(time.Now()); err != nil {
+		return entity.Deployment{}, err
+	}
+	d, err := h.DBService.GetDeploymentById(id)
+	if err != nil {
+		return entity.Deployment{}, errDeploymentNotFound
+	}
+	switch d.Status {
+	case entity.StatusAwaitingApproval:
+	case entity.StatusExpired:
+		return d, errApprovalExpired
+	default:
+		return d, errNotAwaitingApproval
+	}
+
+	be, err := h.DBService.GetBuildExecutionById(int(d.BuildExecutionID))
+	if err != nil {
+		return d, fmt.Errorf("could not get build execution: %w", err)
+	}
+	bd, err := h.DBService.GetBuildDefinitionById(be.BuildDefinitionID)
+	if err != nil {
+		return d, fmt.Errorf("could not get build definition: %w", err)
+	}
+
+	build, bdc, err := h.deploymentContent(ctx, be, bd)
+	if err != nil {
+		return d, err
+	}
+	if err = h.loadApprovers(bd.ID, &bdc.Deployments); err != nil {
+		return d, err
+	}
+	env, found := bdc.Deployments.GetEnvironment(d.Environment)
+	if !found {
+		return d, errUnknownEnvironment
+	}
+	if !env.IsApprover(user) {
+		return d, errNotApprover
+	}
+	if approve {
+		if err = checkArtifact(build); err != nil {
+			return d, err
+		}
+	}
+
+	deployments, err := h.DBService.GetDeploymentsByBuildExecution(be.ID)
+	if err != nil {
+		return d, fmt.Errorf("could not get deployments: %w", err)
+	}
+	now := time.Now()
+	jobs := make([]job, 0)
+	for i := range deployments {
+		sibling := &deployments[i]
+		if sibling.Environment != d.Environment || sibling.Status != entity.StatusAwaitingApproval {
+			continue
+		}
+		sibling.DecidedBy = user.ID
+		sibling.DecidedAt = now
+
+		j, found := findDeploymentJob(bdc, *sibling)
+		switch {
+		case !approve:
+			sibling.Status = entity.StatusRejected
+			sibling.FinishedAt = now
+			sibling.Log = fmt.Sprintf("rejected by %s", user.DisplayName)
+		case !found || !j.enabled():
+			sibling.Status = entity.StatusFailed
+			sibling.FinishedAt = now
+			sibling.Log = "the target is no longer part of the build definition or has been disabled"
+		default:
+			sibling.Status = entity.StatusCreated
+		}
+		// another approver might have been faster
+		ok, err := h.DBService.TransitionDeployment(sibling, entity.StatusAwaitingApproval)
+		if err != nil {
+			return d, fmt.Errorf("could not update deployment: %w", err)
+		}
+		if !ok {
+			continue
+		}
+		if sibling.ID == d.ID {
+			d = *sibling
+		}
+		if sibling.Status == entity.StatusCreated {
+			j.deployment = sibling
+			jobs = append(jobs, j)
+		}
+	}
+
+	event := "deployment_rejected"
+	if approve {
+		event = "deployment_approved"
+	}
+	h.Logger.SetContext("audit").WithFields(logrus.Fields{
+		"event":            event,
+		"buildExecutionId": be.ID,
+		"deploymentId":     d.ID,
+		"environment":      d.Environment,
+		"userId":           user.ID,
+	}).Info("decided on deployment")
+
+	if len(jobs) > 0 {
+		logger.WithField("buildExecutionId", be.ID).Tracef("running %d approved deployments", len(jobs))
+		go h.redeploy(be, build, bdc, jobs, user.ID)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/builder"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/logging"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/security"
+)
+
+func TestRunDeploymentsAwaitApproval(t *testing.T) {
+	logger, _, _ := logging.NewLogger(logging.LevelDebug, "", "", logging.ModeDiscard)
+	recorder := &deploymentRecorder{}
+	h := &HTTPHandler{
+		Logger:        logger,
+		DBService:     recorder,
+		DeployService: fakeDeployer{},
+	}
+
+	bdc := &entity.BuildDefinitionContent{}
+	bdc.Deployments.Environments = []entity.Environment{
+		{Name: "staging"},
+		{Name: "production", Approvers: []string{"jane@example.org"}, ApprovalTimeout: time.Hour},
+	}
+	bdc.Deployments.LocalDeployments = []entity.LocalDeployment{
+		{Enabled: true, Path: "/staging", Environment: "staging"},
+		{Enabled: true, Path: "/production", Environment: "production"},
+		{Enabled: true, Path: "/qa", Environment: "qa"},
+	}
+	be := &entity.BuildExecution{BuildDefinitionID: 2}
+	be.ID = 7
+	build := builder.NewBuild(&entity.BuildDefinition{}, t.TempDir())
+
+	before := time.Now()
+	h.runDeployments(context.Background(), be, build, bdc, deploymentJobs(bdc), 0)
+
+	if len(recorder.deployments) != 3 {
+		t.Fatalf("expected 3 deployments, got %d", len(recorder.deployments))
+	}
+	for _, d := range recorder.deployments {
+		if d.BuildDefinitionID != 2 {
+			t.Errorf("expected the build definition to be recorded, got %d", d.BuildDefinitionID)
+		}
+		switch d.Target {
+		case "/staging":
+			if d.Status != entity.StatusSucceeded || d.Environment != "staging" {
+				t.Errorf("expected the ungated deployment to succeed, got %+v", d)
+			}
+		case "/production":
+			if !d.AwaitsApproval() || d.Finished() || !d.StartedAt.IsZero() {
+				t.Errorf("expected the gated deployment to await approval, got %+v", d)
+			}
+			if d.ExpiresAt.Before(before.Add(time.Hour)) || d.ExpiresAt.After(time.Now().Add(time.Hour)) {
+				t.Errorf("expected the approval to expire in an hour, got %s", d.ExpiresAt)
+			}
+		case "/qa":
+			if d.Status != entity.StatusFailed || !strings.Contains(d.Log, "'qa' is not defined") {
+				t.Errorf("expected the deployment to an unknown environment to fail, got %+v", d)
+			}
+		default:
+			t.Errorf("unexpected deployment %+v", d)
+		}
+	}
+	if !strings.Contains(build.GetReport(), "awaits approval for environment production") {
+		t.Errorf("expected the pending approval to be reported, got %q", build.GetReport())
+	}
+}
+
+func TestEnvironmentStatuses(t *testing.T) {
+	envs := []entity.Environment{
+		{Name: "staging"},
+		{Name: "production", Approvers: []string{"Jane"}, ApproverIDs: []uint{7}},
+	}
+	// newest first
+	deployments := []entity.Deployment{
+		{BuildExecutionID: 5, Environment: "production", Target: "/a", Status: entity.StatusAwaitingApproval},
+		{BuildExecutionID: 4, Environment: "production", Target: "/a", Status: entity.StatusFailed},
+		{BuildExecutionID: 3, Environment: "production", Target: "/a", Status: entity.StatusSucceeded},
+		{BuildExecutionID: 3, Environment: "production", Target: "/b", Status: entity.StatusSucceeded},
+		{BuildExecutionID: 2, Environment: "production", Target: "/a", Status: entity.StatusSucceeded},
+		{BuildExecutionID: 1, Environment: "", Target: "/c", Status: entity.StatusSucceeded},
+	}
+
+	jane := entity.User{DisplayName: "Jane"}
+	jane.ID = 7
+	statuses := environmentStatuses(envs, deployments, jane)
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 statuses, got %d", len(statuses))
+	}
+	if s := statuses[0]; len(s.Current) != 0 || len(s.Pending) != 0 || s.CanApprove {
+		t.Errorf("expected nothing to be deployed to staging, got %+v", s)
+	}
+	s := statuses[1]
+	if len(s.Current) != 2 || s.Current[0].BuildExecutionID != 3 || s.Current[1].Target != "/b" {
+		t.Errorf("expected the newest successful deployment per target, got %+v", s.Current)
+	}
+	if len(s.Pending) != 1 || s.Pending[0].BuildExecutionID != 5 {
+		t.Errorf("expected one pending deployment, got %+v", s.Pending)
+	}
+	if !s.CanApprove {
+		t.Error("expected Jane to be able to approve")
+	}
+
+	// approvers are users, not names
+	impostor := entity.User{DisplayName: "Jane", Email: "Jane"}
+	impostor.ID = 8
+	if environmentStatuses(envs, deployments, impostor)[1].CanApprove {
+		t.Error("expected a user named like an approver not to be able to approve")
+	}
+}
+
+func TestResolveApprovers(t *testing.T) {
+	jane := entity.User{Email: "jane@example.org"}
+	jane.ID = 7
+	h := &HTTPHandler{DBService: &approvalRecorder{user: jane}}
+
+	approvers, err := h.resolveApprovers(`
+deployments:
+  environments:
+    - name: staging
+    - name: production
+      approvers:
+        - jane@example.org
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(approvers) != 1 || approvers[0].Environment != "production" || approvers[0].UserID != 7 {
+		t.Errorf("expected Jane to be resolved, got %+v", approvers)
+	}
+
+	_, err = h.resolveApprovers(`
+deployments:
+  environments:
+    - name: production
+      approvers:
+        - ops@example.org
+`)
+	if err == nil || !strings.Contains(err.Error(), "approver 'ops@example.org' of environment 'production' is not a user") {
+		t.Errorf("expected an unknown approver to be refused, got %v", err)
+	}
+}
+
+// approvalRecorder knows a single user and a single deployment
+type approvalRecorder struct {
+	deploymentRecorder
+	user entity.User
+}
+
+func (a *approvalRecorder) GetUserByEmail(email string) (entity.User, error) {
+	if email != a.user.Email {
+		return entity.User{}, errDeploymentNotFound
+	}
+	return a.user, nil
+}
+
+func (a *approvalRecorder) GetDeploymentById(id uint) (entity.Deployment, error) {
+	d, ok := a.deployments[id]
+	if !ok {
+		return d, errDeploymentNotFound
+	}
+	return d, nil
+}
+
+func TestAPIDeploymentApproveHandler(t *testing.T) {
+	logger, _, _ := logging.NewLogger(logging.LevelDebug, "", "", logging.ModeDiscard)
+	hash, err := security.HashString("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &approvalRecorder{user: entity.User{Email: "jane@example.org", Password: hash}}
+	_ = recorder.AddDeployment(&entity.Deployment{Environment: "production", Status: entity.StatusSucceeded})
+	h := &HTTPHandler{Logger: logger, DBService: recorder}
+
+	tests := []struct {
+		name     string
+		id       string
+		email    string
+		password string
+		want     int
+	}{
+		{name: "missing credentials", id: "1", want: http.StatusUnauthorized},
+		{name: "wrong password", id: "1", email: "jane@example.org", password: "guess", want: http.StatusUnauthorized},
+		{name: "unknown deployment", id: "2", email: "jane@example.org", password: "secret", want: http.StatusNotFound},
+		{name: "finished deployment", id: "1", email: "jane@example.org", password: "secret", want: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/deployment/"+tt.id+"/approve", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			if tt.email != "" {
+				req.SetBasicAuth(tt.email, tt.password)
+			}
+			rr := httptest.NewRecorder()
+			h.APIDeploymentApproveHandler(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("expected status %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
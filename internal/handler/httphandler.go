@@ -7,6 +7,7 @@ import (
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/deploymentservice"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/logging"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/mailer"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/scheduler"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/sessionservice"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/templateservice"
 )
@@ -19,6 +20,7 @@ type HTTPHandler struct {
 	SessionService sessionservice.ISessionService
 	Logger         logging.ILogger
 	Mailer         mailer.IMailer
+	Scheduler      *scheduler.Scheduler
 }
 
 func (h *HTTPHandler) ContextLogger(context string) logging.ILogger {
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/templateservice"
+)
+
+// KnownHostListHandler lists the trusted host keys of SSH servers deployments connect to
+func (h *HTTPHandler) KnownHostListHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		currentUser = r.Context().Value("user").(entity.User)
+		logger      = h.ContextLogger("KnownHostListHandler")
+	)
+
+	hosts, err := h.DBService.GetAllKnownHosts()
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not get known hosts")
+		h.SessionService.AddMessage(w, "error", "Failed to fetch known hosts")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		CurrentUser entity.User
+		KnownHosts  []entity.KnownHost
+	}{
+		CurrentUser: currentUser,
+		KnownHosts:  hosts,
+	}
+
+	if err := templateservice.ExecuteTemplate(h.Injector(), w, "admin_knownhost_list.html", data); err != nil {
+		w.WriteHeader(404)
+	}
+}
+
+// KnownHostAddHandler adds a trusted host key. The key is accepted in the authorized_keys format,
+// e.g. the content of /etc/ssh/ssh_host_ed25519_key.pub, or as a line of the output of ssh-keyscan.
+func (h *HTTPHandler) KnownHostAddHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		currentUser = r.Context().Value("user").(entity.User)
+		logger      = h.ContextLogger("KnownHostAddHandler")
+		host        = strings.TrimSpace(r.FormValue("host"))
+		port        = strings.TrimSpace(r.FormValue("port"))
+	)
+
+	if port == "" {
+		port = "22"
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil || host == "" {
+		h.SessionService.AddMessage(w, "error", "Please enter a host and a valid port")
+		http.Redirect(w, r, "/admin/knownhost/list", http.StatusSeeOther)
+		return
+	}
+
+	key, err := parseHostKey(r.FormValue("key"))
+	if err != nil {
+		logger.WithField("error", err.Error()).Info("could not parse host key")
+		h.SessionService.AddMessage(w, "error", "The host key could not be parsed: "+err.Error())
+		http.Redirect(w, r, "/admin/knownhost/list", http.StatusSeeOther)
+		return
+	}
+
+	kh := entity.KnownHost{
+		Host:        knownhosts.Normalize(net.JoinHostPort(host, port)),
+		KeyType:     key.Type(),
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+		Fingerprint: ssh.FingerprintSHA256(key),
+		AddedBy:     currentUser.ID,
+	}
+	if err = h.DBService.AddKnownHost(&kh); err != nil {
+		logger.WithField("error", err.Error()).Error("could not add known host")
+		h.SessionService.AddMessage(w, "error", "The known host could not be added")
+		http.Redirect(w, r, "/admin/knownhost/list", http.StatusSeeOther)
+		return
+	}
+
+	h.Logger.SetContext("audit").WithFields(logrus.Fields{
+		"event":       "known_host_added",
+		"host":        kh.Host,
+		"fingerprint": kh.Fingerprint,
+		"userId":      currentUser.ID,
+	}).Info("added known host")
+
+	h.SessionService.AddMessage(w, "success", fmt.Sprintf("The %s key of %s has been added.", kh.KeyType, kh.Host))
+	http.Redirect(w, r, "/admin/knownhost/list", http.StatusSeeOther)
+}
+
+// KnownHostRemoveHandler removes a trusted host key, e.g. after the key of the host was changed on purpose
+func (h *HTTPHandler) KnownHostRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		currentUser = r.Context().Value("user").(entity.User)
+		logger      = h.ContextLogger("KnownHostRemoveHandler")
+	)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not parse known host id")
+		http.Error(w, "could not parse known host id", http.StatusBadRequest)
+		return
+	}
+	if err = h.DBService.DeleteKnownHost(uint(id)); err != nil {
+		logger.WithField("error", err.Error()).Error("could not remove known host")
+		h.SessionService.AddMessage(w, "error", "The known host could not be removed")
+		http.Redirect(w, r, "/admin/knownhost/list", http.StatusSeeOther)
+		return
+	}
+
+	h.Logger.SetContext("audit").WithFields(logrus.Fields{
+		"event":  "known_host_removed",
+		"id":     id,
+		"userId": currentUser.ID,
+	}).Info("removed known host")
+
+	h.SessionService.AddMessage(w, "success", "The known host has been removed.")
+	http.Redirect(w, r, "/admin/knownhost/list", http.StatusSeeOther)
+}
+
+// parseHostKey parses a public key in the authorized_keys format or a line of a known_hosts file
+func parseHostKey(in string) (ssh.PublicKey, error) {
+	in = strings.TrimSpace(in)
+	if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(in)); err == nil {
+		return key, nil
+	}
+	_, _, key, _, _, err := ssh.ParseKnownHosts([]byte(in))
+	return key, err
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"testing"
+)
+
+func TestParseHostKey(t *testing.T) {
+	const key = "AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{"authorized key", "ssh-ed25519 " + key + " root@host", false},
+		{"known hosts line", "deploy.example.com ssh-ed25519 " + key, false},
+		{"with whitespace", "\n  ssh-ed25519 " + key + "\n", false},
+		{"invalid", "not a key", true},
+		{"empty", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := parseHostKey(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && k.Type() != "ssh-ed25519" {
+				t.Errorf("expected an ssh-ed25519 key, got %s", k.Type())
+			}
+		})
+	}
+}
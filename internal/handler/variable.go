@@ -8,10 +8,16 @@ import (
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/common"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/templateservice"
 )
 
+type variableListEntry struct {
+	entity.UserVariable
+	Editable bool
+}
+
 // VariableListHandler lists all variables available to the logged-in user
 func (h *HTTPHandler) VariableListHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
@@ -20,16 +26,56 @@ func (h *HTTPHandler) VariableListHandler(w http.ResponseWriter, r *http.Request
 		logger      = h.ContextLogger("VariableListHandler")
 	)
 
-	variables, err := h.DBService.GetAvailableVariablesForUser(currentUser.ID)
+	global, err := h.DBService.GetGlobalVariables()
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not get global variables")
+		http.Error(w, "could not get global variables", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.DBService.GetAvailableVariablesForUser(currentUser.ID)
 	if err != nil {
 		logger.WithField("error", err.Error()).Error("could not get variables for user")
 		http.Error(w, "could not get variables for user", http.StatusInternalServerError)
 		return
 	}
 
+	var definition []entity.UserVariable
+	if currentUser.Admin {
+		definition, err = h.DBService.FindVariables("scope = ?", entity.VariableScopeDefinition)
+	} else {
+		// the variables of a build definition belong to the owner of the build definition
+		var buildDefinitions []entity.BuildDefinition
+		buildDefinitions, err = h.DBService.GetAllBuildDefinitions()
+		if err == nil {
+			ownIDs := make([]uint, 0, len(buildDefinitions))
+			for _, bd := range buildDefinitions {
+				if bd.CreatedBy == currentUser.ID {
+					ownIDs = append(ownIDs, bd.ID)
+				}
+			}
+			definition, err = h.DBService.FindVariables("scope = ? AND build_definition_id IN ?", entity.VariableScopeDefinition, ownIDs)
+		}
+	}
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not get build definition variables")
+		http.Error(w, "could not get build definition variables", http.StatusInternalServerError)
+		return
+	}
+
+	variables := make([]variableListEntry, 0, len(global)+len(user)+len(definition))
+	for _, set := range [][]entity.UserVariable{global, user, definition} {
+		for _, v := range set {
+			variables = append(variables, variableListEntry{
+				UserVariable: v,
+				Editable:     h.canManageVariable(currentUser, v),
+			})
+		}
+	}
+
 	data := struct {
 		CurrentUser entity.User
-		Variables   []entity.UserVariable
+		Variables   []variableListEntry
 	}{
 		CurrentUser: currentUser,
 		Variables:   variables,
@@ -51,31 +97,70 @@ func (h *HTTPHandler) VariableAddHandler(w http.ResponseWriter, r *http.Request)
 	if r.Method == http.MethodPost {
 		varName := r.FormValue("var_name")
 		varVal := r.FormValue("var_value")
-		var varPublic bool
+		var varPublic, varSecret bool
 		if r.FormValue("var_public") == "1" {
 			varPublic = true
 		}
+		if r.FormValue("var_secret") == "1" {
+			varSecret = true
+		}
 		if varName == "" || varVal == "" {
 			h.SessionService.AddMessage(w, "warning", "Please enter both a variable name and a value.")
 			http.Redirect(w, r, "/variable/add", http.StatusSeeOther)
 			return
 		}
 
-		_, err := h.DBService.FindVariable("user_entry_id = ? AND variable = ?", currentUser.ID, varName)
-		if err == nil {
-			h.SessionService.AddMessage(w, "error", "This variable already exists!")
-			http.Redirect(w, r, "/variable/add", http.StatusSeeOther)
-			return
-		}
-
 		uv := entity.UserVariable{
 			UserEntryID: currentUser.ID,
 			Variable:    varName,
 			Value:       varVal,
-			Public:      varPublic,
+			Secret:      varSecret,
+			Scope:       entity.VariableScope(r.FormValue("var_scope")),
+		}
+
+		switch uv.Scope {
+		case entity.VariableScopeGlobal:
+			if !currentUser.Admin {
+				logger.WithField("userId", currentUser.ID).Error("only administrators can add global variables")
+				h.SessionService.AddMessage(w, "error", "Only administrators can add global variables!")
+				http.Redirect(w, r, "/variable/add", http.StatusSeeOther)
+				return
+			}
+		case entity.VariableScopeDefinition:
+			bdId, err := strconv.Atoi(r.FormValue("var_definition"))
+			if err != nil {
+				h.SessionService.AddMessage(w, "warning", "Please select a build definition.")
+				http.Redirect(w, r, "/variable/add", http.StatusSeeOther)
+				return
+			}
+			bd, err := h.DBService.GetBuildDefinitionById(uint(bdId))
+			if err != nil || bd.Deleted {
+				h.SessionService.AddMessage(w, "error", "The build definition could not be found!")
+				http.Redirect(w, r, "/variable/add", http.StatusSeeOther)
+				return
+			}
+			if bd.CreatedBy != currentUser.ID && !currentUser.Admin {
+				logger.WithFields(logrus.Fields{
+					"userId":            currentUser.ID,
+					"buildDefinitionId": bd.ID,
+				}).Error("user tried to add a variable to a build definition of another user")
+				h.SessionService.AddMessage(w, "error", "You can only add variables to your own build definitions!")
+				http.Redirect(w, r, "/variable/add", http.StatusSeeOther)
+				return
+			}
+			uv.BuildDefinitionID = bd.ID
+		default:
+			uv.Scope = entity.VariableScopeUser
+			uv.Public = varPublic
 		}
 
-		if _, err = h.DBService.AddVariable(uv); err != nil {
+		if h.variableExists(uv) {
+			h.SessionService.AddMessage(w, "error", "This variable already exists!")
+			http.Redirect(w, r, "/variable/add", http.StatusSeeOther)
+			return
+		}
+
+		if _, err := h.DBService.AddVariable(uv); err != nil {
 			logger.WithField("error", err.Error()).Error("could not insert new user variable")
 			h.SessionService.AddMessage(w, "error", "The variable could not be added!")
 			http.Redirect(w, r, "/variable/add", http.StatusSeeOther)
@@ -86,10 +171,28 @@ func (h *HTTPHandler) VariableAddHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	buildDefinitions, err := h.DBService.GetAllBuildDefinitions()
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not get build definitions")
+		http.Error(w, "could not get build definitions", http.StatusInternalServerError)
+		return
+	}
+	// variables can only be added to build definitions the user manages
+	ownDefinitions := make([]entity.BuildDefinition, 0, len(buildDefinitions))
+	for _, bd := range buildDefinitions {
+		if bd.CreatedBy == currentUser.ID || currentUser.Admin {
+			ownDefinitions = append(ownDefinitions, bd)
+		}
+	}
+
 	data := struct {
-		CurrentUser entity.User
+		CurrentUser      entity.User
+		BuildDefinitions []entity.BuildDefinition
+		Selected         string
 	}{
-		CurrentUser: currentUser,
+		CurrentUser:      currentUser,
+		BuildDefinitions: ownDefinitions,
+		Selected:         r.URL.Query().Get("definition"),
 	}
 
 	if err := templateservice.ExecuteTemplate(h.Injector(), w, "variable_add.html", data); err != nil {
@@ -120,7 +223,7 @@ func (h *HTTPHandler) VariableEditHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if variable.UserEntryID != currentUser.ID {
+	if !h.canManageVariable(currentUser, variable) {
 		logger.Error("this is not your variable!")
 		http.Error(w, "this is not your variable!", http.StatusForbidden)
 		return
@@ -130,27 +233,37 @@ func (h *HTTPHandler) VariableEditHandler(w http.ResponseWriter, r *http.Request
 		varName := r.FormValue("var_name")
 		varVal := r.FormValue("var_value")
 		varPublic := r.FormValue("var_public") == "1"
+		varSecret := r.FormValue("var_secret") == "1"
 		if varName == "" {
 			logger.WithField("id", id).Error("variable name cannot be empty")
 			http.Error(w, "variable name cannot be empty", http.StatusBadRequest)
 			return
 		}
 
-		_, err := h.DBService.FindVariable("user_entry_id = ? && variable = ? && id != ?", currentUser.ID, varName, variable.ID)
-		if err == nil {
+		// secret values are never sent to the browser, so an empty value keeps the current one
+		if varVal == "" && variable.Secret {
+			varVal = variable.Value
+		}
+
+		// the scope and the owner of a variable cannot be changed
+		updated := entity.UserVariable{
+			Model:             gorm.Model{ID: uint(id)},
+			UserEntryID:       variable.UserEntryID,
+			Variable:          varName,
+			Value:             varVal,
+			Public:            varPublic && variable.GetScope() == entity.VariableScopeUser,
+			Secret:            varSecret || variable.Secret,
+			Scope:             variable.GetScope(),
+			BuildDefinitionID: variable.BuildDefinitionID,
+		}
+
+		if h.variableExists(updated) {
 			logger.WithField("varName", varName).Error("this variable name is already taken")
 			http.Error(w, "this variable name is already taken", http.StatusInternalServerError)
 			return
 		}
 
-		err = h.DBService.UpdateVariable(entity.UserVariable{
-			Model:       gorm.Model{ID: uint(id)},
-			UserEntryID: currentUser.ID,
-			Variable:    varName,
-			Value:       varVal,
-			Public:      varPublic,
-		})
-		if err != nil {
+		if err = h.DBService.UpdateVariable(updated); err != nil {
 			logger.WithField("error", err.Error()).Error("could not update the variable")
 			http.Error(w, "could not update the variable", http.StatusInternalServerError)
 			return
@@ -160,6 +273,10 @@ func (h *HTTPHandler) VariableEditHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if variable.Secret {
+		variable.Value = ""
+	}
+
 	data := struct {
 		CurrentUser entity.User
 		Variable    entity.UserVariable
@@ -182,13 +299,23 @@ func (h *HTTPHandler) VariableRemoveHandler(w http.ResponseWriter, r *http.Reque
 		vars        = mux.Vars(r)
 	)
 
-	v, err := h.DBService.FindVariable("user_entry_id = ? AND id = ?", currentUser.ID, vars["id"])
+	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		logger.WithFields(logrus.Fields{
-			"error":      err.Error(),
+		logger.WithField("error", err.Error()).Error("could not get variable id")
+		http.Error(w, "could not get variable id", http.StatusBadRequest)
+		return
+	}
+
+	v, err := h.DBService.GetVariable(id)
+	if err != nil || !h.canManageVariable(currentUser, v) {
+		fields := logrus.Fields{
 			"variableId": vars["id"],
 			"userId":     currentUser.ID,
-		}).Error("could not find variable")
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		}
+		logger.WithFields(fields).Error("could not find variable")
 		h.SessionService.AddMessage(w, "error", "The variable could not be found or it is not yours!")
 		http.Redirect(w, r, "/variable/list", http.StatusSeeOther)
 		return
@@ -206,3 +333,53 @@ func (h *HTTPHandler) VariableRemoveHandler(w http.ResponseWriter, r *http.Reque
 
 	http.Redirect(w, r, "/variable/list", http.StatusSeeOther)
 }
+
+// resolveVariables determines the variables available to a build definition. Variables are always
+// resolved for the owner of the build definition, no matter who or what triggered the build.
+func (h *HTTPHandler) resolveVariables(bd *entity.BuildDefinition) ([]entity.UserVariable, error) {
+	global, err := h.DBService.GetGlobalVariables()
+	if err != nil {
+		return nil, err
+	}
+	user, err := h.DBService.GetAvailableVariablesForUser(bd.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	definition, err := h.DBService.GetVariablesForBuildDefinition(bd.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return common.ResolveVariables(bd.CreatedBy, global, user, definition), nil
+}
+
+// variableExists checks whether a different variable with the same name exists in the same scope
+func (h *HTTPHandler) variableExists(uv entity.UserVariable) bool {
+	var err error
+	switch uv.GetScope() {
+	case entity.VariableScopeGlobal:
+		_, err = h.DBService.FindVariable("scope = ? AND variable = ? AND id != ?", uv.GetScope(), uv.Variable, uv.ID)
+	case entity.VariableScopeDefinition:
+		_, err = h.DBService.FindVariable("scope = ? AND build_definition_id = ? AND variable = ? AND id != ?", uv.GetScope(), uv.BuildDefinitionID, uv.Variable, uv.ID)
+	default:
+		_, err = h.DBService.FindVariable("scope = ? AND user_entry_id = ? AND variable = ? AND id != ?", uv.GetScope(), uv.UserEntryID, uv.Variable, uv.ID)
+	}
+	return err == nil
+}
+
+// canManageVariable checks whether the given user is allowed to edit or remove a variable. Variables
+// of a build definition are managed by the owner of the build definition, not by their creator.
+func (h *HTTPHandler) canManageVariable(u entity.User, uv entity.UserVariable) bool {
+	switch uv.GetScope() {
+	case entity.VariableScopeGlobal:
+		return u.Admin
+	case entity.VariableScopeDefinition:
+		if u.Admin {
+			return true
+		}
+		bd, err := h.DBService.GetBuildDefinitionById(uv.BuildDefinitionID)
+		return err == nil && bd.CreatedBy == u.ID
+	default:
+		return uv.UserEntryID == u.ID
+	}
+}
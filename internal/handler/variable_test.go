@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/dbservice"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// definitionOwners returns build definitions with the given owners by ID
+type definitionOwners struct {
+	dbservice.DBServiceMock
+	owners map[uint]uint
+}
+
+func (d *definitionOwners) GetBuildDefinitionById(id uint) (entity.BuildDefinition, error) {
+	bd := entity.BuildDefinition{CreatedBy: d.owners[id]}
+	bd.ID = id
+	return bd, nil
+}
+
+func TestCanManageVariable(t *testing.T) {
+	h := &HTTPHandler{DBService: &definitionOwners{owners: map[uint]uint{1: 10, 2: 20}}}
+	owner := entity.User{}
+	owner.ID = 10
+	other := entity.User{}
+	other.ID = 20
+	admin := entity.User{Admin: true}
+	admin.ID = 30
+
+	tests := []struct {
+		name     string
+		user     entity.User
+		variable entity.UserVariable
+		want     bool
+	}{
+		{"global by admin", admin, entity.UserVariable{Scope: entity.VariableScopeGlobal}, true},
+		{"global by user", owner, entity.UserVariable{Scope: entity.VariableScopeGlobal, UserEntryID: 10}, false},
+		{"definition by owner", owner, entity.UserVariable{Scope: entity.VariableScopeDefinition, BuildDefinitionID: 1, UserEntryID: 30}, true},
+		{"definition by creator", other, entity.UserVariable{Scope: entity.VariableScopeDefinition, BuildDefinitionID: 1, UserEntryID: 20}, false},
+		{"definition by admin", admin, entity.UserVariable{Scope: entity.VariableScopeDefinition, BuildDefinitionID: 2}, true},
+		{"user by creator", other, entity.UserVariable{Scope: entity.VariableScopeUser, UserEntryID: 20}, true},
+		{"user by other", owner, entity.UserVariable{Scope: entity.VariableScopeUser, UserEntryID: 20}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.canManageVariable(tt.user, tt.variable); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/logging"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/templateservice"
+)
+
+// WebhookDeliveryListHandler lists the most recent webhook deliveries of a build definition, given
+// by the definition query parameter. Admins may omit it to list the deliveries of all build definitions.
+func (h *HTTPHandler) WebhookDeliveryListHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		currentUser     = r.Context().Value("user").(entity.User)
+		logger          = h.ContextLogger("WebhookDeliveryListHandler")
+		buildDefinition entity.BuildDefinition
+		limit           = 100
+	)
+
+	if def := r.URL.Query().Get("definition"); def != "" {
+		id, err := strconv.Atoi(def)
+		if err != nil {
+			logger.WithField("error", err.Error()).Error("could not parse build definition id")
+			http.Error(w, "could not parse build definition id", http.StatusBadRequest)
+			return
+		}
+		buildDefinition, err = h.DBService.GetBuildDefinitionById(uint(id))
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+				"id":    id,
+			}).Error("could not get build definition by ID")
+			http.Error(w, "could not get build definition by ID", http.StatusNotFound)
+			return
+		}
+		if buildDefinition.CreatedBy != currentUser.ID && !currentUser.Admin {
+			logger.WithField("id", buildDefinition.ID).Info("user is not allowed to view webhook deliveries")
+			h.SessionService.AddMessage(w, "error", "You are not allowed to view the webhook deliveries of this build definition")
+			http.Redirect(w, r, fmt.Sprintf("/builddefinition/%d/show", buildDefinition.ID), http.StatusSeeOther)
+			return
+		}
+	} else if !currentUser.Admin {
+		h.SessionService.AddMessage(w, "error", "You are not allowed to view the webhook deliveries of all build definitions")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	deliveries, err := h.DBService.GetNewestWebhookDeliveries(limit, buildDefinition.ID)
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not get webhook deliveries")
+		h.SessionService.AddMessage(w, "error", "Failed to fetch webhook deliveries")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		CurrentUser     entity.User
+		BuildDefinition entity.BuildDefinition
+		Deliveries      []entity.WebhookDelivery
+		Limit           int
+	}{
+		CurrentUser:     currentUser,
+		BuildDefinition: buildDefinition,
+		Deliveries:      deliveries,
+		Limit:           limit,
+	}
+
+	if err := templateservice.ExecuteTemplate(h.Injector(), w, "webhookdelivery_list.html", data); err != nil {
+		w.WriteHeader(404)
+	}
+}
+
+// WebhookDeliveryShowHandler shows the headers, body and outcome of a specific webhook delivery
+func (h *HTTPHandler) WebhookDeliveryShowHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		currentUser = r.Context().Value("user").(entity.User)
+		logger      = h.ContextLogger("WebhookDeliveryShowHandler")
+	)
+
+	delivery, bd, ok := h.findManageableDelivery(w, r, logger)
+	if !ok {
+		return
+	}
+
+	// the header carrying the secret of the generic hoster is configurable
+	var content entity.BuildDefinitionContent
+	_ = yaml.Unmarshal([]byte(bd.Raw), &content)
+	var secretHeader string
+	if content.Repository.Hoster == "generic" {
+		secretHeader = content.Repository.Generic.GetSecretHeader()
+	}
+
+	data := struct {
+		CurrentUser     entity.User
+		Delivery        entity.WebhookDelivery
+		Headers         []string
+		BuildDefinition entity.BuildDefinition
+	}{
+		CurrentUser:     currentUser,
+		Delivery:        delivery,
+		Headers:         delivery.DisplayHeaders(secretHeader),
+		BuildDefinition: bd,
+	}
+
+	if err := templateservice.ExecuteTemplate(h.Injector(), w, "webhookdelivery_show.html", data); err != nil {
+		w.WriteHeader(404)
+	}
+}
+
+// WebhookDeliveryReplayHandler processes a recorded webhook delivery again, exactly as if the
+// git hoster had sent it once more. The replay is recorded as a delivery of its own.
+func (h *HTTPHandler) WebhookDeliveryReplayHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var (
+		currentUser = r.Context().Value("user").(entity.User)
+		logger      = h.ContextLogger("WebhookDeliveryReplayHandler")
+	)
+
+	original, bd, ok := h.findManageableDelivery(w, r, logger)
+	if !ok {
+		return
+	}
+	if bd.ID == 0 {
+		h.SessionService.AddMessage(w, "error", "Deliveries without a build definition cannot be replayed")
+		http.Redirect(w, r, fmt.Sprintf("/webhookdelivery/%d/show", original.ID), http.StatusSeeOther)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, "/api/v1/receive", bytes.NewReader([]byte(original.Body)))
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not create replay request")
+		http.Error(w, "could not create replay request", http.StatusInternalServerError)
+		return
+	}
+	req.Header = original.GetHeaders()
+	req.RemoteAddr = original.RemoteAddr
+
+	replay := entity.WebhookDelivery{
+		ReplayOf:   original.ID,
+		ReplayedBy: currentUser.ID,
+		RemoteAddr: original.RemoteAddr,
+		Headers:    original.Headers,
+		Body:       original.Body,
+		// the credentials were masked when recording the original, which has been verified already
+		Verified: original.Verified,
+	}
+	h.processDelivery(&bd, &replay, req, []byte(original.Body))
+	h.saveDelivery(&replay)
+
+	logger.WithFields(logrus.Fields{
+		"id":      original.ID,
+		"replay":  replay.ID,
+		"verdict": replay.Verdict,
+	}).Info("replayed webhook delivery")
+
+	msgType := "success"
+	if replay.Verdict == entity.DeliveryRejected {
+		msgType = "error"
+	}
+	h.SessionService.AddMessage(w, msgType, fmt.Sprintf("Replay %s: %s", replay.Verdict, replay.Reason))
+	http.Redirect(w, r, fmt.Sprintf("/webhookdelivery/%d/show", replay.ID), http.StatusSeeOther)
+}
+
+// findManageableDelivery fetches the webhook delivery identified by the route and its build definition.
+// Only the creator of the build definition and admins are allowed to access deliveries. Otherwise, or
+// if the delivery cannot be found, a response is written and false is returned.
+func (h *HTTPHandler) findManageableDelivery(w http.ResponseWriter, r *http.Request, logger logging.ILogger) (entity.WebhookDelivery, entity.BuildDefinition, bool) {
+	currentUser := r.Context().Value("user").(entity.User)
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not parse webhook delivery id")
+		http.Error(w, "could not parse webhook delivery id", http.StatusBadRequest)
+		return entity.WebhookDelivery{}, entity.BuildDefinition{}, false
+	}
+	delivery, err := h.DBService.GetWebhookDeliveryById(uint(id))
+	if err != nil {
+		logger.WithField("error", err.Error()).Error("could not get webhook delivery by ID")
+		http.Error(w, "could not get webhook delivery by ID", http.StatusNotFound)
+		return entity.WebhookDelivery{}, entity.BuildDefinition{}, false
+	}
+
+	// deliveries with an unknown token do not belong to any build definition
+	var bd entity.BuildDefinition
+	if delivery.BuildDefinitionID > 0 {
+		bd, err = h.DBService.GetBuildDefinitionById(delivery.BuildDefinitionID)
+		if err != nil {
+			logger.WithField("error", err.Error()).Error("could not get build definition by ID")
+			http.Error(w, "could not get build definition by ID", http.StatusNotFound)
+			return entity.WebhookDelivery{}, entity.BuildDefinition{}, false
+		}
+	}
+
+	if !currentUser.Admin && (bd.ID == 0 || bd.CreatedBy != currentUser.ID) {
+		logger.WithField("id", delivery.ID).Info("user is not allowed to access webhook delivery")
+		h.SessionService.AddMessage(w, "error", "You are not allowed to access this webhook delivery")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return entity.WebhookDelivery{}, entity.BuildDefinition{}, false
+	}
+
+	return delivery, bd, true
+}
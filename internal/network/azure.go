@@ -0,0 +1,107 @@
+package network
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+type azureDevOps struct{}
+
+func (azureDevOps) Name() string {
+	return "azure_devops"
+}
+
+func (azureDevOps) ParseEvent(r *http.Request, body []byte) (*entity.WebhookEvent, error) {
+	var payload entity.AzurePushPayload
+	if err := decodePayload(body, &payload); err != nil {
+		return nil, err
+	}
+
+	// the event type is only part of the payload
+	if payload.EventType == "git.pullrequest.created" || payload.EventType == "git.pullrequest.updated" {
+		return parseAzurePullRequest(payload.EventType, body)
+	}
+	if payload.EventType != "git.push" {
+		return &entity.WebhookEvent{Kind: entity.EventKindOther, Type: payload.EventType}, nil
+	}
+	if len(payload.Resource.RefUpdates) == 0 {
+		return nil, fmt.Errorf("payload does not contain a ref update")
+	}
+
+	// the name is supplied  in the form of "refs/heads/<branch>" or "refs/tags/<tag>"
+	update := payload.Resource.RefUpdates[0]
+	event, err := newRefEvent(payload.EventType, update.Name)
+	if err != nil {
+		return nil, err
+	}
+	event.Before = update.OldObjectID
+	event.After = update.NewObjectID
+	event.Pusher = payload.Resource.PushedBy.UniqueName
+	event.Repository = payload.Resource.Repository.Name
+	for _, c := range payload.Resource.Commits {
+		event.Commits = append(event.Commits, entity.WebhookCommit{
+			SHA:     c.CommitID,
+			Message: c.Comment,
+			Author:  c.Author.Name,
+			URL:     c.URL,
+		})
+	}
+
+	return event, nil
+}
+
+// VerifySignature checks the password of the basic authentication used by service hooks;
+// the user name can be chosen freely
+func (azureDevOps) VerifySignature(r *http.Request, _ []byte, secret string) error {
+	_, password, ok := r.BasicAuth()
+	if !ok || !constantTimeEquals(password, secret) {
+		return fmt.Errorf("azure devops: %w: basic authentication failed", ErrInvalidSignature)
+	}
+	return nil
+}
+
+func parseAzurePullRequest(eventType string, body []byte) (*entity.WebhookEvent, error) {
+	var payload entity.AzurePullRequestPayload
+	if err := decodePayload(body, &payload); err != nil {
+		return nil, err
+	}
+
+	res := payload.Resource
+	src, err := parseRef(res.SourceRefName)
+	if err != nil {
+		return nil, err
+	}
+	target, err := parseRef(res.TargetRefName)
+	if err != nil {
+		return nil, err
+	}
+	pr := &entity.WebhookPullRequest{
+		Number:       res.PullRequestID,
+		Title:        res.Title,
+		URL:          fmt.Sprintf("%s/pullrequest/%d", res.Repository.WebURL, res.PullRequestID),
+		SourceBranch: src.Branch,
+		TargetBranch: target.Branch,
+		MergeRef:     fmt.Sprintf("refs/pull/%d/merge", res.PullRequestID),
+		HeadSHA:      res.LastMergeSourceCommit.CommitID,
+		FromFork:     res.ForkSource != nil,
+	}
+	// the source branch of a fork does not exist in the repository
+	if !pr.FromFork {
+		pr.HeadRef = res.SourceRefName
+	}
+	switch {
+	case res.Status != "active":
+		pr.Action = entity.PullRequestClosed
+	case eventType == "git.pullrequest.created":
+		pr.Action = entity.PullRequestOpened
+	default:
+		pr.Action = entity.PullRequestUpdated
+	}
+
+	event := newPullRequestEvent(eventType, pr)
+	event.Pusher = res.CreatedBy.UniqueName
+	event.Repository = res.Repository.Name
+	return event, nil
+}
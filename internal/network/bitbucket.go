@@ -0,0 +1,114 @@
+package network
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+type bitbucket struct{}
+
+func (bitbucket) Name() string {
+	return "bitbucket"
+}
+
+func (bitbucket) ParseEvent(r *http.Request, body []byte) (*entity.WebhookEvent, error) {
+	eventType, err := requireHeader(r, "X-Event-Key")
+	if err != nil {
+		return nil, err
+	}
+
+	switch eventType {
+	case "diagnostics:ping":
+		return &entity.WebhookEvent{Kind: entity.EventKindPing, Type: eventType}, nil
+	case "pullrequest:created", "pullrequest:updated", "pullrequest:fulfilled", "pullrequest:rejected":
+		return parseBitbucketPullRequest(eventType, body)
+	case "repo:push":
+	default:
+		return &entity.WebhookEvent{Kind: entity.EventKindOther, Type: eventType}, nil
+	}
+
+	var payload entity.BitBucketPushPayload
+	if err = decodePayload(body, &payload); err != nil {
+		return nil, err
+	}
+	if len(payload.Push.Changes) == 0 {
+		return nil, fmt.Errorf("payload does not contain any changes")
+	}
+
+	// a push can contain changes of several refs, only the first one is built
+	change := payload.Push.Changes[0]
+	name, refType := change.New.Name, change.New.Type
+	if name == "" {
+		// the ref was deleted, so only the old one is available
+		name, refType = change.Old.Name, change.Old.Type
+	}
+	ref := "refs/heads/" + name
+	if refType == "tag" {
+		ref = "refs/tags/" + name
+	}
+
+	event, err := newRefEvent(eventType, ref)
+	if err != nil {
+		return nil, err
+	}
+	event.Before = change.Old.Target.Hash
+	event.After = change.New.Target.Hash
+	event.Pusher = payload.Actor.Nickname
+	event.Repository = payload.Repository.FullName
+	for _, c := range change.Commits {
+		event.Commits = append(event.Commits, entity.WebhookCommit{
+			SHA:     c.Hash,
+			Message: c.Message,
+			Author:  c.Author.Raw,
+			URL:     c.Links.HTML.Href,
+		})
+	}
+
+	return event, nil
+}
+
+// VerifySignature checks the HMAC-SHA256 signature sent as "sha256=<hex>" in the X-Hub-Signature header
+func (bitbucket) VerifySignature(r *http.Request, body []byte, secret string) error {
+	if err := verifyHMAC(r.Header.Get("X-Hub-Signature"), "sha256=", secret, body); err != nil {
+		return fmt.Errorf("bitbucket: %w", err)
+	}
+	return nil
+}
+
+func parseBitbucketPullRequest(eventType string, body []byte) (*entity.WebhookEvent, error) {
+	var payload entity.BitBucketPullRequestPayload
+	if err := decodePayload(body, &payload); err != nil {
+		return nil, err
+	}
+
+	// Bitbucket provides no refs for pull requests, so the source branch is built, which is
+	// only possible if it belongs to the same repository
+	src := payload.PullRequest.Source
+	pr := &entity.WebhookPullRequest{
+		Number:       payload.PullRequest.ID,
+		Title:        payload.PullRequest.Title,
+		URL:          payload.PullRequest.Links.HTML.Href,
+		SourceBranch: src.Branch.Name,
+		TargetBranch: payload.PullRequest.Destination.Branch.Name,
+		HeadSHA:      src.Commit.Hash,
+		FromFork:     src.Repository.FullName != payload.Repository.FullName,
+	}
+	if !pr.FromFork {
+		pr.HeadRef = "refs/heads/" + src.Branch.Name
+	}
+	switch eventType {
+	case "pullrequest:created":
+		pr.Action = entity.PullRequestOpened
+	case "pullrequest:updated":
+		pr.Action = entity.PullRequestUpdated
+	default:
+		pr.Action = entity.PullRequestClosed
+	}
+
+	event := newPullRequestEvent(eventType, pr)
+	event.Pusher = payload.Actor.Nickname
+	event.Repository = payload.Repository.FullName
+	return event, nil
+}
@@ -0,0 +1,37 @@
+package network
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// commitPaths maps the hosters to the path of a commit's web page, relative to the repository
+var commitPaths = map[string]string{
+	"github":       "/commit/",
+	"gitlab":       "/-/commit/",
+	"gitea":        "/commit/",
+	"bitbucket":    "/commits/",
+	"azure_devops": "/commit/",
+}
+
+// CommitURL returns the link to the web page of the commit at the hoster of the repository.
+// For hosters without known commit pages, e.g. generic ones, the link is empty.
+func CommitURL(repo entity.Repository, sha string) string {
+	path, ok := commitPaths[repo.Hoster]
+	if !ok || sha == "" {
+		return ""
+	}
+	u, err := url.Parse(repo.Url)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	// credentials must never end up in a link
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git") + path + url.PathEscape(sha)
+	u.RawPath = ""
+	return u.String()
+}
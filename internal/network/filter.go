@@ -0,0 +1,72 @@
+package network
+
+import (
+	"strings"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/common"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// payloadCommitLimit is the maximum number of commits GitHub and GitLab include in a push payload.
+// Pushes with more commits might be missing changed files.
+const payloadCommitLimit = 20
+
+// skipDirectives are the commit message directives which prevent a build
+var skipDirectives = []string{"[skip ci]", "[ci skip]", "[no ci]"}
+
+// SkipDirective returns the directive found in the message of the pushed head commit, if any
+func SkipDirective(event *entity.WebhookEvent) (string, bool) {
+	head, ok := event.HeadCommit()
+	if !ok {
+		return "", false
+	}
+
+	msg := strings.ToLower(head.Message)
+	for _, d := range skipDirectives {
+		if strings.Contains(msg, d) {
+			return d, true
+		}
+	}
+	return "", false
+}
+
+// PayloadChangedFiles returns the files changed by the pushed commits, as listed in the payload.
+// The second return value is false if the payload does not list the changed files, or not all of them.
+func PayloadChangedFiles(event *entity.WebhookEvent) ([]string, bool) {
+	if len(event.Commits) == 0 || len(event.Commits) >= payloadCommitLimit {
+		return nil, false
+	}
+
+	seen := make(map[string]struct{})
+	files := make([]string, 0)
+	for _, c := range event.Commits {
+		for _, list := range [][]string{c.Added, c.Modified, c.Removed} {
+			for _, f := range list {
+				if _, ok := seen[f]; !ok {
+					seen[f] = struct{}{}
+					files = append(files, f)
+				}
+			}
+		}
+	}
+	// hosters like Bitbucket and Azure DevOps do not list any files at all
+	if len(files) == 0 {
+		return nil, false
+	}
+	return files, true
+}
+
+// MatchPaths returns the first changed file matching the path filter, i.e. one of the include
+// patterns, if any, and none of the exclude patterns
+func MatchPaths(filter entity.PathFilter, files []string) (string, bool) {
+	for _, f := range files {
+		if len(filter.Include) > 0 && !common.MatchAnyPattern(filter.Include, f) {
+			continue
+		}
+		if common.MatchAnyPattern(filter.Exclude, f) {
+			continue
+		}
+		return f, true
+	}
+	return "", false
+}
@@ -0,0 +1,90 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+func TestSkipDirective(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   entity.WebhookEvent
+		want    string
+		wantHit bool
+	}{
+		{
+			name:    "skip ci",
+			event:   entity.WebhookEvent{After: "b", Commits: []entity.WebhookCommit{{SHA: "a", Message: "feature"}, {SHA: "b", Message: "Update docs [skip ci]"}}},
+			want:    "[skip ci]",
+			wantHit: true,
+		},
+		{
+			name:    "ci skip, case insensitive",
+			event:   entity.WebhookEvent{After: "a", Commits: []entity.WebhookCommit{{SHA: "a", Message: "typo\n\n[CI SKIP]"}}},
+			want:    "[ci skip]",
+			wantHit: true,
+		},
+		{
+			name:  "only an earlier commit",
+			event: entity.WebhookEvent{After: "b", Commits: []entity.WebhookCommit{{SHA: "a", Message: "[skip ci]"}, {SHA: "b", Message: "feature"}}},
+		},
+		{
+			name: "no commits",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := SkipDirective(&tt.event)
+			if ok != tt.wantHit || got != tt.want {
+				t.Errorf("expected (%q, %v), got (%q, %v)", tt.want, tt.wantHit, got, ok)
+			}
+		})
+	}
+}
+
+func TestPayloadChangedFiles(t *testing.T) {
+	event := &entity.WebhookEvent{Commits: []entity.WebhookCommit{
+		{Added: []string{"a.go"}, Modified: []string{"docs/index.md"}},
+		{Modified: []string{"a.go"}, Removed: []string{"b.go"}},
+	}}
+	files, ok := PayloadChangedFiles(event)
+	if !ok || len(files) != 3 {
+		t.Errorf("expected 3 files, got %v (%v)", files, ok)
+	}
+
+	// hosters not listing files
+	if _, ok = PayloadChangedFiles(&entity.WebhookEvent{Commits: []entity.WebhookCommit{{SHA: "a"}}}); ok {
+		t.Errorf("expected no file list for commits without files")
+	}
+
+	// truncated payloads
+	event.Commits = make([]entity.WebhookCommit, payloadCommitLimit)
+	event.Commits[0].Added = []string{"a.go"}
+	if _, ok = PayloadChangedFiles(event); ok {
+		t.Errorf("expected no file list for a possibly truncated payload")
+	}
+}
+
+func TestMatchPaths(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter entity.PathFilter
+		files  []string
+		want   bool
+	}{
+		{name: "include", filter: entity.PathFilter{Include: []string{"services/api/**"}}, files: []string{"README.md", "services/api/main.go"}, want: true},
+		{name: "include no match", filter: entity.PathFilter{Include: []string{"services/api/**"}}, files: []string{"services/web/main.go"}},
+		{name: "exclude only docs", filter: entity.PathFilter{Exclude: []string{"docs/**", "**/*.md"}}, files: []string{"docs/a.md", "README.md"}},
+		{name: "exclude with code change", filter: entity.PathFilter{Exclude: []string{"docs/**", "**/*.md"}}, files: []string{"docs/a.md", "main.go"}, want: true},
+		{name: "include and exclude", filter: entity.PathFilter{Include: []string{"services/**"}, Exclude: []string{"**/*_test.go"}}, files: []string{"services/a_test.go"}},
+		{name: "no files", filter: entity.PathFilter{Exclude: []string{"docs/**"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := MatchPaths(tt.filter, tt.files); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package network
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// generic accepts webhooks of any system able to send a JSON payload via POST. The values
+// needed to trigger a build are extracted using the expressions of the build definition.
+type generic struct {
+	opts       entity.GenericWebhook
+	repository string
+}
+
+func (generic) Name() string {
+	return "generic"
+}
+
+func (g generic) configure(content entity.BuildDefinitionContent) Hoster {
+	g.opts = content.Repository.Generic
+	g.repository = content.Repository.Name
+	return g
+}
+
+func (g generic) ParseEvent(r *http.Request, body []byte) (*entity.WebhookEvent, error) {
+	var ref string
+	switch {
+	case g.opts.Ref != "":
+		value, err := lookupPath(body, g.opts.Ref)
+		if err != nil {
+			return nil, fmt.Errorf("could not determine ref: %s", err.Error())
+		}
+		ref = value
+		// plain names are considered branches
+		if !strings.HasPrefix(ref, "refs/") {
+			ref = "refs/heads/" + ref
+		}
+	case g.opts.Branch != "" || g.opts.Tag != "":
+		if g.opts.Branch != "" {
+			value, err := lookupPath(body, g.opts.Branch)
+			if err == nil && value != "" {
+				ref = "refs/heads/" + value
+			}
+		}
+		if ref == "" && g.opts.Tag != "" {
+			value, err := lookupPath(body, g.opts.Tag)
+			if err == nil && value != "" {
+				ref = "refs/tags/" + value
+			}
+		}
+		if ref == "" {
+			return nil, fmt.Errorf("could not determine branch or tag from payload")
+		}
+	default:
+		return nil, fmt.Errorf("no expression for the ref, branch or tag configured")
+	}
+
+	event, err := newRefEvent("generic", ref)
+	if err != nil {
+		return nil, err
+	}
+
+	// the commit is required to tell pushes and deletions apart
+	if g.opts.Commit == "" {
+		return nil, fmt.Errorf("no expression for the commit configured")
+	}
+	if event.After, err = lookupPath(body, g.opts.Commit); err != nil {
+		return nil, fmt.Errorf("could not determine commit: %s", err.Error())
+	}
+	// without an expression, the repository is not checked
+	event.Repository = g.repository
+	if g.opts.Repository != "" {
+		if event.Repository, err = lookupPath(body, g.opts.Repository); err != nil {
+			return nil, fmt.Errorf("could not determine repository: %s", err.Error())
+		}
+	}
+	if !event.IsDeletion() {
+		event.Commits = []entity.WebhookCommit{{SHA: event.After}}
+	}
+
+	return event, nil
+}
+
+// VerifySignature checks the shared secret. With the token auth, the header has to contain the
+// secret itself, with the hmac auth, the hex encoded HMAC-SHA256 signature of the body, optionally
+// prefixed by "sha256=". Instead of the token header, "Authorization: Bearer <secret>" can be used.
+func (g generic) VerifySignature(r *http.Request, body []byte, secret string) error {
+	switch g.opts.Auth {
+	case "none":
+		return nil
+	case "hmac":
+		sig := strings.TrimPrefix(r.Header.Get(g.opts.GetSecretHeader()), "sha256=")
+		if err := verifyHMAC(sig, "", secret, body); err != nil {
+			return fmt.Errorf("generic: %w", err)
+		}
+		return nil
+	case "", "token":
+		token := r.Header.Get(g.opts.GetSecretHeader())
+		if token == "" {
+			token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if token == "" {
+			return fmt.Errorf("generic: %w: missing token", ErrInvalidSignature)
+		}
+		if !constantTimeEquals(token, secret) {
+			return fmt.Errorf("generic: %w: token does not match", ErrInvalidSignature)
+		}
+		return nil
+	default:
+		return fmt.Errorf("generic: unsupported auth %s", g.opts.Auth)
+	}
+}
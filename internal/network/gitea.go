@@ -0,0 +1,108 @@
+package network
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// gitea also covers Forgejo, which sends the same payloads and headers
+type gitea struct{}
+
+func (gitea) Name() string {
+	return "gitea"
+}
+
+func (gitea) ParseEvent(r *http.Request, body []byte) (*entity.WebhookEvent, error) {
+	if _, err := requireHeader(r, "X-Gitea-Delivery"); err != nil {
+		return nil, err
+	}
+	eventType, err := requireHeader(r, "X-Gitea-Event")
+	if err != nil {
+		return nil, err
+	}
+
+	if eventType == "pull_request" {
+		return parseGiteaPullRequest(eventType, body)
+	}
+
+	// pushing a tag sends a push as well as a create event, so only the former is used
+	if eventType != "push" {
+		return &entity.WebhookEvent{Kind: entity.EventKindOther, Type: eventType}, nil
+	}
+
+	var payload entity.GiteaPushPayload
+	if err = decodePayload(body, &payload); err != nil {
+		return nil, err
+	}
+
+	event, err := newRefEvent(eventType, payload.Ref)
+	if err != nil {
+		return nil, err
+	}
+	event.Before = payload.Before
+	event.After = payload.After
+	event.Pusher = payload.Pusher.Username
+	event.Repository = payload.Repository.FullName
+	for _, c := range payload.Commits {
+		event.Commits = append(event.Commits, entity.WebhookCommit{
+			SHA:      c.ID,
+			Message:  c.Message,
+			Author:   c.Author.Name,
+			URL:      c.URL,
+			Added:    c.Added,
+			Modified: c.Modified,
+			Removed:  c.Removed,
+		})
+	}
+
+	return event, nil
+}
+
+// VerifySignature checks the hex encoded HMAC-SHA256 signature in the X-Gitea-Signature header.
+// Newer versions of Forgejo only send the X-Forgejo-Signature header.
+func (gitea) VerifySignature(r *http.Request, body []byte, secret string) error {
+	sig := r.Header.Get("X-Gitea-Signature")
+	if sig == "" {
+		sig = r.Header.Get("X-Forgejo-Signature")
+	}
+	if err := verifyHMAC(sig, "", secret, body); err != nil {
+		return fmt.Errorf("gitea: %w", err)
+	}
+	return nil
+}
+
+func parseGiteaPullRequest(eventType string, body []byte) (*entity.WebhookEvent, error) {
+	var payload entity.GiteaPullRequestPayload
+	if err := decodePayload(body, &payload); err != nil {
+		return nil, err
+	}
+
+	// Gitea does not provide a ref for the merge commit
+	pr := &entity.WebhookPullRequest{
+		Number:       payload.Number,
+		Title:        payload.PullRequest.Title,
+		URL:          payload.PullRequest.HTMLURL,
+		SourceBranch: payload.PullRequest.Head.Ref,
+		TargetBranch: payload.PullRequest.Base.Ref,
+		HeadRef:      fmt.Sprintf("refs/pull/%d/head", payload.Number),
+		HeadSHA:      payload.PullRequest.Head.SHA,
+		FromFork:     payload.PullRequest.Head.RepoID != payload.PullRequest.Base.RepoID,
+	}
+	switch payload.Action {
+	case "opened", "reopened":
+		pr.Action = entity.PullRequestOpened
+	case "synchronized":
+		pr.Action = entity.PullRequestUpdated
+	case "closed":
+		pr.Action = entity.PullRequestClosed
+	default:
+		pr.Action = entity.PullRequestOther
+	}
+
+	event := newPullRequestEvent(eventType, pr)
+	event.Pusher = payload.Sender.Username
+	event.Repository = payload.Repository.FullName
+	return event, nil
+}
@@ -0,0 +1,106 @@
+package network
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+type github struct{}
+
+func (github) Name() string {
+	return "github"
+}
+
+func (github) ParseEvent(r *http.Request, body []byte) (*entity.WebhookEvent, error) {
+	if _, err := requireHeader(r, "X-GitHub-Delivery"); err != nil {
+		return nil, err
+	}
+	eventType, err := requireHeader(r, "X-GitHub-Event")
+	if err != nil {
+		return nil, err
+	}
+
+	switch eventType {
+	case "ping":
+		return &entity.WebhookEvent{Kind: entity.EventKindPing, Type: eventType}, nil
+	case "pull_request":
+		return parseGitHubPullRequest(eventType, body)
+	case "push":
+	default:
+		return &entity.WebhookEvent{Kind: entity.EventKindOther, Type: eventType}, nil
+	}
+
+	var payload entity.GitHubPushPayload
+	if err = decodePayload(body, &payload); err != nil {
+		return nil, err
+	}
+
+	event, err := newRefEvent(eventType, payload.Ref)
+	if err != nil {
+		return nil, err
+	}
+	event.Before = payload.Before
+	event.After = payload.After
+	if payload.Deleted {
+		event.After = ""
+	}
+	event.Pusher = payload.Pusher.Name
+	event.Repository = payload.Repository.FullName
+	for _, c := range payload.Commits {
+		event.Commits = append(event.Commits, entity.WebhookCommit{
+			SHA:      c.ID,
+			Message:  c.Message,
+			Author:   c.Author.Name,
+			URL:      c.URL,
+			Added:    c.Added,
+			Modified: c.Modified,
+			Removed:  c.Removed,
+		})
+	}
+
+	return event, nil
+}
+
+// VerifySignature checks the HMAC-SHA256 signature sent as "sha256=<hex>" in the X-Hub-Signature-256 header
+func (github) VerifySignature(r *http.Request, body []byte, secret string) error {
+	if err := verifyHMAC(r.Header.Get("X-Hub-Signature-256"), "sha256=", secret, body); err != nil {
+		return fmt.Errorf("github: %w", err)
+	}
+	return nil
+}
+
+func parseGitHubPullRequest(eventType string, body []byte) (*entity.WebhookEvent, error) {
+	var payload entity.GitHubPullRequestPayload
+	if err := decodePayload(body, &payload); err != nil {
+		return nil, err
+	}
+
+	pr := &entity.WebhookPullRequest{
+		Number:       payload.Number,
+		Title:        payload.PullRequest.Title,
+		URL:          payload.PullRequest.HTMLURL,
+		SourceBranch: payload.PullRequest.Head.Ref,
+		TargetBranch: payload.PullRequest.Base.Ref,
+		HeadRef:      fmt.Sprintf("refs/pull/%d/head", payload.Number),
+		MergeRef:     fmt.Sprintf("refs/pull/%d/merge", payload.Number),
+		HeadSHA:      payload.PullRequest.Head.SHA,
+		FromFork:     payload.PullRequest.Head.Repo.FullName != payload.Repository.FullName,
+	}
+	switch payload.Action {
+	case "opened", "reopened":
+		pr.Action = entity.PullRequestOpened
+	case "synchronize":
+		pr.Action = entity.PullRequestUpdated
+	case "closed":
+		pr.Action = entity.PullRequestClosed
+	default:
+		pr.Action = entity.PullRequestOther
+	}
+
+	event := newPullRequestEvent(eventType, pr)
+	event.Pusher = payload.Sender.Login
+	event.Repository = payload.Repository.FullName
+	return event, nil
+}
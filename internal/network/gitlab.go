@@ -0,0 +1,104 @@
+package network
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+type gitlab struct{}
+
+func (gitlab) Name() string {
+	return "gitlab"
+}
+
+func (gitlab) ParseEvent(r *http.Request, body []byte) (*entity.WebhookEvent, error) {
+	eventType, err := requireHeader(r, "X-Gitlab-Event")
+	if err != nil {
+		return nil, err
+	}
+
+	// GitLab has no dedicated ping event, testing a webhook sends a regular push event
+	switch eventType {
+	case "Merge Request Hook":
+		return parseGitLabMergeRequest(eventType, body)
+	case "Push Hook", "Tag Push Hook":
+	default:
+		return &entity.WebhookEvent{Kind: entity.EventKindOther, Type: eventType}, nil
+	}
+
+	var payload entity.GitLabPushPayload
+	if err = decodePayload(body, &payload); err != nil {
+		return nil, err
+	}
+
+	event, err := newRefEvent(eventType, payload.Ref)
+	if err != nil {
+		return nil, err
+	}
+	event.Before = payload.Before
+	event.After = payload.After
+	event.Pusher = payload.UserUsername
+	event.Repository = payload.Project.PathWithNamespace
+	for _, c := range payload.Commits {
+		event.Commits = append(event.Commits, entity.WebhookCommit{
+			SHA:      c.ID,
+			Message:  c.Message,
+			Author:   c.Author.Name,
+			URL:      c.URL,
+			Added:    c.Added,
+			Modified: c.Modified,
+			Removed:  c.Removed,
+		})
+	}
+
+	return event, nil
+}
+
+// VerifySignature checks the secret token sent in plain text in the X-Gitlab-Token header
+func (gitlab) VerifySignature(r *http.Request, _ []byte, secret string) error {
+	if !constantTimeEquals(r.Header.Get("X-Gitlab-Token"), secret) {
+		return fmt.Errorf("gitlab: %w: X-Gitlab-Token does not match", ErrInvalidSignature)
+	}
+	return nil
+}
+
+func parseGitLabMergeRequest(eventType string, body []byte) (*entity.WebhookEvent, error) {
+	var payload entity.GitLabMergeRequestPayload
+	if err := decodePayload(body, &payload); err != nil {
+		return nil, err
+	}
+
+	attr := payload.ObjectAttributes
+	pr := &entity.WebhookPullRequest{
+		Number:       attr.IID,
+		Title:        attr.Title,
+		URL:          attr.URL,
+		SourceBranch: attr.SourceBranch,
+		TargetBranch: attr.TargetBranch,
+		HeadRef:      fmt.Sprintf("refs/merge-requests/%d/head", attr.IID),
+		MergeRef:     fmt.Sprintf("refs/merge-requests/%d/merge", attr.IID),
+		HeadSHA:      attr.LastCommit.ID,
+		FromFork:     attr.SourceProjectID != attr.TargetProjectID,
+	}
+	switch attr.Action {
+	case "open", "reopen":
+		pr.Action = entity.PullRequestOpened
+	case "update":
+		// updates without an old revision only changed the description, labels or the like
+		pr.Action = entity.PullRequestOther
+		if attr.OldRev != "" {
+			pr.Action = entity.PullRequestUpdated
+		}
+	case "close", "merge":
+		pr.Action = entity.PullRequestClosed
+	default:
+		pr.Action = entity.PullRequestOther
+	}
+
+	event := newPullRequestEvent(eventType, pr)
+	event.Pusher = payload.User.Username
+	event.Repository = payload.Project.PathWithNamespace
+	return event, nil
+}
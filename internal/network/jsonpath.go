@@ -0,0 +1,117 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lookupPath evaluates a JSONPath-like expression against the JSON document and returns the
+// value as string. Supported are member access by name ("a.b" or "a['b']"), array elements
+// by index ("a[0]"), counting from the end for negative indexes ("a[-1]"), and an optional
+// leading "$". Numbers and booleans are formatted, objects and arrays cannot be returned.
+func lookupPath(body []byte, expr string) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return "", fmt.Errorf("could not decode json payload: %s", err.Error())
+	}
+
+	segments, err := parsePath(expr)
+	if err != nil {
+		return "", err
+	}
+
+	current := doc
+	for _, seg := range segments {
+		switch v := current.(type) {
+		case map[string]any:
+			if seg.isIndex {
+				return "", fmt.Errorf("%s: cannot index an object", expr)
+			}
+			val, ok := v[seg.key]
+			if !ok {
+				return "", fmt.Errorf("%s: member %s not found", expr, seg.key)
+			}
+			current = val
+		case []any:
+			if !seg.isIndex {
+				return "", fmt.Errorf("%s: cannot access member %s of an array", expr, seg.key)
+			}
+			i := seg.index
+			if i < 0 {
+				i += len(v)
+			}
+			if i < 0 || i >= len(v) {
+				return "", fmt.Errorf("%s: index %d out of range", expr, seg.index)
+			}
+			current = v[i]
+		default:
+			return "", fmt.Errorf("%s: cannot descend into a scalar value", expr)
+		}
+	}
+
+	switch v := current.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", fmt.Errorf("%s: does not refer to a scalar value", expr)
+	}
+}
+
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath splits an expression like "$.a.b[0]['c.d']" into its segments
+func parsePath(expr string) ([]pathSegment, error) {
+	p := strings.TrimSpace(expr)
+	p = strings.TrimPrefix(p, "$")
+	segments := make([]pathSegment, 0)
+
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%s: missing ]", expr)
+			}
+			inner := p[1:end]
+			p = p[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, pathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			i, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid index %s", expr, inner)
+			}
+			segments = append(segments, pathSegment{index: i, isIndex: true})
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			segments = append(segments, pathSegment{key: p[:end]})
+			p = p[end:]
+		}
+	}
+
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("expression %s is empty", expr)
+	}
+	return segments, nil
+}
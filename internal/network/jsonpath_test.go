@@ -0,0 +1,39 @@
+package network
+
+import "testing"
+
+func TestLookupPath(t *testing.T) {
+	const doc = `{"a": {"b": [1, {"c": "x"}, true], "d.e": "dotted", "n": null}, "num": 12.5}`
+
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{expr: "$.a.b[1].c", want: "x"},
+		{expr: "a.b[1]['c']", want: "x"},
+		{expr: "a.b[0]", want: "1"},
+		{expr: "a.b[-1]", want: "true"},
+		{expr: `$.a["d.e"]`, want: "dotted"},
+		{expr: "$.num", want: "12.5"},
+		{expr: "a.n", want: ""},
+		{expr: "a.b[3]", wantErr: true},
+		{expr: "a.x", wantErr: true},
+		{expr: "a.b", wantErr: true},
+		{expr: "a[0]", wantErr: true},
+		{expr: "a.b[x]", wantErr: true},
+		{expr: "a.b[0", wantErr: true},
+		{expr: "$", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := lookupPath([]byte(doc), tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lookupPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
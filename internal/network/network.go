@@ -2,129 +2,213 @@ package network
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/common"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/git"
 	"github.com/KaiserWerk/Tiny-Build-Server/internal/helper"
 )
 
-// CheckPayloadRequestHeader checks the existence and values taken from HTTP request headers
-// from the given HTTP request
-func CheckPayloadRequestHeader(content entity.BuildDefinitionContent, r *http.Request) error {
-	var err error
-
-	switch content.Repository.Hoster {
-	case "bitbucket":
-		headers := []string{"X-Event-Key", "X-Hook-Uuid", "X-Request-Uuid", "X-Attempt-Number"}
-		for _, h := range headers {
-			if _, err = helper.GetHeaderIfSet(r, h); err != nil {
-				return fmt.Errorf("bitbucket: could not get header %s", h)
-			}
-		}
+var (
+	// ErrRefNotMatched is returned if the pushed branch or tag does not match the patterns of a build definition
+	ErrRefNotMatched = errors.New("ref does not match the build definition")
+)
 
-		var payload entity.BitBucketPushPayload
-		err = json.NewDecoder(r.Body).Decode(&payload)
-		if err != nil {
-			return fmt.Errorf("bitbucket: could not decode json payload: %s", err.Error())
-		}
-		_ = r.Body.Close()
-		if payload.Push.Changes[0].New.Name != content.Repository.Branch {
-			return fmt.Errorf("bitbucket: branch names do not match (from payload: %s, from build definition: %s)", payload.Push.Changes[0].New.Name, content.Repository.Branch)
-		}
-		if payload.Repository.FullName != content.Repository.Name {
-			return fmt.Errorf("bitbucket: repository names do not match (from payload: %s, from build definition: %s)", payload.Repository.FullName, content.Repository.Name)
-		}
-	case "github":
-		headers := []string{"X-GitHub-Delivery", "X-GitHub-Event", "X-Hub-Signature"}
-		for _, h := range headers {
-			if _, err = helper.GetHeaderIfSet(r, h); err != nil {
-				return fmt.Errorf("github: could not get header %s", h)
-			}
-		}
+// Hoster parses webhook requests sent by a git hoster
+type Hoster interface {
+	// Name returns the name of the hoster as used in build definitions
+	Name() string
+	// ParseEvent checks the request headers and parses the payload into a hoster independent event
+	ParseEvent(r *http.Request, body []byte) (*entity.WebhookEvent, error)
+	// VerifySignature checks the signature or token sent with the request against the secret
+	VerifySignature(r *http.Request, body []byte, secret string) error
+}
 
-		var payload entity.GitHubPushPayload
-		err = json.NewDecoder(r.Body).Decode(&payload)
-		if err != nil {
-			return fmt.Errorf("github: could not decode json payload")
-		}
-		_ = r.Body.Close()
-		if payload.Repository.DefaultBranch != content.Repository.Branch {
-			return fmt.Errorf("github: branch names do not match (from payload: %s, from build definition: %s)", payload.Repository.DefaultBranch, content.Repository.Branch)
-		}
-		if payload.Repository.FullName != content.Repository.Name {
-			return fmt.Errorf("github: repository names do not match (from payload: %s, from build definition: %s)", payload.Repository.FullName, content.Repository.Name)
-		}
-	case "gitlab":
-		headers := []string{"X-GitLab-Event"}
-		for _, h := range headers {
-			if _, err = helper.GetHeaderIfSet(r, h); err != nil {
-				return fmt.Errorf("gitlab: could not get header %s", h)
-			}
-		}
+// configurable is implemented by hosters which depend on the build definition
+type configurable interface {
+	configure(content entity.BuildDefinitionContent) Hoster
+}
 
-		var payload entity.GitLabPushPayload
-		err = json.NewDecoder(r.Body).Decode(&payload)
-		_ = r.Body.Close()
-		if err != nil {
-			return fmt.Errorf("gitlab: could not decode json payload: %s", err.Error())
-		}
-		branch := strings.Split(payload.Ref, "/")[2]
-		if branch != content.Repository.Branch {
-			return fmt.Errorf("gitlab: branch names do not match (from payload: %s, from build definition: %s)", branch, content.Repository.Branch)
-		}
-		if payload.Project.PathWithNamespace != content.Repository.Name {
-			return fmt.Errorf("gitlab: repository names do not match (from payload: %s, from build definition: %s)", payload.Project.PathWithNamespace, content.Repository.Name)
-		}
-	case "gitea":
-		headers := []string{"X-Gitea-Delivery", "X-Gitea-Event"}
-		for _, h := range headers {
-			if _, err = helper.GetHeaderIfSet(r, h); err != nil {
-				return fmt.Errorf("gitea: could not get header %s", h)
-			}
-		}
+var hosters = map[string]Hoster{}
 
-		var payload entity.GiteaPushPayload
-		err = json.NewDecoder(r.Body).Decode(&payload)
-		if err != nil {
-			return fmt.Errorf("gitea: could not decode json payload: %s", err.Error())
-		}
-		_ = r.Body.Close()
+func registerHoster(h Hoster) {
+	hosters[h.Name()] = h
+}
 
-		branch := strings.Split(payload.Ref, "/")[2]
-		if branch != content.Repository.Branch {
-			return fmt.Errorf("gitea: branch names do not match (from payload: %s, from build definition: %s)", branch, content.Repository.Branch)
-		}
-		if payload.Repository.FullName != content.Repository.Name {
-			return fmt.Errorf("gitea: repository names do not match (from payload: %s, from build definition: %s)"+payload.Repository.FullName, content.Repository.Name)
-		}
-	case "azure_devops":
-		headers := []string{"X-Request-Type"}
-		for _, h := range headers {
-			if _, err = helper.GetHeaderIfSet(r, h); err != nil {
-				return fmt.Errorf("azure devops: could not get header %s", h)
-			}
-		}
+func init() {
+	registerHoster(bitbucket{})
+	registerHoster(github{})
+	registerHoster(gitlab{})
+	registerHoster(gitea{})
+	registerHoster(azureDevOps{})
+	registerHoster(generic{})
+}
 
-		var payload entity.AzurePushPayload
-		err = json.NewDecoder(r.Body).Decode(&payload)
-		if err != nil {
-			return fmt.Errorf("azure devops: could not decode json payload: %s", err.Error())
-		}
-		_ = r.Body.Close()
-		// the name is supplied  in the form of "refs/heads/<branch>"
-		if payload.Resource.RefUpdates[0].Name != "refs/heads/"+content.Repository.Branch {
-			return fmt.Errorf("azure devops: branch names do not match (from payload: %s, from build definition: %s)",
-				payload.Resource.RefUpdates[0].Name, "refs/heads/"+content.Repository.Branch)
+// GetHoster returns the hoster with the given name
+func GetHoster(name string) (Hoster, error) {
+	h, ok := hosters[name]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized git hoster %s", name)
+	}
+	return h, nil
+}
+
+// HosterFor returns the hoster of the build definition, configured accordingly
+func HosterFor(content entity.BuildDefinitionContent) (Hoster, error) {
+	h, err := GetHoster(content.Repository.Hoster)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := h.(configurable); ok {
+		return c.configure(content), nil
+	}
+	return h, nil
+}
+
+// ParseWebhookEvent parses the webhook request sent by the hoster of the build definition into an
+// event. The repository of push and tag events has to be the one of the build definition.
+func ParseWebhookEvent(content entity.BuildDefinitionContent, r *http.Request, body []byte) (*entity.WebhookEvent, error) {
+	h, err := HosterFor(content)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := h.ParseEvent(r, body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", h.Name(), err.Error())
+	}
+	// the commits end up as arguments of git commands, so nothing but a commit hash is accepted
+	for _, sha := range []string{event.Before, event.After} {
+		if sha != "" && !git.IsCommitSHA(sha) {
+			return nil, fmt.Errorf("%s: invalid commit %q", h.Name(), sha)
 		}
-		if payload.Resource.Repository.Name != content.Repository.Name {
-			return fmt.Errorf("azure devops: repository names do not match (from payload: %s, from build definition: %s)",
-				payload.Resource.Repository.Name, content.Repository.Name)
+	}
+
+	if event.IsBuildable() && event.Repository != content.Repository.Name {
+		return nil, fmt.Errorf("%s: repository names do not match (from payload: %s, from build definition: %s)",
+			h.Name(), event.Repository, content.Repository.Name)
+	}
+
+	return event, nil
+}
+
+// ResolveRef checks whether the event matches the build definition and returns the ref to build.
+// Pushed branches and tags have to match one of the branch or tag patterns, pull requests
+// have to be enabled and target a branch matching the pull request's branch patterns.
+func ResolveRef(content entity.BuildDefinitionContent, event *entity.WebhookEvent) (entity.GitRef, error) {
+	if event.Kind == entity.EventKindPullRequest {
+		return resolvePullRequestRef(content, event.PullRequest)
+	}
+
+	ref := event.GitRef
+	if ref.IsTag() {
+		if !common.MatchAnyPattern(content.Repository.Tags, ref.Tag) {
+			return entity.GitRef{}, fmt.Errorf("%w: tag %s does not match any tag pattern", ErrRefNotMatched, ref.Tag)
 		}
-	default:
-		return fmt.Errorf("unrecognized git hoster %s", content.Repository.Hoster)
+	} else if !common.MatchAnyPattern(content.Repository.GetBranchPatterns(), ref.Branch) {
+		return entity.GitRef{}, fmt.Errorf("%w: branch %s does not match any branch pattern", ErrRefNotMatched, ref.Branch)
+	}
+
+	return ref, nil
+}
+
+func resolvePullRequestRef(content entity.BuildDefinitionContent, pr *entity.WebhookPullRequest) (entity.GitRef, error) {
+	opts := content.PullRequest
+	if !opts.Enabled {
+		return entity.GitRef{}, fmt.Errorf("%w: pull request builds are disabled", ErrRefNotMatched)
+	}
+	if pr.FromFork && !opts.AllowForks {
+		return entity.GitRef{}, fmt.Errorf("%w: pull requests from forks are not allowed", ErrRefNotMatched)
 	}
 
+	patterns := opts.Branches
+	if len(patterns) == 0 {
+		patterns = content.Repository.GetBranchPatterns()
+	}
+	if !common.MatchAnyPattern(patterns, pr.TargetBranch) {
+		return entity.GitRef{}, fmt.Errorf("%w: target branch %s does not match any pull request branch pattern", ErrRefNotMatched, pr.TargetBranch)
+	}
+
+	ref := pr.HeadRef
+	if opts.Checkout == "merge" {
+		ref = pr.MergeRef
+	}
+	if ref == "" {
+		return entity.GitRef{}, fmt.Errorf("%w: the hoster provides no ref to check out the pull request's %s commit", ErrRefNotMatched, opts.Checkout)
+	}
+
+	return entity.GitRef{Branch: pr.SourceBranch, Ref: ref}, nil
+}
+
+// VerifySignature verifies that the webhook request was sent by the git hoster by checking the
+// signature or token, depending on the hoster, against the webhook secret of the build definition.
+// The body is the raw request body, as the signatures are computed over the exact bytes sent.
+func VerifySignature(h Hoster, secret string, r *http.Request, body []byte) error {
+	if secret == "" {
+		return fmt.Errorf("%w: no webhook secret set", ErrInvalidSignature)
+	}
+	return h.VerifySignature(r, body, secret)
+}
+
+// parseRef returns the branch or tag from a ref in the form of "refs/heads/<branch>"
+// or "refs/tags/<tag>"
+func parseRef(ref string) (entity.GitRef, error) {
+	if name := strings.TrimPrefix(ref, "refs/heads/"); name != ref && name != "" {
+		return entity.GitRef{Branch: name}, nil
+	}
+	if name := strings.TrimPrefix(ref, "refs/tags/"); name != ref && name != "" {
+		return entity.GitRef{Tag: name}, nil
+	}
+	return entity.GitRef{}, fmt.Errorf("ref %s does not refer to a branch or tag", ref)
+}
+
+// newRefEvent creates a push or tag event, depending on the given ref
+func newRefEvent(eventType, ref string) (*entity.WebhookEvent, error) {
+	gitRef, err := parseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &entity.WebhookEvent{
+		GitRef: gitRef,
+		Kind:   entity.EventKindPush,
+		Type:   eventType,
+		Ref:    ref,
+	}
+	if gitRef.IsTag() {
+		event.Kind = entity.EventKindTag
+	}
+	return event, nil
+}
+
+// newPullRequestEvent creates a pull request event
+func newPullRequestEvent(eventType string, pr *entity.WebhookPullRequest) *entity.WebhookEvent {
+	return &entity.WebhookEvent{
+		GitRef:      entity.GitRef{Branch: pr.SourceBranch, Ref: pr.HeadRef},
+		Kind:        entity.EventKindPullRequest,
+		Type:        eventType,
+		Ref:         pr.HeadRef,
+		After:       pr.HeadSHA,
+		PullRequest: pr,
+	}
+}
+
+// requireHeader returns the value of the header, if it is set
+func requireHeader(r *http.Request, name string) (string, error) {
+	v, err := helper.GetHeaderIfSet(r, name)
+	if err != nil {
+		return "", fmt.Errorf("could not get header %s", name)
+	}
+	return v, nil
+}
+
+func decodePayload(body []byte, payload any) error {
+	if err := json.Unmarshal(body, payload); err != nil {
+		return fmt.Errorf("could not decode json payload: %s", err.Error())
+	}
 	return nil
 }
@@ -0,0 +1,47 @@
+package network
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalidSignature is returned if a webhook request could not be verified using the webhook secret
+	ErrInvalidSignature = errors.New("webhook signature verification failed")
+)
+
+// verifyHMAC checks the hex encoded HMAC-SHA256 signature, optionally prefixed, against the one
+// computed over the body using the secret
+func verifyHMAC(signature, prefix, secret string, body []byte) error {
+	if signature == "" {
+		return fmt.Errorf("%w: missing signature", ErrInvalidSignature)
+	}
+	if !strings.HasPrefix(signature, prefix) {
+		return fmt.Errorf("%w: unsupported signature format", ErrInvalidSignature)
+	}
+	received, err := hex.DecodeString(strings.TrimPrefix(signature, prefix))
+	if err != nil {
+		return fmt.Errorf("%w: malformed signature", ErrInvalidSignature)
+	}
+
+	if !hmac.Equal(received, Sign(secret, body)) {
+		return fmt.Errorf("%w: signature does not match", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// Sign computes the HMAC-SHA256 of the body using the secret
+func Sign(secret string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func constantTimeEquals(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
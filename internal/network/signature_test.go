@@ -0,0 +1,70 @@
+package network
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPayloadSignature(t *testing.T) {
+	const (
+		secret = "s3cr3t"
+		body   = `{"ref": "refs/heads/master"}`
+	)
+	sig := hex.EncodeToString(Sign(secret, []byte(body)))
+	wrongSig := hex.EncodeToString(Sign("other", []byte(body)))
+
+	tests := []struct {
+		name    string
+		hoster  string
+		secret  string
+		headers map[string]string
+		auth    []string
+		wantErr bool
+	}{
+		{name: "github valid", hoster: "github", secret: secret, headers: map[string]string{"X-Hub-Signature-256": "sha256=" + sig}},
+		{name: "github wrong signature", hoster: "github", secret: secret, headers: map[string]string{"X-Hub-Signature-256": "sha256=" + wrongSig}, wantErr: true},
+		{name: "github missing signature", hoster: "github", secret: secret, wantErr: true},
+		{name: "github missing prefix", hoster: "github", secret: secret, headers: map[string]string{"X-Hub-Signature-256": sig}, wantErr: true},
+		{name: "github no secret", hoster: "github", headers: map[string]string{"X-Hub-Signature-256": "sha256=" + sig}, wantErr: true},
+		{name: "bitbucket valid", hoster: "bitbucket", secret: secret, headers: map[string]string{"X-Hub-Signature": "sha256=" + sig}},
+		{name: "gitea valid", hoster: "gitea", secret: secret, headers: map[string]string{"X-Gitea-Signature": sig}},
+		{name: "forgejo valid", hoster: "gitea", secret: secret, headers: map[string]string{"X-Forgejo-Signature": sig}},
+		{name: "gitea malformed", hoster: "gitea", secret: secret, headers: map[string]string{"X-Gitea-Signature": "xyz"}, wantErr: true},
+		{name: "gitlab valid", hoster: "gitlab", secret: secret, headers: map[string]string{"X-Gitlab-Token": secret}},
+		{name: "gitlab wrong token", hoster: "gitlab", secret: secret, headers: map[string]string{"X-Gitlab-Token": "nope"}, wantErr: true},
+		{name: "azure valid", hoster: "azure_devops", secret: secret, auth: []string{"tbs", secret}},
+		{name: "azure wrong password", hoster: "azure_devops", secret: secret, auth: []string{"tbs", "nope"}, wantErr: true},
+		{name: "azure missing auth", hoster: "azure_devops", secret: secret, wantErr: true},
+		{name: "generic token", hoster: "generic", secret: secret, headers: map[string]string{"X-Webhook-Secret": secret}},
+		{name: "generic bearer token", hoster: "generic", secret: secret, headers: map[string]string{"Authorization": "Bearer " + secret}},
+		{name: "generic wrong token", hoster: "generic", secret: secret, headers: map[string]string{"X-Webhook-Secret": "nope"}, wantErr: true},
+		{name: "generic missing token", hoster: "generic", secret: secret, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := GetHoster(tt.hoster)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+
+			r := httptest.NewRequest("POST", "/api/v1/receive", strings.NewReader(body))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if tt.auth != nil {
+				r.SetBasicAuth(tt.auth[0], tt.auth[1])
+			}
+
+			err = VerifySignature(h, tt.secret, r, []byte(body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifySignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("expected ErrInvalidSignature, got %v", err)
+			}
+		})
+	}
+}
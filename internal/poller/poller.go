@@ -0,0 +1,287 @@
+package poller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/buildservice"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/common"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/dbservice"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/git"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/logging"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/network"
+)
+
+const (
+	// tick is the interval in which the poller checks for build definitions due to be polled
+	tick = 30 * time.Second
+	// pollTimeout limits the time a single poll may take
+	pollTimeout = time.Minute
+)
+
+// Builder loads build definitions and starts builds, as done for webhooks
+type Builder interface {
+	LoadBuildDefinition(bd *entity.BuildDefinition) ([]entity.UserVariable, error)
+	StartBuild(bd *entity.BuildDefinition, be *entity.BuildExecution, variables []entity.UserVariable) error
+}
+
+// Poller periodically polls the repositories of build definitions with polling enabled using
+// git ls-remote, and starts a build whenever a watched branch or tag points to a new commit
+type Poller struct {
+	builder      Builder
+	dbService    dbservice.IDBService
+	buildService buildservice.IBuildService
+	logger       logging.ILogger
+	// lsRemote lists the refs of a repository; replaceable for testing
+	lsRemote func(ctx context.Context, url string, auth git.Auth) (map[string]string, error)
+	now      func() time.Time
+
+	mut       sync.Mutex
+	schedules map[uint]*schedule
+}
+
+// schedule keeps track of when a build definition is due to be polled
+type schedule struct {
+	next     time.Time
+	failures int
+}
+
+// New creates a new poller
+func New(b Builder, ds dbservice.IDBService, bs buildservice.IBuildService, logger logging.ILogger) *Poller {
+	return &Poller{
+		builder:      b,
+		dbService:    ds,
+		buildService: bs,
+		logger:       logger,
+		lsRemote:     git.LsRemote,
+		now:          time.Now,
+		schedules:    make(map[uint]*schedule),
+	}
+}
+
+// Run polls the repositories until the context is canceled
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		p.PollDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PollDue polls the repositories of all build definitions which are due
+func (p *Poller) PollDue(ctx context.Context) {
+	definitions, err := p.dbService.GetAllBuildDefinitions()
+	if err != nil {
+		p.logger.WithField("error", err.Error()).Error("could not get build definitions")
+		return
+	}
+
+	for i := range definitions {
+		if ctx.Err() != nil {
+			return
+		}
+		bd := &definitions[i]
+		if bd.Deleted {
+			continue
+		}
+
+		variables, err := p.builder.LoadBuildDefinition(bd)
+		if err != nil {
+			p.logger.WithFields(logrus.Fields{
+				"id":    bd.ID,
+				"error": err.Error(),
+			}).Debug("could not load build definition")
+			continue
+		}
+		if !bd.Data.Polling.Enabled {
+			p.forget(bd.ID)
+			continue
+		}
+		if !p.isDue(bd.ID) {
+			continue
+		}
+
+		pollCtx, cancel := context.WithTimeout(ctx, pollTimeout)
+		err = p.poll(pollCtx, bd, variables)
+		cancel()
+		p.reschedule(bd, err)
+	}
+}
+
+// poll compares the refs of the repository with the stored poll states and starts builds
+// for watched refs pointing to a new commit. On the very first poll of a build definition,
+// the states are only recorded, so enabling polling does not start a build for every ref.
+// The state of a ref is only saved once its build was started, so a failed start is retried.
+func (p *Poller) poll(ctx context.Context, bd *entity.BuildDefinition, variables []entity.UserVariable) error {
+	content := bd.Data
+	url, auth, err := p.buildService.GetRepositoryAccess(ctx, bd)
+	if err != nil {
+		return err
+	}
+
+	refs, err := p.lsRemote(ctx, url, auth)
+	if err != nil {
+		return err
+	}
+
+	states, err := p.dbService.GetPollStates(bd.ID)
+	if err != nil {
+		return err
+	}
+	// the marker is saved after the first poll, even if no ref is watched; states of refs
+	// without marker were saved before the marker was introduced
+	initial := len(states) == 0
+	var marked bool
+	known := make(map[string]*entity.PollState, len(states))
+	for i := range states {
+		if states[i].IsMarker() {
+			marked = true
+			continue
+		}
+		known[states[i].Ref] = &states[i]
+	}
+
+	now := p.now()
+	for ref, sha := range refs {
+		gitRef, ok := p.watched(content, ref)
+		if !ok {
+			continue
+		}
+
+		state, exists := known[ref]
+		delete(known, ref)
+		if exists && state.SHA == sha {
+			continue
+		}
+		if !initial {
+			if err = p.startBuild(bd, variables, gitRef, sha); err != nil {
+				return err
+			}
+		}
+
+		if !exists {
+			state = &entity.PollState{BuildDefinitionID: bd.ID, Ref: ref}
+		}
+		state.SHA = sha
+		state.PolledAt = now
+		if err = p.dbService.SavePollState(state); err != nil {
+			return err
+		}
+	}
+
+	// refs which are gone or not watched anymore
+	for _, state := range known {
+		if err = p.dbService.DeletePollState(state); err != nil {
+			return err
+		}
+	}
+
+	if !marked {
+		return p.dbService.SavePollState(&entity.PollState{BuildDefinitionID: bd.ID, PolledAt: now})
+	}
+	return nil
+}
+
+// watched checks whether the ref is a branch or tag matching the patterns of the build definition
+func (p *Poller) watched(content entity.BuildDefinitionContent, ref string) (entity.GitRef, bool) {
+	event := &entity.WebhookEvent{Kind: entity.EventKindPush, Ref: ref}
+	if name := strings.TrimPrefix(ref, "refs/heads/"); name != ref {
+		event.Branch = name
+	} else if name = strings.TrimPrefix(ref, "refs/tags/"); name != ref {
+		event.Kind = entity.EventKindTag
+		event.Tag = name
+	} else {
+		return entity.GitRef{}, false
+	}
+
+	gitRef, err := network.ResolveRef(content, event)
+	if err != nil {
+		return entity.GitRef{}, false
+	}
+	return gitRef, true
+}
+
+// startBuild starts a build of the ref at the given commit, using the default parameter values
+func (p *Poller) startBuild(bd *entity.BuildDefinition, variables []entity.UserVariable, ref entity.GitRef, sha string) error {
+	params, err := common.ResolveParameters(bd.Data.Parameters, nil)
+	if err != nil {
+		return err
+	}
+
+	be := entity.NewBuildExecution(bd.ID, 0)
+	be.SetRef(ref)
+	be.SetParameters(params)
+	be.CommitSHA = sha
+	if err = p.builder.StartBuild(bd, be, variables); err != nil {
+		return err
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"id":     bd.ID,
+		"ref":    ref.Name(),
+		"commit": sha,
+	}).Info("started build for polled commit")
+	return nil
+}
+
+// isDue checks whether the build definition is due to be polled. Build definitions
+// which have not been polled yet are always due.
+func (p *Poller) isDue(bdID uint) bool {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	s, ok := p.schedules[bdID]
+	return !ok || !p.now().Before(s.next)
+}
+
+// reschedule determines the time of the next poll. After errors, the interval is doubled with
+// every consecutive error, up to the maximum backoff.
+func (p *Poller) reschedule(bd *entity.BuildDefinition, err error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	s, ok := p.schedules[bd.ID]
+	if !ok {
+		s = &schedule{}
+		p.schedules[bd.ID] = s
+	}
+
+	opts := bd.Data.Polling
+	wait := opts.GetInterval()
+	if err == nil {
+		s.failures = 0
+	} else {
+		s.failures++
+		for i := 1; i < s.failures && wait < opts.GetMaxBackoff(); i++ {
+			wait *= 2
+		}
+		if wait > opts.GetMaxBackoff() {
+			wait = opts.GetMaxBackoff()
+		}
+		p.logger.WithFields(logrus.Fields{
+			"id":       bd.ID,
+			"failures": s.failures,
+			"retryIn":  wait.String(),
+			"error":    err.Error(),
+		}).Warn("could not poll repository")
+	}
+	s.next = p.now().Add(wait)
+}
+
+// forget removes the schedule of a build definition, e.g. if polling was disabled
+func (p *Poller) forget(bdID uint) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	delete(p.schedules, bdID)
+}
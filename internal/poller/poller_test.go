@@ -0,0 +1,231 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/dbservice"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/git"
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/logging"
+)
+
+type fakeDB struct {
+	dbservice.DBServiceMock
+	definitions []entity.BuildDefinition
+	states      map[string]entity.PollState
+}
+
+func (f *fakeDB) GetAllBuildDefinitions() ([]entity.BuildDefinition, error) {
+	return f.definitions, nil
+}
+
+func (f *fakeDB) GetPollStates(bdID uint) ([]entity.PollState, error) {
+	states := make([]entity.PollState, 0, len(f.states))
+	for _, s := range f.states {
+		states = append(states, s)
+	}
+	return states, nil
+}
+
+func (f *fakeDB) SavePollState(state *entity.PollState) error {
+	f.states[state.Ref] = *state
+	return nil
+}
+
+func (f *fakeDB) DeletePollState(state *entity.PollState) error {
+	delete(f.states, state.Ref)
+	return nil
+}
+
+type fakeBuildService struct{}
+
+func (fakeBuildService) Checkout(ctx context.Context, repositoryUrl string, auth git.Auth, path string, ref entity.GitRef, sha string, opts entity.Checkout) (string, error) {
+	return "", nil
+}
+func (fakeBuildService) GetRepositoryAccess(ctx context.Context, bd *entity.BuildDefinition) (string, git.Auth, error) {
+	return bd.Data.Repository.Url, git.Auth{}, nil
+}
+func (fakeBuildService) GetBasePath() string {
+	return ""
+}
+
+type fakeBuilder struct {
+	polling entity.Polling
+	started []*entity.BuildExecution
+	err     error
+}
+
+func (f *fakeBuilder) LoadBuildDefinition(bd *entity.BuildDefinition) ([]entity.UserVariable, error) {
+	bd.Data.Repository = entity.Repository{
+		Hoster:   "gitea",
+		Url:      "https://git.example.com/user/repo",
+		Branches: []string{"main", "release/*"},
+		Tags:     []string{"v*"},
+	}
+	bd.Data.Polling = f.polling
+	return nil, nil
+}
+
+func (f *fakeBuilder) StartBuild(bd *entity.BuildDefinition, be *entity.BuildExecution, variables []entity.UserVariable) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.started = append(f.started, be)
+	return nil
+}
+
+func newTestPoller(t *testing.T) (*Poller, *fakeDB, *fakeBuilder, *map[string]string, *time.Time) {
+	t.Helper()
+	logger, _, _ := logging.NewLogger(logging.LevelDebug, "", "", logging.ModeDiscard)
+
+	db := &fakeDB{
+		definitions: []entity.BuildDefinition{{Raw: "-"}},
+		states:      make(map[string]entity.PollState),
+	}
+	db.definitions[0].ID = 1
+	builder := &fakeBuilder{polling: entity.Polling{Enabled: true, Interval: 5 * time.Minute, MaxBackoff: 20 * time.Minute}}
+	refs := map[string]string{}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	p := New(builder, db, fakeBuildService{}, logger)
+	p.now = func() time.Time { return now }
+	p.lsRemote = func(ctx context.Context, url string, auth git.Auth) (map[string]string, error) {
+		if refs == nil {
+			return nil, errors.New("unreachable")
+		}
+		return refs, nil
+	}
+	return p, db, builder, &refs, &now
+}
+
+func TestPoller_StartsBuildsForChangedRefs(t *testing.T) {
+	p, db, builder, refs, now := newTestPoller(t)
+	ctx := context.Background()
+
+	*refs = map[string]string{
+		"refs/heads/main":      "a1",
+		"refs/heads/feature/x": "b1",
+		"refs/tags/v1.0.0":     "c1",
+	}
+	p.PollDue(ctx)
+	if len(builder.started) != 0 {
+		t.Fatalf("expected the first poll to only record the states, got %d builds", len(builder.started))
+	}
+	if len(db.states) != 3 || !db.states[""].IsMarker() {
+		t.Fatalf("expected 2 watched refs and the marker, got %v", db.states)
+	}
+
+	// not due yet
+	(*refs)["refs/heads/main"] = "a2"
+	p.PollDue(ctx)
+	if len(builder.started) != 0 {
+		t.Fatalf("expected no build before the interval elapsed, got %d", len(builder.started))
+	}
+
+	*now = now.Add(5 * time.Minute)
+	(*refs)["refs/heads/release/1.0"] = "d1"
+	(*refs)["refs/heads/feature/x"] = "b2"
+	p.PollDue(ctx)
+	if len(builder.started) != 2 {
+		t.Fatalf("expected 2 builds, got %d", len(builder.started))
+	}
+	got := map[string]string{}
+	for _, be := range builder.started {
+		got[be.Branch] = be.CommitSHA
+	}
+	if got["main"] != "a2" || got["release/1.0"] != "d1" {
+		t.Errorf("unexpected builds: %v", got)
+	}
+
+	// deleted refs are forgotten
+	*now = now.Add(5 * time.Minute)
+	delete(*refs, "refs/tags/v1.0.0")
+	p.PollDue(ctx)
+	if _, ok := db.states["refs/tags/v1.0.0"]; ok {
+		t.Errorf("expected the state of the deleted tag to be removed")
+	}
+	if len(builder.started) != 2 {
+		t.Errorf("expected no further builds, got %d", len(builder.started))
+	}
+}
+
+func TestPoller_RetriesFailedBuilds(t *testing.T) {
+	p, db, builder, refs, now := newTestPoller(t)
+	ctx := context.Background()
+
+	*refs = map[string]string{"refs/heads/main": "a1"}
+	p.PollDue(ctx)
+
+	*now = now.Add(5 * time.Minute)
+	(*refs)["refs/heads/main"] = "a2"
+	builder.err = errors.New("database unavailable")
+	p.PollDue(ctx)
+	if db.states["refs/heads/main"].SHA != "a1" {
+		t.Fatalf("expected the commit not to be recorded as seen, got %s", db.states["refs/heads/main"].SHA)
+	}
+
+	*now = p.schedules[1].next
+	builder.err = nil
+	p.PollDue(ctx)
+	if len(builder.started) != 1 || builder.started[0].CommitSHA != "a2" {
+		t.Fatalf("expected the build to be started on the next poll, got %v", builder.started)
+	}
+	if db.states["refs/heads/main"].SHA != "a2" {
+		t.Errorf("expected the commit to be recorded, got %s", db.states["refs/heads/main"].SHA)
+	}
+}
+
+func TestPoller_BuildsRefsAppearingLater(t *testing.T) {
+	p, db, builder, refs, now := newTestPoller(t)
+	ctx := context.Background()
+
+	// no watched ref exists yet
+	*refs = map[string]string{"refs/heads/feature/x": "b1"}
+	p.PollDue(ctx)
+	if len(db.states) != 1 || !db.states[""].IsMarker() {
+		t.Fatalf("expected only the marker, got %v", db.states)
+	}
+
+	*now = now.Add(5 * time.Minute)
+	(*refs)["refs/heads/main"] = "a1"
+	p.PollDue(ctx)
+	if len(builder.started) != 1 || builder.started[0].Branch != "main" {
+		t.Fatalf("expected a build of the new branch, got %v", builder.started)
+	}
+}
+
+func TestPoller_BacksOffOnErrors(t *testing.T) {
+	p, _, _, refs, now := newTestPoller(t)
+	ctx := context.Background()
+	*refs = nil
+
+	// 5m, 10m, 20m, then capped at the maximum backoff of 20m
+	for _, want := range []time.Duration{5 * time.Minute, 10 * time.Minute, 20 * time.Minute, 20 * time.Minute} {
+		p.PollDue(ctx)
+		next := p.schedules[1].next
+		if wait := next.Sub(*now); wait != want {
+			t.Fatalf("expected to wait %s, got %s", want, wait)
+		}
+		*now = next
+	}
+
+	*refs = map[string]string{"refs/heads/main": "a1"}
+	p.PollDue(ctx)
+	if s := p.schedules[1]; s.failures != 0 || s.next.Sub(*now) != 5*time.Minute {
+		t.Errorf("expected the backoff to be reset after a successful poll, got %+v", s)
+	}
+}
+
+func TestPoller_SkipsDisabledDefinitions(t *testing.T) {
+	p, db, builder, refs, _ := newTestPoller(t)
+	builder.polling.Enabled = false
+	*refs = map[string]string{"refs/heads/main": "a1"}
+
+	p.PollDue(context.Background())
+	if len(db.states) != 0 {
+		t.Errorf("expected no poll states, got %d", len(db.states))
+	}
+}
@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSuperseded is the cause of the cancellation of a build superseded by a newer one
+	ErrSuperseded = errors.New("superseded by a newer build")
+)
+
+// supersededError is the cause of the cancellation of a build, naming the build superseding it
+type supersededError struct {
+	by string
+}
+
+func (e supersededError) Error() string {
+	return ErrSuperseded.Error()
+}
+
+func (e supersededError) Is(target error) bool {
+	return target == ErrSuperseded
+}
+
+// Key identifies the builds which supersede each other, i.e. those of the same ref of a build definition
+type Key struct {
+	BuildDefinitionID uint
+	Ref               string
+}
+
+// Scheduler coalesces builds triggered in quick succession and cancels running builds
+// superseded by newer ones
+type Scheduler struct {
+	mut     sync.Mutex
+	pending map[Key]*pending
+	running map[Key][]*running
+}
+
+type pending struct {
+	timer      *time.Timer
+	superseded func(by string)
+}
+
+type running struct {
+	cancel context.CancelCauseFunc
+}
+
+// New creates a new scheduler
+func New() *Scheduler {
+	return &Scheduler{
+		pending: make(map[Key]*pending),
+		running: make(map[Key][]*running),
+	}
+}
+
+// Debounce runs start once the quiet period has passed without another call for the same key.
+// If another call arrives earlier, the superseded func of the pending one is called instead, with
+// the name of the newer call, e.g. the commit it builds.
+func (s *Scheduler) Debounce(key Key, name string, quietPeriod time.Duration, start func(), superseded func(by string)) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if p, ok := s.pending[key]; ok {
+		if p.timer.Stop() {
+			go p.superseded(name)
+		}
+	}
+
+	p := &pending{superseded: superseded}
+	p.timer = time.AfterFunc(quietPeriod, func() {
+		s.mut.Lock()
+		if s.pending[key] == p {
+			delete(s.pending, key)
+		}
+		s.mut.Unlock()
+		start()
+	})
+	s.pending[key] = p
+}
+
+// Start registers a build as running and returns its context.
+// With cancelPrevious, running builds with the same key are canceled with ErrSuperseded as cause,
+// which names the new build, see SupersededBy. The returned func has to be called once the build is finished.
+func (s *Scheduler) Start(parent context.Context, key Key, name string, cancelPrevious bool) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+
+	s.mut.Lock()
+	if cancelPrevious {
+		for _, prev := range s.running[key] {
+			prev.cancel(supersededError{by: name})
+		}
+	}
+	r := &running{cancel: cancel}
+	s.running[key] = append(s.running[key], r)
+	s.mut.Unlock()
+
+	return ctx, func() {
+		s.mut.Lock()
+		builds := s.running[key]
+		for i := range builds {
+			if builds[i] == r {
+				builds = append(builds[:i], builds[i+1:]...)
+				break
+			}
+		}
+		if len(builds) == 0 {
+			delete(s.running, key)
+		} else {
+			s.running[key] = builds
+		}
+		s.mut.Unlock()
+		cancel(nil)
+	}
+}
+
+// IsSuperseded checks whether the context of a build was canceled, because it was superseded
+func IsSuperseded(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrSuperseded)
+}
+
+// SupersededBy returns the name of the build superseding the one of the context, if any
+func SupersededBy(ctx context.Context) string {
+	var e supersededError
+	if errors.As(context.Cause(ctx), &e) {
+		return e.by
+	}
+	return ""
+}
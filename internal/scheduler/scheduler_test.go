@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduler_Debounce(t *testing.T) {
+	s := New()
+	key := Key{BuildDefinitionID: 1, Ref: "refs/heads/main"}
+
+	var (
+		mut        sync.Mutex
+		started    []int
+		superseded []string
+		wg         sync.WaitGroup
+	)
+	wg.Add(3)
+	for i := 1; i <= 3; i++ {
+		i := i
+		s.Debounce(key, strconv.Itoa(i), 50*time.Millisecond, func() {
+			mut.Lock()
+			started = append(started, i)
+			mut.Unlock()
+			wg.Done()
+		}, func(by string) {
+			mut.Lock()
+			superseded = append(superseded, fmt.Sprintf("%d by %s", i, by))
+			mut.Unlock()
+			wg.Done()
+		})
+	}
+	wg.Wait()
+
+	if len(started) != 1 || started[0] != 3 {
+		t.Errorf("expected only the newest build to start, got %v", started)
+	}
+	sort.Strings(superseded)
+	if len(superseded) != 2 || superseded[0] != "1 by 2" || superseded[1] != "2 by 3" {
+		t.Errorf("expected 2 builds superseded by their successors, got %v", superseded)
+	}
+	if len(s.pending) != 0 {
+		t.Errorf("expected no pending builds, got %d", len(s.pending))
+	}
+}
+
+func TestScheduler_Start(t *testing.T) {
+	s := New()
+	key := Key{BuildDefinitionID: 1, Ref: "refs/heads/main"}
+	other := Key{BuildDefinitionID: 1, Ref: "refs/heads/feature"}
+
+	first, doneFirst := s.Start(context.Background(), key, "first", true)
+	defer doneFirst()
+	otherCtx, doneOther := s.Start(context.Background(), other, "other", true)
+	defer doneOther()
+
+	// without the policy, builds run side by side
+	second, doneSecond := s.Start(context.Background(), key, "second", false)
+	if first.Err() != nil {
+		t.Fatalf("expected the first build to keep running")
+	}
+
+	third, doneThird := s.Start(context.Background(), key, "third", true)
+	defer doneThird()
+	if !IsSuperseded(first) || !IsSuperseded(second) {
+		t.Errorf("expected the older builds to be superseded")
+	}
+	if by := SupersededBy(first); by != "third" {
+		t.Errorf("expected the first build to be superseded by the third, got %q", by)
+	}
+	if otherCtx.Err() != nil {
+		t.Errorf("expected the build of another ref to keep running")
+	}
+	if third.Err() != nil {
+		t.Errorf("expected the newest build to run")
+	}
+
+	// finishing a build does not cancel others
+	doneSecond()
+	if IsSuperseded(third) {
+		t.Errorf("expected the newest build to keep running")
+	}
+}
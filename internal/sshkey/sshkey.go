@@ -0,0 +1,46 @@
+package sshkey
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyPair is an SSH key pair
+type KeyPair struct {
+	// PublicKey is in the authorized_keys format, as expected by git hosters for deploy keys
+	PublicKey string
+	// PrivateKey is PEM encoded in the OpenSSH format
+	PrivateKey string
+	// Fingerprint is the SHA256 fingerprint of the public key
+	Fingerprint string
+}
+
+// Generate creates a new Ed25519 key pair with the given comment
+func Generate(comment string) (KeyPair, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	block, err := ssh.MarshalPrivateKey(priv, comment)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	publicKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub)))
+	if comment != "" {
+		publicKey += " " + comment
+	}
+	return KeyPair{
+		PublicKey:   publicKey,
+		PrivateKey:  string(pem.EncodeToMemory(block)),
+		Fingerprint: ssh.FingerprintSHA256(sshPub),
+	}, nil
+}
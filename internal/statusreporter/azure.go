@@ -0,0 +1,41 @@
+package statusreporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type azureDevOps struct {
+	apiClient
+	repository string
+}
+
+var azureStates = map[State]string{
+	StatePending:  "pending",
+	StateRunning:  "pending",
+	StateSuccess:  "succeeded",
+	StateFailure:  "failed",
+	StateError:    "error",
+	StateCanceled: "notApplicable",
+}
+
+// Report creates a commit status,
+// see https://learn.microsoft.com/en-us/rest/api/azure/devops/git/statuses/create
+func (a *azureDevOps) Report(ctx context.Context, s Status) error {
+	body := map[string]any{
+		"state":       azureStates[s.State],
+		"description": s.Description,
+		"targetUrl":   s.TargetURL,
+		"context": map[string]string{
+			"name":  s.Context,
+			"genre": "continuous-integration",
+		},
+	}
+	path := fmt.Sprintf("/_apis/git/repositories/%s/commits/%s/statuses?api-version=7.1", url.PathEscape(a.repository), url.PathEscape(s.SHA))
+	return a.post(ctx, path, body, func(r *http.Request) {
+		// personal access tokens are used with an empty user name
+		r.SetBasicAuth("", a.token)
+	})
+}
@@ -0,0 +1,49 @@
+package statusreporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type bitbucket struct {
+	apiClient
+	repository string
+}
+
+var bitbucketStates = map[State]string{
+	StatePending:  "INPROGRESS",
+	StateRunning:  "INPROGRESS",
+	StateSuccess:  "SUCCESSFUL",
+	StateFailure:  "FAILED",
+	StateError:    "STOPPED",
+	StateCanceled: "STOPPED",
+}
+
+// Report creates or updates the build status of a commit,
+// see https://developer.atlassian.com/cloud/bitbucket/rest/api-group-commit-statuses/
+func (b *bitbucket) Report(ctx context.Context, s Status) error {
+	workspace, repo, err := splitRepository(b.repository)
+	if err != nil {
+		return err
+	}
+
+	// the key identifies the status, so every update overwrites the previous state
+	body := map[string]string{
+		"key":         s.Context,
+		"state":       bitbucketStates[s.State],
+		"name":        s.Context,
+		"url":         s.TargetURL,
+		"description": s.Description,
+	}
+	path := fmt.Sprintf("/repositories/%s/%s/commit/%s/statuses/build", url.PathEscape(workspace), url.PathEscape(repo), url.PathEscape(s.SHA))
+	return b.post(ctx, path, body, func(r *http.Request) {
+		// app passwords require the user name, access tokens do not
+		if b.user != "" {
+			r.SetBasicAuth(b.user, b.token)
+		} else {
+			r.Header.Set("Authorization", "Bearer "+b.token)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package statusreporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+var giteaStates = map[State]string{
+	StatePending:  "pending",
+	StateRunning:  "pending",
+	StateSuccess:  "success",
+	StateFailure:  "failure",
+	StateError:    "error",
+	StateCanceled: "warning",
+}
+
+// gitea also covers Forgejo, which provides the same API
+type gitea struct {
+	apiClient
+	repository string
+}
+
+// Report creates a commit status, see https://docs.gitea.com/api (repoCreateStatus)
+func (g *gitea) Report(ctx context.Context, s Status) error {
+	owner, repo, err := splitRepository(g.repository)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]string{
+		"state":       giteaStates[s.State],
+		"target_url":  s.TargetURL,
+		"description": s.Description,
+		"context":     s.Context,
+	}
+	path := fmt.Sprintf("/repos/%s/%s/statuses/%s", url.PathEscape(owner), url.PathEscape(repo), url.PathEscape(s.SHA))
+	return g.post(ctx, path, body, func(r *http.Request) {
+		r.Header.Set("Authorization", "token "+g.token)
+	})
+}
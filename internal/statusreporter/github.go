@@ -0,0 +1,43 @@
+package statusreporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// gitHubStates maps the states to those of GitHub, which knows no state for canceled builds. As the
+// commit was not built, they are reported as error, so they do not pass required status checks.
+var gitHubStates = map[State]string{
+	StatePending:  "pending",
+	StateRunning:  "pending",
+	StateSuccess:  "success",
+	StateFailure:  "failure",
+	StateError:    "error",
+	StateCanceled: "error",
+}
+
+type gitHub struct {
+	apiClient
+	repository string
+}
+
+// Report creates a commit status, see https://docs.github.com/en/rest/commits/statuses
+func (g *gitHub) Report(ctx context.Context, s Status) error {
+	owner, repo, err := splitRepository(g.repository)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]string{
+		"state":       gitHubStates[s.State],
+		"target_url":  s.TargetURL,
+		"description": s.Description,
+		"context":     s.Context,
+	}
+	path := fmt.Sprintf("/repos/%s/%s/statuses/%s", url.PathEscape(owner), url.PathEscape(repo), url.PathEscape(s.SHA))
+	return g.post(ctx, path, body, func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+g.token)
+	})
+}
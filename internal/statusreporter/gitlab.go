@@ -0,0 +1,38 @@
+package statusreporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type gitLab struct {
+	apiClient
+	repository string
+}
+
+var gitLabStates = map[State]string{
+	StatePending:  "pending",
+	StateRunning:  "running",
+	StateSuccess:  "success",
+	StateFailure:  "failed",
+	StateError:    "failed",
+	StateCanceled: "canceled",
+}
+
+// Report sets the commit status, which is shown as external pipeline stage,
+// see https://docs.gitlab.com/ee/api/commits.html#set-the-pipeline-status-of-a-commit
+func (g *gitLab) Report(ctx context.Context, s Status) error {
+	body := map[string]string{
+		"state":       gitLabStates[s.State],
+		"target_url":  s.TargetURL,
+		"description": s.Description,
+		"name":        s.Context,
+	}
+	// the project is identified by its url encoded path
+	path := fmt.Sprintf("/projects/%s/statuses/%s", url.PathEscape(g.repository), url.PathEscape(s.SHA))
+	return g.post(ctx, path, body, func(r *http.Request) {
+		r.Header.Set("PRIVATE-TOKEN", g.token)
+	})
+}
@@ -0,0 +1,207 @@
+package statusreporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+// DefaultContext is the name the statuses are reported with, if none is configured
+const DefaultContext = "tiny-build-server"
+
+var (
+	// ErrDisabled is returned if status reporting is not enabled for a build definition
+	ErrDisabled = errors.New("status reporting is disabled")
+)
+
+// State is the hoster independent state of a commit status
+type State string
+
+const (
+	// StatePending is the state of builds which are queued, but have not started yet
+	StatePending State = "pending"
+	// StateRunning is the state of builds which have started; hosters without a state of
+	// their own for running builds show them as pending
+	StateRunning State = "running"
+	StateSuccess State = "success"
+	StateFailure State = "failure"
+	StateError   State = "error"
+	// StateCanceled is the state of builds which were canceled or superseded by a newer build,
+	// which is neither a success nor a failure of the commit
+	StateCanceled State = "canceled"
+)
+
+// StateFromBuildStatus maps the status of a build execution to a commit status state
+func StateFromBuildStatus(s entity.BuildStatus) State {
+	switch s {
+	case entity.StatusSucceeded:
+		return StateSuccess
+	case entity.StatusFailed, entity.StatusPartiallySucceeded:
+		return StateFailure
+	case entity.StatusCreated:
+		return StatePending
+	case entity.StatusRunning:
+		return StateRunning
+	case entity.StatusCanceled, entity.StatusSuperseded:
+		return StateCanceled
+	default:
+		return StateError
+	}
+}
+
+// Status is a commit status to be reported to a git hoster
+type Status struct {
+	SHA         string
+	State       State
+	Description string
+	// TargetURL is the link to the build execution
+	TargetURL string
+	// Context is the name of the status, which distinguishes it from statuses of other services
+	Context string
+}
+
+// Reporter reports commit statuses to a git hoster
+type Reporter interface {
+	Report(ctx context.Context, s Status) error
+}
+
+// New creates the reporter for the hoster of the build definition. The API URL is derived from the
+// repository URL, unless configured explicitly, and the token defaults to the repository's access secret.
+func New(content *entity.BuildDefinitionContent, client *http.Client) (Reporter, error) {
+	opts := content.StatusReport
+	if !opts.Enabled {
+		return nil, ErrDisabled
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	token := opts.Token
+	if token == "" {
+		token = content.Repository.AccessSecret
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no token set for status reporting")
+	}
+
+	apiUrl := strings.TrimSuffix(opts.ApiUrl, "/")
+	var repoUrl *url.URL
+	if content.Repository.Url != "" {
+		u, err := url.Parse(content.Repository.Url)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse repository url: %s", err.Error())
+		}
+		repoUrl = u
+	}
+	hostUrl := func(path string) string {
+		if repoUrl == nil {
+			return ""
+		}
+		return repoUrl.Scheme + "://" + repoUrl.Host + path
+	}
+
+	c := apiClient{client: client, token: token}
+	switch content.Repository.Hoster {
+	case "github":
+		if apiUrl == "" {
+			apiUrl = "https://api.github.com"
+			// GitHub Enterprise Server
+			if repoUrl != nil && repoUrl.Host != "github.com" {
+				apiUrl = hostUrl("/api/v3")
+			}
+		}
+		c.baseUrl = apiUrl
+		return &gitHub{apiClient: c, repository: content.Repository.Name}, nil
+	case "gitlab":
+		if apiUrl == "" {
+			apiUrl = hostUrl("/api/v4")
+		}
+		c.baseUrl = apiUrl
+		return &gitLab{apiClient: c, repository: content.Repository.Name}, nil
+	case "gitea":
+		if apiUrl == "" {
+			apiUrl = hostUrl("/api/v1")
+		}
+		c.baseUrl = apiUrl
+		return &gitea{apiClient: c, repository: content.Repository.Name}, nil
+	case "bitbucket":
+		if apiUrl == "" {
+			apiUrl = "https://api.bitbucket.org/2.0"
+		}
+		c.baseUrl = apiUrl
+		c.user = content.Repository.AccessUser
+		return &bitbucket{apiClient: c, repository: content.Repository.Name}, nil
+	case "azure_devops":
+		// the repository url has the form of https://dev.azure.com/<organization>/<project>/_git/<repository>
+		if apiUrl == "" && repoUrl != nil {
+			if i := strings.Index(repoUrl.Path, "/_git/"); i >= 0 {
+				apiUrl = hostUrl(repoUrl.Path[:i])
+			}
+		}
+		c.baseUrl = apiUrl
+		return &azureDevOps{apiClient: c, repository: content.Repository.Name}, nil
+	default:
+		return nil, fmt.Errorf("status reporting is not supported for hoster %s", content.Repository.Hoster)
+	}
+}
+
+// apiClient sends JSON requests to the API of a git hoster
+type apiClient struct {
+	client  *http.Client
+	baseUrl string
+	token   string
+	user    string
+}
+
+// post sends the body as JSON to the path, relative to the base url. The authorize func
+// sets the authentication header, which differs from hoster to hoster.
+func (c *apiClient) post(ctx context.Context, path string, body any, authorize func(r *http.Request)) error {
+	if c.baseUrl == "" {
+		return fmt.Errorf("could not determine api url")
+	}
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseUrl+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	authorize(req)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// splitRepository splits a repository name in the form of "owner/repo"
+func splitRepository(name string) (string, string, error) {
+	owner, repo, ok := strings.Cut(name, "/")
+	if !ok || owner == "" || repo == "" {
+		return "", "", fmt.Errorf("repository name %s is not in the form of owner/repository", name)
+	}
+	return owner, repo, nil
+}
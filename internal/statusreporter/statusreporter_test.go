@@ -0,0 +1,309 @@
+package statusreporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KaiserWerk/Tiny-Build-Server/internal/entity"
+)
+
+const sha = "1316f73b181936990972ab07e3d6c215367bf8cc"
+
+func TestReporters(t *testing.T) {
+	tests := []struct {
+		name       string
+		hoster     string
+		repository string
+		user       string
+		state      State
+		wantPath   string
+		wantQuery  string
+		checkAuth  func(r *http.Request) bool
+		wantBody   map[string]any
+	}{
+		{
+			name:       "github",
+			hoster:     "github",
+			repository: "user/repo",
+			state:      StatePending,
+			wantPath:   "/repos/user/repo/statuses/" + sha,
+			checkAuth:  func(r *http.Request) bool { return r.Header.Get("Authorization") == "Bearer tok" },
+			wantBody:   map[string]any{"state": "pending", "context": DefaultContext, "target_url": "http://tbs/buildexecution/1/show"},
+		},
+		{
+			name:       "gitlab",
+			hoster:     "gitlab",
+			repository: "group/sub/repo",
+			state:      StateFailure,
+			wantPath:   "/projects/group%2Fsub%2Frepo/statuses/" + sha,
+			checkAuth:  func(r *http.Request) bool { return r.Header.Get("PRIVATE-TOKEN") == "tok" },
+			wantBody:   map[string]any{"state": "failed", "name": DefaultContext},
+		},
+		{
+			name:       "gitea",
+			hoster:     "gitea",
+			repository: "user/repo",
+			state:      StateSuccess,
+			wantPath:   "/repos/user/repo/statuses/" + sha,
+			checkAuth:  func(r *http.Request) bool { return r.Header.Get("Authorization") == "token tok" },
+			wantBody:   map[string]any{"state": "success", "context": DefaultContext},
+		},
+		{
+			name:       "bitbucket app password",
+			hoster:     "bitbucket",
+			repository: "workspace/repo",
+			user:       "someone",
+			state:      StatePending,
+			wantPath:   "/repositories/workspace/repo/commit/" + sha + "/statuses/build",
+			checkAuth: func(r *http.Request) bool {
+				u, p, ok := r.BasicAuth()
+				return ok && u == "someone" && p == "tok"
+			},
+			wantBody: map[string]any{"state": "INPROGRESS", "key": DefaultContext},
+		},
+		{
+			name:       "azure devops",
+			hoster:     "azure_devops",
+			repository: "repo",
+			state:      StateSuccess,
+			wantPath:   "/_apis/git/repositories/repo/commits/" + sha + "/statuses",
+			wantQuery:  "api-version=7.1",
+			checkAuth: func(r *http.Request) bool {
+				_, p, ok := r.BasicAuth()
+				return ok && p == "tok"
+			},
+			wantBody: map[string]any{"state": "succeeded", "targetUrl": "http://tbs/buildexecution/1/show"},
+		},
+		{
+			name:       "github canceled",
+			hoster:     "github",
+			repository: "user/repo",
+			state:      StateCanceled,
+			wantPath:   "/repos/user/repo/statuses/" + sha,
+			checkAuth:  func(r *http.Request) bool { return true },
+			wantBody:   map[string]any{"state": "error"},
+		},
+		{
+			name:       "gitlab pending",
+			hoster:     "gitlab",
+			repository: "group/repo",
+			state:      StatePending,
+			wantPath:   "/projects/group%2Frepo/statuses/" + sha,
+			checkAuth:  func(r *http.Request) bool { return true },
+			wantBody:   map[string]any{"state": "pending"},
+		},
+		{
+			name:       "gitlab running",
+			hoster:     "gitlab",
+			repository: "group/repo",
+			state:      StateRunning,
+			wantPath:   "/projects/group%2Frepo/statuses/" + sha,
+			checkAuth:  func(r *http.Request) bool { return true },
+			wantBody:   map[string]any{"state": "running"},
+		},
+		{
+			name:       "github running",
+			hoster:     "github",
+			repository: "user/repo",
+			state:      StateRunning,
+			wantPath:   "/repos/user/repo/statuses/" + sha,
+			checkAuth:  func(r *http.Request) bool { return true },
+			wantBody:   map[string]any{"state": "pending"},
+		},
+		{
+			name:       "gitlab canceled",
+			hoster:     "gitlab",
+			repository: "group/repo",
+			state:      StateCanceled,
+			wantPath:   "/projects/group%2Frepo/statuses/" + sha,
+			checkAuth:  func(r *http.Request) bool { return true },
+			wantBody:   map[string]any{"state": "canceled"},
+		},
+		{
+			name:       "gitea canceled",
+			hoster:     "gitea",
+			repository: "user/repo",
+			state:      StateCanceled,
+			wantPath:   "/repos/user/repo/statuses/" + sha,
+			checkAuth:  func(r *http.Request) bool { return true },
+			wantBody:   map[string]any{"state": "warning"},
+		},
+		{
+			name:       "bitbucket canceled",
+			hoster:     "bitbucket",
+			repository: "workspace/repo",
+			state:      StateCanceled,
+			wantPath:   "/repositories/workspace/repo/commit/" + sha + "/statuses/build",
+			checkAuth:  func(r *http.Request) bool { return true },
+			wantBody:   map[string]any{"state": "STOPPED"},
+		},
+		{
+			name:       "azure devops canceled",
+			hoster:     "azure_devops",
+			repository: "repo",
+			state:      StateCanceled,
+			wantPath:   "/_apis/git/repositories/repo/commits/" + sha + "/statuses",
+			wantQuery:  "api-version=7.1",
+			checkAuth:  func(r *http.Request) bool { return true },
+			wantBody:   map[string]any{"state": "notApplicable"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				if r.Method != http.MethodPost {
+					t.Errorf("expected POST, got %s", r.Method)
+				}
+				if r.URL.EscapedPath() != tt.wantPath {
+					t.Errorf("expected path %s, got %s", tt.wantPath, r.URL.EscapedPath())
+				}
+				if r.URL.RawQuery != tt.wantQuery {
+					t.Errorf("expected query %s, got %s", tt.wantQuery, r.URL.RawQuery)
+				}
+				if !tt.checkAuth(r) {
+					t.Errorf("unexpected authentication")
+				}
+				body := make(map[string]any)
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Fatalf("could not decode body: %s", err.Error())
+				}
+				for k, v := range tt.wantBody {
+					if body[k] != v {
+						t.Errorf("expected %s = %v, got %v", k, v, body[k])
+					}
+				}
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer srv.Close()
+
+			var content entity.BuildDefinitionContent
+			content.Repository.Hoster = tt.hoster
+			content.Repository.Name = tt.repository
+			content.Repository.AccessUser = tt.user
+			content.StatusReport = entity.StatusReport{Enabled: true, ApiUrl: srv.URL, Token: "tok"}
+
+			rep, err := New(&content, srv.Client())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			err = rep.Report(context.Background(), Status{
+				SHA:       sha,
+				State:     tt.state,
+				TargetURL: "http://tbs/buildexecution/1/show",
+				Context:   DefaultContext,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if !called {
+				t.Errorf("expected the API to be called")
+			}
+		})
+	}
+}
+
+func TestReporterErrorResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad credentials", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	var content entity.BuildDefinitionContent
+	content.Repository.Hoster = "github"
+	content.Repository.Name = "user/repo"
+	content.StatusReport = entity.StatusReport{Enabled: true, ApiUrl: srv.URL, Token: "tok"}
+
+	rep, err := New(&content, srv.Client())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err = rep.Report(context.Background(), Status{SHA: sha, State: StateSuccess}); err == nil {
+		t.Errorf("expected an error for status code 401")
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		content entity.BuildDefinitionContent
+		wantUrl string
+		wantErr error
+	}{
+		{
+			name:    "disabled",
+			content: entity.BuildDefinitionContent{Repository: entity.Repository{Hoster: "github", AccessSecret: "tok"}},
+			wantErr: ErrDisabled,
+		},
+		{
+			name:    "github.com",
+			content: entity.BuildDefinitionContent{Repository: entity.Repository{Hoster: "github", Url: "https://github.com/user/repo", AccessSecret: "tok"}, StatusReport: entity.StatusReport{Enabled: true}},
+			wantUrl: "https://api.github.com",
+		},
+		{
+			name:    "github enterprise",
+			content: entity.BuildDefinitionContent{Repository: entity.Repository{Hoster: "github", Url: "https://git.example.com/user/repo", AccessSecret: "tok"}, StatusReport: entity.StatusReport{Enabled: true}},
+			wantUrl: "https://git.example.com/api/v3",
+		},
+		{
+			name:    "self-hosted gitlab",
+			content: entity.BuildDefinitionContent{Repository: entity.Repository{Hoster: "gitlab", Url: "https://gitlab.example.com/group/repo", AccessSecret: "tok"}, StatusReport: entity.StatusReport{Enabled: true}},
+			wantUrl: "https://gitlab.example.com/api/v4",
+		},
+		{
+			name:    "azure devops",
+			content: entity.BuildDefinitionContent{Repository: entity.Repository{Hoster: "azure_devops", Url: "https://dev.azure.com/org/project/_git/repo", AccessSecret: "tok"}, StatusReport: entity.StatusReport{Enabled: true}},
+			wantUrl: "https://dev.azure.com/org/project",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rep, err := New(&tt.content, nil)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+
+			var got string
+			switch r := rep.(type) {
+			case *gitHub:
+				got = r.baseUrl
+			case *gitLab:
+				got = r.baseUrl
+			case *azureDevOps:
+				got = r.baseUrl
+			}
+			if got != tt.wantUrl {
+				t.Errorf("expected api url %s, got %s", tt.wantUrl, got)
+			}
+		})
+	}
+}
+
+func TestStateFromBuildStatus(t *testing.T) {
+	tests := map[entity.BuildStatus]State{
+		entity.StatusCreated:            StatePending,
+		entity.StatusRunning:            StateRunning,
+		entity.StatusSucceeded:          StateSuccess,
+		entity.StatusPartiallySucceeded: StateFailure,
+		entity.StatusFailed:             StateFailure,
+		entity.StatusSuperseded:         StateCanceled,
+		entity.StatusCanceled:           StateCanceled,
+		entity.StatusUnknown:            StateError,
+	}
+	for status, want := range tests {
+		if got := StateFromBuildStatus(status); got != want {
+			t.Errorf("expected state %s for status %s, got %s", want, status, got)
+		}
+	}
+}